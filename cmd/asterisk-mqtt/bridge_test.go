@@ -11,6 +11,7 @@ import (
 	"github.com/sweeney/asterisk-mqtt/internal/ami"
 	"github.com/sweeney/asterisk-mqtt/internal/correlator"
 	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
 )
 
 func fixturesDir() string {
@@ -31,7 +32,7 @@ func runPipeline(t *testing.T, fixture, prefix string) *publisher.MockPublisher
 	for _, evt := range events {
 		changes := corr.Process(evt)
 		for _, change := range changes {
-			if err := publishChange(context.Background(), mock, prefix, change); err != nil {
+			if err := publishChange(context.Background(), mock, defaultRouter(t, prefix), change); err != nil {
 				t.Fatalf("publish error: %v", err)
 			}
 		}
@@ -39,6 +40,16 @@ func runPipeline(t *testing.T, fixture, prefix string) *publisher.MockPublisher
 	return mock
 }
 
+// defaultRouter returns a router for the default topic layout.
+func defaultRouter(t *testing.T, prefix string) *topic.Router {
+	t.Helper()
+	router, err := topic.NewRouter(prefix, nil)
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	return router
+}
+
 func parsePayload(t *testing.T, data []byte) map[string]any {
 	t.Helper()
 	var m map[string]any
@@ -216,7 +227,7 @@ func TestIntegrationLiveSession(t *testing.T) {
 	for _, evt := range events {
 		changes := corr.Process(evt)
 		for _, change := range changes {
-			if err := publishChange(context.Background(), mock, "asterisk", change); err != nil {
+			if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
 				t.Fatalf("publish error: %v", err)
 			}
 		}
@@ -309,3 +320,447 @@ func extractCallID(t *testing.T, topic string) string {
 	}
 	return parts[len(parts)-2]
 }
+
+// --- Transfer payload ---
+
+func TestTransferredPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State:         correlator.StateTransferred,
+		CallID:        "1770888509.40",
+		From:          correlator.Endpoint{Extension: "1986", Name: "Martin"},
+		To:            correlator.Endpoint{Extension: "22"},
+		TransferType:  "blind",
+		TransferredBy: correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+	}
+	if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/call/1770888509.40/transferred" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "event", "transferred")
+	assertPayloadField(t, p, "description", "The call has been transferred to another party")
+	assertPayloadField(t, p, "transfer_type", "blind")
+	by := p["transferred_by"].(map[string]any)
+	if by["extension"] != "21" || by["name"] != "Kitchen" {
+		t.Errorf("unexpected transferred_by %v", by)
+	}
+	if _, ok := p["cause"]; ok {
+		t.Error("transferred payload should not carry hangup fields")
+	}
+}
+
+// --- Hunt group payloads ---
+
+func TestIntegrationHuntgroupMissedBy(t *testing.T) {
+	mock := runPipeline(t, "unanswered-huntgroup.raw", "asterisk")
+	msgs := mock.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+
+	hungup := parsePayload(t, msgs[1].Payload)
+	if _, ok := hungup["answered_by"]; ok {
+		t.Error("unexpected answered_by for unanswered call")
+	}
+	missed, ok := hungup["missed_by"].([]any)
+	if !ok || len(missed) != 6 {
+		t.Fatalf("expected 6 missed_by entries, got %v", hungup["missed_by"])
+	}
+	first := missed[0].(map[string]any)
+	if first["extension"] == "" || first["name"] == "" {
+		t.Errorf("expected extension and name in missed_by, got %v", first)
+	}
+}
+
+func TestIntegrationAnsweredBy(t *testing.T) {
+	mock := runPipeline(t, "answered-outbound.raw", "asterisk")
+	msgs := mock.Messages()
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(msgs))
+	}
+	for _, m := range msgs[1:] {
+		p := parsePayload(t, m.Payload)
+		by, ok := p["answered_by"].(map[string]any)
+		if !ok || by["extension"] != "21" {
+			t.Errorf("%v: expected answered_by.extension=21, got %v", p["event"], p["answered_by"])
+		}
+	}
+}
+
+// --- Leg payloads ---
+
+func TestLegPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State:  correlator.StateLeg,
+		CallID: "1770888585.43",
+		From:   correlator.Endpoint{Extension: "1986", Name: "Martin"},
+		To:     correlator.Endpoint{Extension: "666"},
+		Leg: &correlator.Leg{
+			ID:       "1770888585.45",
+			Endpoint: correlator.Endpoint{Extension: "12", Name: "Games Room"},
+			State:    correlator.LegRinging,
+		},
+	}
+	if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/call/1770888585.43/leg/1770888585.45/ringing" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "event", "leg")
+	assertPayloadField(t, p, "description", "A destination of the call is ringing")
+	l := p["leg"].(map[string]any)
+	if l["id"] != "1770888585.45" || l["state"] != "ringing" || l["extension"] != "12" || l["name"] != "Games Room" {
+		t.Errorf("unexpected leg %v", l)
+	}
+	if _, ok := p["ring_duration_seconds"]; ok {
+		t.Error("leg payload should not carry call-level fields")
+	}
+}
+
+// --- Outcome payloads ---
+
+func TestIntegrationHungupOutcome(t *testing.T) {
+	tests := map[string]string{
+		"answered-outbound.raw":    "answered",
+		"unanswered-cancel.raw":    "cancelled",
+		"unanswered-huntgroup.raw": "no_answer",
+	}
+	for fixture, outcome := range tests {
+		t.Run(fixture, func(t *testing.T) {
+			msgs := runPipeline(t, fixture, "asterisk").Messages()
+			if len(msgs) == 0 {
+				t.Fatal("expected messages")
+			}
+			last := msgs[len(msgs)-1]
+			assertTopicSuffix(t, last.Topic, "/hungup")
+			assertPayloadField(t, parsePayload(t, last.Payload), "outcome", outcome)
+		})
+	}
+}
+
+func TestOutcomeOnlyOnHungup(t *testing.T) {
+	msgs := runPipeline(t, "answered-outbound.raw", "asterisk").Messages()
+	for _, m := range msgs[:len(msgs)-1] {
+		if _, ok := parsePayload(t, m.Payload)["outcome"]; ok {
+			t.Errorf("%s: unexpected outcome before hangup", m.Topic)
+		}
+	}
+}
+
+func TestHungupCauseCategory(t *testing.T) {
+	msgs := runPipeline(t, "unanswered-cancel.raw", "asterisk").Messages()
+	p := parsePayload(t, msgs[len(msgs)-1].Payload)
+	assertPayloadField(t, p, "cause", "cancelled")
+	assertPayloadField(t, p, "cause_category", "user")
+}
+
+// --- Hold payloads ---
+
+func TestHoldPayloads(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	changes := []correlator.CallStateChange{
+		{State: correlator.StateHeld, CallID: "1770888509.40", HoldCount: 1},
+		{State: correlator.StateResumed, CallID: "1770888509.40", HoldDuration: 12.5, HoldCount: 1},
+		{State: correlator.StateHungUp, CallID: "1770888509.40", Cause: "normal_clearing", HoldDuration: 12.5, HoldCount: 1},
+	}
+	for _, change := range changes {
+		if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+			t.Fatalf("publish error: %v", err)
+		}
+	}
+
+	msgs := mock.Messages()
+	assertTopicSuffix(t, msgs[0].Topic, "/held")
+	held := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, held, "description", "The call has been put on hold")
+	if held["hold_count"] != 1.0 {
+		t.Errorf("expected hold_count=1, got %v", held["hold_count"])
+	}
+	if _, ok := held["hold_duration_seconds"]; ok {
+		t.Error("held payload should not carry hold_duration_seconds")
+	}
+
+	assertTopicSuffix(t, msgs[1].Topic, "/resumed")
+	resumed := parsePayload(t, msgs[1].Payload)
+	if resumed["hold_duration_seconds"] != 12.5 {
+		t.Errorf("expected hold_duration_seconds=12.5, got %v", resumed["hold_duration_seconds"])
+	}
+
+	hungup := parsePayload(t, msgs[2].Payload)
+	if hungup["hold_duration_seconds"] != 12.5 || hungup["hold_count"] != 1.0 {
+		t.Errorf("expected hold summary in hungup, got %v / %v", hungup["hold_duration_seconds"], hungup["hold_count"])
+	}
+}
+
+func TestHungupWithoutHoldReportsZero(t *testing.T) {
+	msgs := runPipeline(t, "answered-outbound.raw", "asterisk").Messages()
+	p := parsePayload(t, msgs[len(msgs)-1].Payload)
+	if p["hold_duration_seconds"] != 0.0 || p["hold_count"] != 0.0 {
+		t.Errorf("expected zero hold summary, got %v / %v", p["hold_duration_seconds"], p["hold_count"])
+	}
+}
+
+// --- Voicemail payloads ---
+
+func TestVoicemailPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State:    correlator.StateVoicemail,
+		CallID:   "1770888585.43",
+		From:     correlator.Endpoint{Extension: "1986", Name: "Martin"},
+		To:       correlator.Endpoint{Extension: "666"},
+		Mailbox:  "666@default",
+		MissedBy: []correlator.Endpoint{{Extension: "11", Name: "Office"}},
+	}
+	if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if msgs[0].Topic != "asterisk/call/1770888585.43/voicemail" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "event", "voicemail")
+	assertPayloadField(t, p, "mailbox", "666@default")
+	if missed, ok := p["missed_by"].([]any); !ok || len(missed) != 1 {
+		t.Errorf("expected missed_by with 1 entry, got %v", p["missed_by"])
+	}
+	if _, ok := p["ring_duration_seconds"]; ok {
+		t.Error("voicemail payload should not carry ring_duration_seconds")
+	}
+}
+
+// --- Queue payloads ---
+
+func TestQueuePayloads(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	changes := []correlator.CallStateChange{
+		{State: correlator.StateQueued, CallID: "1770888600.50", Queue: "sales", QueuePosition: 2},
+		{State: correlator.StateAgentConnected, CallID: "1770888600.50", Queue: "sales", QueueWait: 12,
+			Agent: &correlator.Endpoint{Extension: "21", Name: "Kitchen"}},
+		{State: correlator.StateHungUp, CallID: "1770888600.50", Queue: "sales", QueueWait: 12, Outcome: correlator.OutcomeAnswered},
+	}
+	for _, change := range changes {
+		if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+			t.Fatalf("publish error: %v", err)
+		}
+	}
+
+	msgs := mock.Messages()
+	if msgs[0].Topic != "asterisk/queue/sales/call/1770888600.50/queued" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	queued := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, queued, "queue", "sales")
+	if queued["queue_position"] != 2.0 {
+		t.Errorf("expected queue_position=2, got %v", queued["queue_position"])
+	}
+	if _, ok := queued["queue_wait_seconds"]; ok {
+		t.Error("queued payload should not carry queue_wait_seconds")
+	}
+
+	if msgs[1].Topic != "asterisk/queue/sales/call/1770888600.50/agent_connected" {
+		t.Errorf("unexpected topic %q", msgs[1].Topic)
+	}
+	connected := parsePayload(t, msgs[1].Payload)
+	assertPayloadField(t, connected, "description", "The call has been answered by a queue member")
+	if connected["queue_wait_seconds"] != 12.0 {
+		t.Errorf("expected queue_wait_seconds=12, got %v", connected["queue_wait_seconds"])
+	}
+	if agent, ok := connected["agent"].(map[string]any); !ok || agent["extension"] != "21" {
+		t.Errorf("expected agent 21, got %v", connected["agent"])
+	}
+
+	assertTopicSuffix(t, msgs[2].Topic, "/call/1770888600.50/hungup")
+	hungup := parsePayload(t, msgs[2].Payload)
+	assertPayloadField(t, hungup, "queue", "sales")
+}
+
+func TestAbandonedPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State: correlator.StateAbandoned, CallID: "1770888600.51", Queue: "sales", QueuePosition: 1, QueueWait: 35,
+	}
+	if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if msgs[0].Topic != "asterisk/queue/sales/call/1770888600.51/abandoned" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	if p["queue_position"] != 1.0 || p["queue_wait_seconds"] != 35.0 {
+		t.Errorf("expected position 1 after 35s, got %v / %v", p["queue_position"], p["queue_wait_seconds"])
+	}
+}
+
+func TestHungupWithoutQueueOmitsQueueFields(t *testing.T) {
+	msgs := runPipeline(t, "answered-outbound.raw", "asterisk").Messages()
+	p := parsePayload(t, msgs[len(msgs)-1].Payload)
+	if _, ok := p["queue"]; ok {
+		t.Error("hungup payload of a call that wasn't queued should not carry queue")
+	}
+	if _, ok := p["queue_wait_seconds"]; ok {
+		t.Error("hungup payload of a call that wasn't queued should not carry queue_wait_seconds")
+	}
+}
+
+// --- Parking payloads ---
+
+func TestParkingPayloads(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	changes := []correlator.CallStateChange{
+		{State: correlator.StateParked, CallID: "1770888509.40", ParkingLot: "default", ParkingSlot: "701"},
+		{State: correlator.StateUnparked, CallID: "1770888509.40", ParkingLot: "default", ParkingSlot: "701",
+			UnparkReason: correlator.UnparkRetrieved, RetrievedBy: &correlator.Endpoint{Extension: "22", Name: "Office"}},
+	}
+	for _, change := range changes {
+		if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+			t.Fatalf("publish error: %v", err)
+		}
+	}
+
+	msgs := mock.Messages()
+	if msgs[0].Topic != "asterisk/call/1770888509.40/parked" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	parked := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, parked, "parking_lot", "default")
+	assertPayloadField(t, parked, "parking_slot", "701")
+	if _, ok := parked["retrieved_by"]; ok {
+		t.Error("parked payload should not carry retrieved_by")
+	}
+
+	unparked := parsePayload(t, msgs[1].Payload)
+	assertPayloadField(t, unparked, "description", "The call has left its parking slot")
+	assertPayloadField(t, unparked, "unpark_reason", "retrieved")
+	if by, ok := unparked["retrieved_by"].(map[string]any); !ok || by["extension"] != "22" {
+		t.Errorf("expected retrieved_by 22, got %v", unparked["retrieved_by"])
+	}
+}
+
+// --- Pickup payloads ---
+
+func TestPickedUpByPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	picker := &correlator.Endpoint{Extension: "22", Name: "Office"}
+	changes := []correlator.CallStateChange{
+		{State: correlator.StateAnswered, CallID: "1770888509.40", To: *picker, AnsweredBy: picker, PickedUpBy: picker,
+			MissedBy: []correlator.Endpoint{{Extension: "21", Name: "Kitchen"}}},
+		{State: correlator.StateHungUp, CallID: "1770888509.40", To: *picker, AnsweredBy: picker, PickedUpBy: picker},
+	}
+	for _, change := range changes {
+		if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+			t.Fatalf("publish error: %v", err)
+		}
+	}
+
+	for _, msg := range mock.Messages() {
+		p := parsePayload(t, msg.Payload)
+		if by, ok := p["picked_up_by"].(map[string]any); !ok || by["extension"] != "22" {
+			t.Errorf("%s: expected picked_up_by 22, got %v", msg.Topic, p["picked_up_by"])
+		}
+		if to := p["to"].(map[string]any); to["extension"] != "22" {
+			t.Errorf("%s: expected to=22, got %v", msg.Topic, to)
+		}
+	}
+}
+
+func TestIntegrationNoPickedUpBy(t *testing.T) {
+	msgs := runPipeline(t, "answered-internal.raw", "asterisk").Messages()
+	for _, msg := range msgs {
+		p := parsePayload(t, msg.Payload)
+		if _, ok := p["picked_up_by"]; ok {
+			t.Errorf("%s: a call answered by the dialed phone should not carry picked_up_by", msg.Topic)
+		}
+	}
+}
+
+// --- Caller ID update payloads ---
+
+func TestUpdatedPayload(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State:  correlator.StateUpdated,
+		CallID: "1770888509.40",
+		From:   correlator.Endpoint{Extension: "01234567890", Name: "Acme Ltd"},
+		To:     correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+	}
+	if err := publishChange(context.Background(), mock, defaultRouter(t, "asterisk"), change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 || msgs[0].Topic != "asterisk/call/1770888509.40/updated" {
+		t.Fatalf("expected one message on the updated topic, got %+v", msgs)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "event", "updated")
+	assertPayloadField(t, p, "description", "The caller ID of a party to the call has changed")
+	if from := p["from"].(map[string]any); from["name"] != "Acme Ltd" {
+		t.Errorf("expected from name Acme Ltd, got %v", from)
+	}
+}
+
+// --- Topic layout ---
+
+func TestPublishChangeToCustomTopics(t *testing.T) {
+	router, err := topic.NewRouter("asterisk", []topic.Route{
+		{Template: "{prefix}/extension/{to.extension}/{event}"},
+		{Template: "{prefix}/events"},
+	})
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	mock := publisher.NewMockPublisher()
+	change := correlator.CallStateChange{
+		State:  correlator.StateRinging,
+		CallID: "1770888509.40",
+		From:   correlator.Endpoint{Extension: "1986", Name: "Martin"},
+		To:     correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+	}
+	if err := publishChange(context.Background(), mock, router, change); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 2 || msgs[0].Topic != "asterisk/extension/21/ringing" || msgs[1].Topic != "asterisk/events" {
+		t.Fatalf("expected the extension and events topics, got %+v", msgs)
+	}
+	if string(msgs[0].Payload) != string(msgs[1].Payload) {
+		t.Error("expected the same payload on every topic")
+	}
+	assertPayloadField(t, parsePayload(t, msgs[1].Payload), "event", "ringing")
+}
+
+func TestPublishChangeWithoutTopics(t *testing.T) {
+	router, err := topic.NewRouter("asterisk", []topic.Route{{Template: "{prefix}/events", Events: []string{"hungup"}}})
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	mock := publisher.NewMockPublisher()
+	if err := publishChange(context.Background(), mock, router, correlator.CallStateChange{State: correlator.StateRinging}); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+	if msgs := mock.Messages(); len(msgs) != 0 {
+		t.Errorf("expected nothing published for an unrouted event, got %+v", msgs)
+	}
+}
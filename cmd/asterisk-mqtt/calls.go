@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+// activeCallsPayload is the retained JSON published to {prefix}/calls/active.
+type activeCallsPayload struct {
+	Description string       `json:"description"`
+	Count       int          `json:"count"`
+	Calls       []activeCall `json:"calls"`
+	Timestamp   string       `json:"timestamp"`
+}
+
+// activeCall is one call in progress, as listed in calls/active and
+// published alone to {prefix}/call/{id}/state.
+type activeCall struct {
+	CallID string   `json:"call_id"`
+	From   endpoint `json:"from"`
+	To     endpoint `json:"to"`
+	State  string   `json:"state"`
+	Since  string   `json:"since"`
+}
+
+func newActiveCall(call correlator.ActiveCall) activeCall {
+	return activeCall{
+		CallID: call.CallID,
+		From:   endpoint{Extension: call.From.Extension, Name: call.From.Name},
+		To:     endpoint{Extension: call.To.Extension, Name: call.To.Name},
+		State:  string(call.State),
+		Since:  call.Since.UTC().Format(time.RFC3339),
+	}
+}
+
+// publishCallSnapshots republishes the retained list of calls in progress
+// after changes, and with stateTopics each changed call's own state topic,
+// which is cleared once the call hangs up. It logs rather than returns
+// failures.
+func publishCallSnapshots(ctx context.Context, pub publisher.Publisher, prefix string, calls []correlator.ActiveCall, changes []correlator.CallStateChange, stateTopics bool, now time.Time) {
+	if err := publishActiveCalls(ctx, pub, prefix, calls, now); err != nil {
+		log.Printf("publish error: %v", err)
+	}
+	if !stateTopics {
+		return
+	}
+
+	byID := make(map[string]correlator.ActiveCall, len(calls))
+	for _, call := range calls {
+		byID[call.CallID] = call
+	}
+	done := map[string]bool{}
+	for _, change := range changes {
+		if done[change.CallID] {
+			continue
+		}
+		done[change.CallID] = true
+
+		var err error
+		if call, ok := byID[change.CallID]; ok {
+			err = publishCallState(ctx, pub, prefix, call)
+		} else if change.State == correlator.StateHungUp {
+			err = clearCallState(ctx, pub, prefix, change.CallID)
+		}
+		if err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishActiveCalls(ctx context.Context, pub publisher.Publisher, prefix string, calls []correlator.ActiveCall, now time.Time) error {
+	topic := prefix + "/calls/active"
+
+	payload := activeCallsPayload{
+		Description: "No calls are in progress",
+		Count:       len(calls),
+		Calls:       []activeCall{},
+		Timestamp:   now.UTC().Format(time.RFC3339),
+	}
+	switch n := len(calls); {
+	case n == 1:
+		payload.Description = "1 call is in progress"
+	case n > 1:
+		payload.Description = fmt.Sprintf("%d calls are in progress", n)
+	}
+	for _, call := range calls {
+		payload.Calls = append(payload.Calls, newActiveCall(call))
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", topic)
+	return pub.PublishRetained(ctx, topic, data)
+}
+
+func publishCallState(ctx context.Context, pub publisher.Publisher, prefix string, call correlator.ActiveCall) error {
+	topic := callStateTopic(prefix, call.CallID)
+
+	data, err := json.Marshal(newActiveCall(call))
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", topic)
+	return pub.PublishRetained(ctx, topic, data)
+}
+
+// clearCallState removes the retained state of a call that has ended.
+func clearCallState(ctx context.Context, pub publisher.Publisher, prefix, callID string) error {
+	topic := callStateTopic(prefix, callID)
+	log.Printf("clearing %s", topic)
+	return pub.PublishRetained(ctx, topic, nil)
+}
+
+// staleStateSettle is how long to wait for the broker to send the
+// retained call states when looking for stale ones.
+const staleStateSettle = 2 * time.Second
+
+// clearStaleCallStates clears the retained state topics of calls that are
+// no longer in progress, left by a previous run that never saw them end.
+// calls is what Asterisk reported on resync, so anything else is stale.
+func clearStaleCallStates(ctx context.Context, lister publisher.RetainedLister, pub publisher.Publisher, prefix string, calls []correlator.ActiveCall) error {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	topics, err := lister.RetainedTopics(listCtx, prefix+"/call/+/state", staleStateSettle)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]bool, len(calls))
+	for _, call := range calls {
+		live[callStateTopic(prefix, call.CallID)] = true
+	}
+	for _, topic := range topics {
+		if live[topic] {
+			continue
+		}
+		log.Printf("clearing stale %s", topic)
+		if err := pub.PublishRetained(ctx, topic, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func callStateTopic(prefix, callID string) string {
+	return fmt.Sprintf("%s/call/%s/state", prefix, callID)
+}
+
+// isCallStateTopic reports whether topic is a call's state topic.
+func isCallStateTopic(prefix, topic string) bool {
+	id, ok := strings.CutPrefix(topic, prefix+"/call/")
+	if !ok {
+		return false
+	}
+	id, ok = strings.CutSuffix(id, "/state")
+	return ok && id != "" && !strings.Contains(id, "/")
+}
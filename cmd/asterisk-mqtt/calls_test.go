@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishActiveCallsRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	since := time.Unix(1770888509, 0)
+	calls := []correlator.ActiveCall{{
+		CallID: "1770888509.40",
+		From:   correlator.Endpoint{Extension: "1986", Name: "Martin"},
+		To:     correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+		State:  correlator.StateAnswered,
+		Since:  since,
+	}}
+	publishCallSnapshots(context.Background(), mock, "asterisk", calls, nil, false, since)
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 || msgs[0].Topic != "asterisk/calls/active" || !msgs[0].Retained {
+		t.Fatalf("expected 1 retained message on asterisk/calls/active, got %+v", msgs)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "description", "1 call is in progress")
+	assertPayloadField(t, p, "timestamp", "2026-02-12T09:28:29Z")
+	list := p["calls"].([]any)
+	if p["count"] != 1.0 || len(list) != 1 {
+		t.Fatalf("expected 1 call, got %v", p)
+	}
+	call := list[0].(map[string]any)
+	assertPayloadField(t, call, "call_id", "1770888509.40")
+	assertPayloadField(t, call, "state", "answered")
+	assertPayloadField(t, call, "since", "2026-02-12T09:28:29Z")
+	if from := call["from"].(map[string]any); from["extension"] != "1986" {
+		t.Errorf("expected from 1986, got %v", from)
+	}
+}
+
+func TestPublishActiveCallsEmpty(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	publishCallSnapshots(context.Background(), mock, "asterisk", nil, nil, true, time.Now())
+
+	p := parsePayload(t, mock.Retained()["asterisk/calls/active"])
+	assertPayloadField(t, p, "description", "No calls are in progress")
+	if calls, ok := p["calls"].([]any); !ok || len(calls) != 0 {
+		t.Errorf("expected an empty calls list, got %v", p["calls"])
+	}
+}
+
+func TestCallStateTopics(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	now := time.Unix(1770888509, 0)
+	call := correlator.ActiveCall{CallID: "a.1", State: correlator.StateRinging, Since: now}
+
+	ringing := []correlator.CallStateChange{
+		{State: correlator.StateRinging, CallID: "a.1"},
+		{State: correlator.StateLeg, CallID: "a.1"},
+	}
+	publishCallSnapshots(context.Background(), mock, "asterisk", []correlator.ActiveCall{call}, ringing, true, now)
+
+	retained := mock.Retained()
+	p := parsePayload(t, retained["asterisk/call/a.1/state"])
+	assertPayloadField(t, p, "state", "ringing")
+	if n := len(mock.Messages()); n != 2 {
+		t.Errorf("expected calls/active and one state message, got %d", n)
+	}
+
+	hungup := []correlator.CallStateChange{{State: correlator.StateHungUp, CallID: "a.1"}}
+	publishCallSnapshots(context.Background(), mock, "asterisk", nil, hungup, true, now)
+
+	msgs := mock.Messages()
+	last := msgs[len(msgs)-1]
+	if last.Topic != "asterisk/call/a.1/state" || !last.Retained || len(last.Payload) != 0 {
+		t.Errorf("expected the state topic cleared with an empty retained message, got %+v", last)
+	}
+	if _, ok := mock.Retained()["asterisk/call/a.1/state"]; ok {
+		t.Error("expected no retained state after hangup")
+	}
+}
+
+func TestCallStateTopicsDisabled(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	changes := []correlator.CallStateChange{{State: correlator.StateHungUp, CallID: "a.1"}}
+	publishCallSnapshots(context.Background(), mock, "asterisk", nil, changes, false, time.Now())
+
+	if msgs := mock.Messages(); len(msgs) != 1 || msgs[0].Topic != "asterisk/calls/active" {
+		t.Errorf("expected only calls/active without state topics, got %+v", msgs)
+	}
+}
+
+func TestClearStaleCallStates(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	ctx := context.Background()
+	// Left by a previous run: a.1 is still up, b.1 ended while we were down
+	for _, topic := range []string{"asterisk/call/a.1/state", "asterisk/call/b.1/state", "asterisk/calls/active"} {
+		mock.PublishRetained(ctx, topic, []byte(`{}`))
+	}
+
+	calls := []correlator.ActiveCall{{CallID: "a.1", State: correlator.StateAnswered}}
+	if err := clearStaleCallStates(ctx, mock, mock, "asterisk", calls); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	retained := mock.Retained()
+	if _, ok := retained["asterisk/call/b.1/state"]; ok {
+		t.Error("expected the stale state of b.1 cleared")
+	}
+	if _, ok := retained["asterisk/call/a.1/state"]; !ok {
+		t.Error("expected the state of a.1, still in progress, kept")
+	}
+	if _, ok := retained["asterisk/calls/active"]; !ok {
+		t.Error("expected calls/active left alone")
+	}
+}
+
+func TestIsCallStateTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"asterisk/call/1770888600.50/state", true},
+		{"asterisk/call//state", false},
+		{"asterisk/call/1770888600.50/event", false},
+		{"asterisk/calls/active", false},
+		{"other/call/1770888600.50/state", false},
+	}
+	for _, tt := range tests {
+		if got := isCallStateTopic("asterisk", tt.topic); got != tt.want {
+			t.Errorf("isCallStateTopic(%q) = %v, want %v", tt.topic, got, tt.want)
+		}
+	}
+}
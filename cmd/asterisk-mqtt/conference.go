@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/conference"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
+)
+
+// conferencePayload is the retained JSON published for each room.
+type conferencePayload struct {
+	Conference   string        `json:"conference"`
+	Description  string        `json:"description"`
+	Active       bool          `json:"active"`
+	Started      string        `json:"started,omitempty"`
+	Count        int           `json:"participant_count"`
+	Participants []participant `json:"participants"`
+	Timestamp    string        `json:"timestamp"`
+}
+
+// conferenceEventPayload is the JSON published when someone joins or
+// leaves a room.
+type conferenceEventPayload struct {
+	Event       string      `json:"event"`
+	Description string      `json:"description"`
+	Conference  string      `json:"conference"`
+	Participant participant `json:"participant"`
+	Count       int         `json:"participant_count"`
+	Timestamp   string      `json:"timestamp"`
+}
+
+type participant struct {
+	Extension string `json:"extension"`
+	Name      string `json:"name,omitempty"`
+	Admin     bool   `json:"admin"`
+	Muted     bool   `json:"muted"`
+	Talking   bool   `json:"talking"`
+	Joined    string `json:"joined"`
+}
+
+var conferenceEventDescriptions = map[conference.EventType]string{
+	conference.EventJoined: "A participant joined the conference",
+	conference.EventLeft:   "A participant left the conference",
+}
+
+// syncConferences seeds the tracker with the participants of every active
+// room. ConfbridgeListRooms answers with an error when no room is active,
+// so rooms the tracker knew are then reported ended.
+func syncConferences(ctx context.Context, client *ami.Client, tracker *conference.Tracker, pub publisher.Publisher, prefix string) {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var lists []ami.Response
+	rooms, err := client.Send(listCtx, ami.NewAction("ConfbridgeListRooms"))
+	var respErr *ami.ResponseError
+	if err != nil && !(errors.As(err, &respErr) && strings.HasPrefix(respErr.Message, "No active conferences")) {
+		log.Printf("conference sync unavailable: %v", err)
+		return
+	}
+	for _, room := range rooms.Events {
+		name := room.Get("Conference")
+		if room.Type() != "ConfbridgeListRooms" || name == "" {
+			continue
+		}
+		resp, err := client.Send(listCtx, ami.NewAction("ConfbridgeList", "Conference", name))
+		if err != nil {
+			log.Printf("conference sync: listing %s: %v", name, err)
+			continue
+		}
+		lists = append(lists, resp)
+	}
+	publishConferences(ctx, pub, prefix, tracker.Seed(lists), nil)
+}
+
+// publishConferences publishes each room as the retained value of its
+// topic, followed by the joins and leaves, logging rather than returning
+// failures.
+func publishConferences(ctx context.Context, pub publisher.Publisher, prefix string, rooms []conference.Room, events []conference.Event) {
+	for _, r := range rooms {
+		if err := publishConferenceRoom(ctx, pub, prefix, r); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+	for _, e := range events {
+		if err := publishConferenceEvent(ctx, pub, prefix, e); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishConferenceRoom(ctx context.Context, pub publisher.Publisher, prefix string, r conference.Room) error {
+	name := fmt.Sprintf("%s/conference/%s/state", prefix, topic.Level(r.Name))
+
+	payload := conferencePayload{
+		Conference:   r.Name,
+		Description:  "The conference is empty",
+		Active:       len(r.Participants) > 0,
+		Count:        len(r.Participants),
+		Participants: []participant{},
+		Timestamp:    r.Timestamp.UTC().Format(time.RFC3339),
+	}
+	switch n := len(r.Participants); {
+	case n == 1:
+		payload.Description = "1 participant is in the conference"
+	case n > 1:
+		payload.Description = fmt.Sprintf("%d participants are in the conference", n)
+	}
+	if !r.Started.IsZero() {
+		payload.Started = r.Started.UTC().Format(time.RFC3339)
+	}
+	for _, p := range r.Participants {
+		payload.Participants = append(payload.Participants, toParticipant(p))
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.PublishRetained(ctx, name, data)
+}
+
+func publishConferenceEvent(ctx context.Context, pub publisher.Publisher, prefix string, e conference.Event) error {
+	name := fmt.Sprintf("%s/conference/%s/%s", prefix, topic.Level(e.Room), e.Type)
+
+	data, err := json.Marshal(conferenceEventPayload{
+		Event:       string(e.Type),
+		Description: conferenceEventDescriptions[e.Type],
+		Conference:  e.Room,
+		Participant: toParticipant(e.Participant),
+		Count:       e.Count,
+		Timestamp:   e.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.Publish(ctx, name, data)
+}
+
+func toParticipant(p conference.Participant) participant {
+	return participant{
+		Extension: p.Extension,
+		Name:      p.Name,
+		Admin:     p.Admin,
+		Muted:     p.Muted,
+		Talking:   p.Talking,
+		Joined:    p.JoinedAt.UTC().Format(time.RFC3339),
+	}
+}
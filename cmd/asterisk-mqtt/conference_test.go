@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/conference"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishConferenceRoomRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	r := conference.Room{
+		Name:    "1000",
+		Started: time.Unix(1770888500, 0),
+		Participants: []conference.Participant{
+			{ID: "c.1", Extension: "21", Name: "Kitchen", Talking: true, JoinedAt: time.Unix(1770888501, 0)},
+			{ID: "c.2", Extension: "1986", Name: "Martin", Admin: true, Muted: true, JoinedAt: time.Unix(1770888509, 0)},
+		},
+		Timestamp: time.Unix(1770888509, 0),
+	}
+	if err := publishConferenceRoom(context.Background(), mock, "asterisk", r); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/conference/1000/state" || !msgs[0].Retained {
+		t.Errorf("expected retained asterisk/conference/1000/state, got %q retained=%v", msgs[0].Topic, msgs[0].Retained)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "description", "2 participants are in the conference")
+	assertPayloadField(t, p, "started", "2026-02-12T09:28:20Z")
+	if p["active"] != true || p["participant_count"] != 2.0 {
+		t.Errorf("unexpected room summary %v", p)
+	}
+	parts, ok := p["participants"].([]any)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("expected 2 participants, got %v", p["participants"])
+	}
+	first := parts[0].(map[string]any)
+	if first["extension"] != "21" || first["talking"] != true || first["muted"] != false {
+		t.Errorf("unexpected participant %v", first)
+	}
+	assertPayloadField(t, first, "joined", "2026-02-12T09:28:21Z")
+}
+
+func TestPublishEmptyConferenceRoom(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	if err := publishConferenceRoom(context.Background(), mock, "asterisk", conference.Room{Name: "1000"}); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+	p := parsePayload(t, mock.Messages()[0].Payload)
+	if p["active"] != false {
+		t.Errorf("expected inactive room, got %v", p["active"])
+	}
+	if parts, ok := p["participants"].([]any); !ok || len(parts) != 0 {
+		t.Errorf("expected an empty participants list, got %v", p["participants"])
+	}
+	if _, ok := p["started"]; ok {
+		t.Error("empty room should not carry started")
+	}
+}
+
+func TestPublishConferenceEvent(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	e := conference.Event{
+		Type:        conference.EventJoined,
+		Room:        "1000",
+		Participant: conference.Participant{ID: "c.1", Extension: "21", Name: "Kitchen"},
+		Count:       1,
+	}
+	if err := publishConferenceEvent(context.Background(), mock, "asterisk", e); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if msgs[0].Topic != "asterisk/conference/1000/joined" || msgs[0].Retained {
+		t.Errorf("expected non-retained asterisk/conference/1000/joined, got %q retained=%v", msgs[0].Topic, msgs[0].Retained)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "event", "joined")
+	assertPayloadField(t, p, "description", "A participant joined the conference")
+	if part, ok := p["participant"].(map[string]any); !ok || part["extension"] != "21" {
+		t.Errorf("expected participant 21, got %v", p["participant"])
+	}
+}
+
+func TestSyncConferences(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		switch action.Get("Action") {
+		case "ConfbridgeListRooms":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "ConfbridgeListRooms", "ActionID", id, "Conference", "1000", "Parties", "1"},
+				{"Event", "ConfbridgeListRoomsComplete", "ActionID", id, "EventList", "Complete", "ListItems", "1"},
+			}
+		case "ConfbridgeList":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "ConfbridgeList", "ActionID", id, "Conference", action.Get("Conference"), "Uniqueid", "c.1",
+					"CallerIDNum", "21", "CallerIDName", "Kitchen", "Admin", "No", "Muted", "No"},
+				{"Event", "ConfbridgeListComplete", "ActionID", id, "EventList", "Complete", "ListItems", "1"},
+			}
+		}
+		return nil
+	})
+
+	mock := publisher.NewMockPublisher()
+	syncConferences(context.Background(), client, conference.NewTracker(), mock, "asterisk")
+
+	retained := mock.Retained()
+	if len(retained) != 1 {
+		t.Fatalf("expected 1 retained room, got %d", len(retained))
+	}
+	p := parsePayload(t, retained["asterisk/conference/1000/state"])
+	if p["participant_count"] != 1.0 {
+		t.Errorf("expected 1 participant, got %v", p["participant_count"])
+	}
+}
+
+func TestSyncConferencesEndsRoomsWhenNoneActive(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		return [][]string{{"Response", "Error", "ActionID", action.Get("ActionID"), "Message", "No active conferences."}}
+	})
+
+	tracker := conference.NewTracker()
+	tracker.Process(ami.NewEvent("Event", "ConfBridgeJoin", "Conference", "1000", "Uniqueid", "c.1", "CallerIDNum", "21"))
+
+	mock := publisher.NewMockPublisher()
+	syncConferences(context.Background(), client, tracker, mock, "asterisk")
+
+	p := parsePayload(t, mock.Retained()["asterisk/conference/1000/state"])
+	if p["active"] != false {
+		t.Errorf("expected room 1000 to be reported ended, got %v", p)
+	}
+}
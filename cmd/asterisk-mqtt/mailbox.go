@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/mailbox"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
+)
+
+// mailboxPayload is the retained JSON published for each mailbox.
+type mailboxPayload struct {
+	Mailbox     string `json:"mailbox"`
+	Description string `json:"description"`
+	Waiting     bool   `json:"waiting"`
+	New         int    `json:"new_messages"`
+	Old         int    `json:"old_messages"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// syncMailboxes seeds the tracker with the message counts of every
+// voicemail box, since MessageWaiting is only sent when a count changes.
+// A mailbox that cannot be counted is logged and skipped.
+func syncMailboxes(ctx context.Context, client *ami.Client, mwi *mailbox.Tracker, pub publisher.Publisher, prefix string) error {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	resp, err := client.Send(listCtx, ami.NewAction("VoicemailUsersList"))
+	cancel()
+	if err != nil {
+		return fmt.Errorf("listing mailboxes: %w", err)
+	}
+
+	mailboxes := mailbox.Mailboxes(resp)
+	synced := 0
+	for _, mb := range mailboxes {
+		countCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		countResp, err := client.Send(countCtx, ami.NewAction("MailboxCount", "Mailbox", mb))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("mailbox sync: counting messages in %s: %v", mb, err)
+			continue
+		}
+		publishMailboxes(ctx, pub, prefix, mwi.Count(countResp))
+		synced++
+	}
+	log.Printf("synced %d of %d mailboxes", synced, len(mailboxes))
+	return nil
+}
+
+// publishMailboxes publishes each mailbox status as the retained value of
+// its topic, logging rather than returning failures.
+func publishMailboxes(ctx context.Context, pub publisher.Publisher, prefix string, statuses []mailbox.Status) {
+	for _, s := range statuses {
+		if err := publishMailbox(ctx, pub, prefix, s); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishMailbox(ctx context.Context, pub publisher.Publisher, prefix string, s mailbox.Status) error {
+	name := fmt.Sprintf("%s/mailbox/%s", prefix, topic.Level(s.Mailbox))
+
+	description := "No new voicemail messages"
+	if s.Waiting() {
+		description = "New voicemail messages are waiting"
+	}
+	data, err := json.Marshal(mailboxPayload{
+		Mailbox:     s.Mailbox,
+		Description: description,
+		Waiting:     s.Waiting(),
+		New:         s.New,
+		Old:         s.Old,
+		Timestamp:   s.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.PublishRetained(ctx, name, data)
+}
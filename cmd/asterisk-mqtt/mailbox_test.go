@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/mailbox"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishMailboxRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	s := mailbox.Status{Mailbox: "21@default", New: 2, Old: 1, Timestamp: time.Unix(1770888509, 0)}
+	if err := publishMailbox(context.Background(), mock, "asterisk", s); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/mailbox/21@default" {
+		t.Errorf("unexpected topic %q", msgs[0].Topic)
+	}
+	if !msgs[0].Retained {
+		t.Error("expected mailbox status to be retained")
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "mailbox", "21@default")
+	assertPayloadField(t, p, "description", "New voicemail messages are waiting")
+	if p["waiting"] != true || p["new_messages"] != 2.0 || p["old_messages"] != 1.0 {
+		t.Errorf("unexpected counts in %v", p)
+	}
+	assertPayloadField(t, p, "timestamp", "2026-02-12T09:28:29Z")
+}
+
+// servedClient returns an AMI client whose actions are answered with the
+// replies fn returns, each a list of header key-value pairs per message.
+func servedClient(t *testing.T, fn func(action ami.Event) [][]string) *ami.Client {
+	t.Helper()
+	conn, client := net.Pipe()
+	t.Cleanup(func() {
+		conn.Close()
+		client.Close()
+	})
+	go func() {
+		conn.Write([]byte("Asterisk Call Manager/5.0.1\r\n"))
+		parser := ami.NewParser(bufio.NewReader(conn))
+		for {
+			action, ok := parser.Next()
+			if !ok {
+				return
+			}
+			for _, msg := range fn(action) {
+				var s string
+				for i := 0; i+1 < len(msg); i += 2 {
+					s += fmt.Sprintf("%s: %s\r\n", msg[i], msg[i+1])
+				}
+				conn.Write([]byte(s + "\r\n"))
+			}
+		}
+	}()
+
+	c, err := ami.NewClient(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSyncMailboxes(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		switch action.Get("Action") {
+		case "VoicemailUsersList":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "VoicemailUserEntry", "ActionID", id, "VMContext", "default", "VoiceMailbox", "21"},
+				{"Event", "VoicemailUserEntry", "ActionID", id, "VMContext", "default", "VoiceMailbox", "1986"},
+				{"Event", "VoicemailUserListComplete", "ActionID", id, "EventList", "Complete", "ListItems", "2"},
+			}
+		case "MailboxCount":
+			mb := action.Get("Mailbox")
+			newMsgs := "0"
+			if mb == "21@default" {
+				newMsgs = "3"
+			}
+			return [][]string{{"Response", "Success", "ActionID", id, "Mailbox", mb,
+				"UrgMessages", "0", "NewMessages", newMsgs, "OldMessages", "1"}}
+		}
+		return [][]string{{"Response", "Error", "ActionID", id, "Message", "Invalid/unknown command"}}
+	})
+
+	mock := publisher.NewMockPublisher()
+	if err := syncMailboxes(context.Background(), client, mailbox.NewTracker(), mock, "asterisk"); err != nil {
+		t.Fatalf("sync error: %v", err)
+	}
+
+	retained := mock.Retained()
+	if len(retained) != 2 {
+		t.Fatalf("expected 2 retained mailboxes, got %d", len(retained))
+	}
+	kitchen := parsePayload(t, retained["asterisk/mailbox/21@default"])
+	if kitchen["new_messages"] != 3.0 || kitchen["waiting"] != true {
+		t.Errorf("unexpected 21@default status %v", kitchen)
+	}
+	martin := parsePayload(t, retained["asterisk/mailbox/1986@default"])
+	if martin["new_messages"] != 0.0 || martin["waiting"] != false {
+		t.Errorf("unexpected 1986@default status %v", martin)
+	}
+}
+
+func TestSyncMailboxesSkipsFailedCount(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		switch action.Get("Action") {
+		case "VoicemailUsersList":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "VoicemailUserEntry", "ActionID", id, "VMContext", "default", "VoiceMailbox", "21"},
+				{"Event", "VoicemailUserEntry", "ActionID", id, "VMContext", "default", "VoiceMailbox", "1986"},
+				{"Event", "VoicemailUserListComplete", "ActionID", id, "EventList", "Complete", "ListItems", "2"},
+			}
+		case "MailboxCount":
+			mb := action.Get("Mailbox")
+			if mb == "21@default" {
+				return [][]string{{"Response", "Error", "ActionID", id, "Message", "Mailbox not found"}}
+			}
+			return [][]string{{"Response", "Success", "ActionID", id, "Mailbox", mb,
+				"UrgMessages", "0", "NewMessages", "2", "OldMessages", "0"}}
+		}
+		return [][]string{{"Response", "Error", "ActionID", id, "Message", "Invalid/unknown command"}}
+	})
+
+	mock := publisher.NewMockPublisher()
+	if err := syncMailboxes(context.Background(), client, mailbox.NewTracker(), mock, "asterisk"); err != nil {
+		t.Fatalf("sync error: %v", err)
+	}
+
+	retained := mock.Retained()
+	if len(retained) != 1 {
+		t.Fatalf("expected 1 retained mailbox, got %d", len(retained))
+	}
+	martin := parsePayload(t, retained["asterisk/mailbox/1986@default"])
+	if martin["new_messages"] != 2.0 {
+		t.Errorf("unexpected 1986@default status %v", martin)
+	}
+}
@@ -1,25 +1,37 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/conference"
 	"github.com/sweeney/asterisk-mqtt/internal/config"
 	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+	"github.com/sweeney/asterisk-mqtt/internal/mailbox"
+	"github.com/sweeney/asterisk-mqtt/internal/parking"
+	"github.com/sweeney/asterisk-mqtt/internal/presence"
 	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/queue"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
 )
 
+// exitAuthFailed is the exit status used when AMI rejects our credentials.
+// The systemd unit lists it in RestartPreventExitStatus.
+const exitAuthFailed = 78
+
+// reapInterval is how often the correlator is checked for calls that have
+// outlived calls.max_ringing or calls.max_answered.
+const reapInterval = 30 * time.Second
+
 func main() {
 	configPath := flag.String("config", "/etc/asterisk-mqtt/asterisk-mqtt.yaml", "Path to config file")
 	flag.Parse()
@@ -41,31 +53,164 @@ func main() {
 		cancel()
 	}()
 
-	pub, err := publisher.NewMQTTPublisher(publisher.MQTTOptions{
+	mqttPub, err := publisher.NewMQTTPublisher(publisher.MQTTOptions{
 		Broker:   cfg.MQTT.Broker,
 		ClientID: cfg.MQTT.ClientID,
 		QoS:      1,
+		Username: cfg.MQTT.Username,
+		Password: cfg.MQTT.Password,
+		TLS: publisher.TLSOptions{
+			CAFile:             cfg.MQTT.TLS.CAFile,
+			CertFile:           cfg.MQTT.TLS.CertFile,
+			KeyFile:            cfg.MQTT.TLS.KeyFile,
+			InsecureSkipVerify: cfg.MQTT.TLS.InsecureSkipVerify,
+		},
+
+		StatusTopic:    statusTopic(cfg.MQTT.TopicPrefix),
+		OfflinePayload: offlineStatus(),
 	})
 	if err != nil {
 		log.Fatalf("connecting to MQTT: %v", err)
 	}
+
+	if mqttPub.Connected() {
+		log.Printf("connected to MQTT broker %s", cfg.MQTT.Broker)
+	} else {
+		log.Printf("MQTT broker %s unreachable, queuing messages until it is back", cfg.MQTT.Broker)
+	}
+
+	// Queue messages rather than lose them while the broker is unreachable
+	pub, err := publisher.NewBuffer(mqttPub, publisher.BufferOptions{
+		Size:     cfg.MQTT.BufferSize,
+		SpoolDir: cfg.MQTT.SpoolDir,
+		Timeout:  cfg.MQTT.PublishTimeout,
+		// A previous run's call states are cleared after the first resync,
+		// and replaying them later would bring back calls that have ended
+		SkipReplayed: func(msg publisher.Message) bool {
+			return msg.Retained && isCallStateTopic(cfg.MQTT.TopicPrefix, msg.Topic)
+		},
+	})
+	if err != nil {
+		mqttPub.Close()
+		log.Fatalf("opening publish buffer: %v", err)
+	}
 	defer pub.Close()
+	if n := pub.Depth(); n > 0 {
+		log.Printf("replaying %d spooled messages", n)
+	}
+	go reportBacklog(ctx, pub)
 
-	log.Printf("connected to MQTT broker %s", cfg.MQTT.Broker)
+	if err := publishStatus(ctx, pub, cfg.MQTT.TopicPrefix, false, "", time.Now()); err != nil {
+		log.Printf("publish error: %v", err)
+	}
 
-	if err := run(ctx, cfg, pub); err != nil && ctx.Err() == nil {
+	if err := run(ctx, cfg, pub, mqttPub); err != nil && ctx.Err() == nil {
+		var authErr *ami.AuthError
+		if errors.As(err, &authErr) {
+			// Distinct exit status so systemd doesn't restart us into the same failure
+			pub.Close()
+			log.Printf("error: %v", err)
+			os.Exit(exitAuthFailed)
+		}
 		log.Fatalf("error: %v", err)
 	}
 
 	log.Println("shutdown complete")
 }
 
-func run(ctx context.Context, cfg *config.Config, pub publisher.Publisher) error {
+// backlogInterval is how often a backlog of unpublished messages is logged.
+const backlogInterval = time.Minute
+
+// reportBacklog logs the publish buffer's depth while messages are waiting
+// for the broker, and when the backlog clears.
+func reportBacklog(ctx context.Context, buf *publisher.Buffer) {
+	ticker := time.NewTicker(backlogInterval)
+	defer ticker.Stop()
+
+	backlog := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		switch depth := buf.Depth(); {
+		case depth > 0:
+			backlog = true
+			log.Printf("%d messages waiting for the MQTT broker (%d dropped)", depth, buf.Dropped())
+		case backlog:
+			backlog = false
+			log.Printf("MQTT backlog cleared")
+		}
+	}
+}
+
+// trackers holds the state built from AMI events. It outlives individual
+// AMI sessions so that calls in flight across a reconnect can be
+// reconciled rather than forgotten, and unchanged state isn't republished.
+type trackers struct {
+	corr     *correlator.Correlator
+	mwi      *mailbox.Tracker
+	presence *presence.Tracker
+	queues   *queue.Tracker
+	rooms    *conference.Tracker
+	parking  *parking.Tracker
+
+	banner       string // AMI banner of the current or last session
+	amiConnected bool   // as last published on the status topic
+
+	lister      publisher.RetainedLister // reads back retained call states
+	statesSwept bool                     // stale call states left by a previous run cleared
+}
+
+func run(ctx context.Context, cfg *config.Config, pub publisher.Publisher, lister publisher.RetainedLister) error {
+	// Validated when the config was loaded
+	router, err := topic.NewRouter(cfg.MQTT.TopicPrefix, cfg.Calls.Routes())
+	if err != nil {
+		return err
+	}
+
+	corr := correlator.NewWithOptions(
+		correlator.WithMaxRinging(cfg.Calls.MaxRinging),
+		correlator.WithMaxAnswered(cfg.Calls.MaxAnswered),
+		correlator.WithLegEvents(cfg.Calls.LegEvents),
+		correlator.WithIdentityUpdates(cfg.Calls.IdentityUpdates),
+		correlator.WithCauseDescriptions(cfg.Calls.CauseDescriptions),
+		correlator.WithDecisionHook(func(d correlator.Decision) {
+			log.Printf("call %s: %s (%s)", d.CallID, d.Action, d.Reason)
+		}),
+	)
+
+	t := &trackers{
+		corr:     corr,
+		mwi:      mailbox.NewTracker(),
+		presence: presence.NewTracker(),
+		queues:   queue.NewTracker(),
+		rooms:    conference.NewTracker(),
+		parking:  parking.NewTracker(),
+		lister:   lister,
+	}
+
 	for {
-		err := runSession(ctx, cfg, pub)
+		err := runSession(ctx, cfg, pub, t, router)
 		if ctx.Err() != nil {
 			return nil
 		}
+		corr.SessionEnded()
+		if t.amiConnected {
+			t.amiConnected = false
+			if err := publishStatus(ctx, pub, cfg.MQTT.TopicPrefix, false, t.banner, time.Now()); err != nil {
+				log.Printf("publish error: %v", err)
+			}
+		}
+		if n := corr.ActiveCalls(); n > 0 {
+			log.Printf("AMI session ended with %d active calls, holding them until reconnect", n)
+		}
+		// Rejected credentials won't fix themselves; stop rather than retry
+		var authErr *ami.AuthError
+		if errors.As(err, &authErr) {
+			return err
+		}
 		if err != nil {
 			log.Printf("AMI session error: %v, reconnecting in 5s", err)
 			select {
@@ -77,75 +222,180 @@ func run(ctx context.Context, cfg *config.Config, pub publisher.Publisher) error
 	}
 }
 
-func runSession(ctx context.Context, cfg *config.Config, pub publisher.Publisher) error {
+func runSession(ctx context.Context, cfg *config.Config, pub publisher.Publisher, t *trackers, router *topic.Router) error {
+	prefix := cfg.MQTT.TopicPrefix
+
 	addr := cfg.AMI.Addr()
 	log.Printf("connecting to AMI at %s", addr)
 
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	dialCtx, cancelDial := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelDial()
+
+	client, err := ami.Dial(dialCtx, addr)
 	if err != nil {
-		return fmt.Errorf("dial AMI: %w", err)
+		return err
 	}
-	defer conn.Close()
+	defer client.Close()
 
 	// Close connection when context is cancelled
 	go func() {
 		<-ctx.Done()
-		conn.Close()
+		client.Close()
 	}()
 
-	reader := bufio.NewReader(conn)
+	log.Printf("AMI banner: %s", client.Banner())
 
-	// Read banner
-	banner, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("reading AMI banner: %w", err)
+	if err := client.Login(dialCtx, cfg.AMI.Username, cfg.AMI.Secret); err != nil {
+		return err
 	}
-	log.Printf("AMI banner: %s", strings.TrimSpace(banner))
 
-	// Login
-	loginCmd := fmt.Sprintf("Action: Login\r\nUsername: %s\r\nSecret: %s\r\n\r\n", cfg.AMI.Username, cfg.AMI.Secret)
-	if _, err := conn.Write([]byte(loginCmd)); err != nil {
-		return fmt.Errorf("sending login: %w", err)
+	log.Printf("AMI authenticated (protocol %s)", client.Version())
+	t.banner = client.Banner()
+	t.amiConnected = true
+	if err := publishStatus(ctx, pub, prefix, true, t.banner, time.Now()); err != nil {
+		log.Printf("publish error: %v", err)
 	}
 
-	log.Println("AMI authenticated, processing events")
+	if err := resync(ctx, client, t.corr, pub, router, cfg.Calls.StateTopics); err != nil {
+		// Without a channel list, held calls are settled by FullyBooted
+		// and by the events that follow.
+		log.Printf("resync unavailable: %v", err)
+	} else if cfg.Calls.StateTopics && !t.statesSwept {
+		// Once the calls in progress are known, any other retained state
+		// was left by a previous run. Tried again next session on failure.
+		if err := clearStaleCallStates(ctx, t.lister, pub, prefix, t.corr.Calls()); err != nil {
+			log.Printf("clearing stale call states: %v", err)
+		} else {
+			t.statesSwept = true
+		}
+	}
+	if err := syncMailboxes(ctx, client, t.mwi, pub, prefix); err != nil {
+		// MessageWaiting events still keep mailboxes current as they change.
+		log.Printf("mailbox sync unavailable: %v", err)
+	}
+	syncPresence(ctx, client, t.presence, pub, prefix)
+	syncQueues(ctx, client, t.queues, pub, prefix)
+	syncConferences(ctx, client, t.rooms, pub, prefix)
+	syncParking(ctx, client, t.parking, pub, prefix)
 
-	// Process events
-	parser := ami.NewParser(reader)
-	corr := correlator.New()
+	log.Println("processing events")
 
-	for {
-		evt, ok := parser.Next()
-		if !ok {
-			if ctx.Err() != nil {
-				return nil
+	// Pump events into a channel so the trackers, which are not safe for
+	// concurrent use, can be driven by events and the reaper from one loop.
+	events := make(chan ami.Event)
+	go func() {
+		defer close(events)
+		for {
+			evt, ok := client.Next()
+			if !ok {
+				return
+			}
+			select {
+			case events <- evt:
+			case <-ctx.Done():
+				return
 			}
-			return fmt.Errorf("AMI connection closed")
 		}
+	}()
 
-		changes := corr.Process(evt)
-		for _, change := range changes {
-			if err := publishChange(ctx, pub, cfg.MQTT.TopicPrefix, change); err != nil {
-				log.Printf("publish error: %v", err)
+	reap := time.NewTicker(reapInterval)
+	defer reap.Stop()
+
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("AMI connection closed")
 			}
+			publishCalls(ctx, pub, router, t.corr, t.corr.Process(evt), cfg.Calls.StateTopics)
+			publishMailboxes(ctx, pub, prefix, t.mwi.Process(evt))
+			publishPresence(ctx, pub, prefix, t.presence.Process(evt))
+			publishQueues(ctx, pub, prefix, t.queues.Process(evt))
+			rooms, joins := t.rooms.Process(evt)
+			publishConferences(ctx, pub, prefix, rooms, joins)
+			publishParking(ctx, pub, prefix, t.parking.Process(evt))
+		case <-reap.C:
+			publishCalls(ctx, pub, router, t.corr, t.corr.Reap(), cfg.Calls.StateTopics)
+		}
+	}
+}
+
+// resync reconciles the correlator with the channels Asterisk currently has
+// up, so calls that started or ended while we were disconnected are reported.
+// The call snapshots are republished even if nothing changed, replacing any
+// left retained by a previous run.
+func resync(ctx context.Context, client *ami.Client, corr *correlator.Correlator, pub publisher.Publisher, router *topic.Router, stateTopics bool) error {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := client.Send(listCtx, ami.NewAction("CoreShowChannels"))
+	if err != nil {
+		return fmt.Errorf("listing channels: %w", err)
+	}
+
+	changes := corr.Resync(resp.Events)
+	log.Printf("resynced %d channels, %d active calls, %d changes", len(resp.Events), corr.ActiveCalls(), len(changes))
+	publishChanges(ctx, pub, router, changes)
+	publishCallSnapshots(ctx, pub, router.Prefix(), corr.Calls(), changes, stateTopics, time.Now())
+	return nil
+}
+
+// publishCalls publishes changes and, if there are any, the call snapshots
+// they affect.
+func publishCalls(ctx context.Context, pub publisher.Publisher, router *topic.Router, corr *correlator.Correlator, changes []correlator.CallStateChange, stateTopics bool) {
+	if len(changes) == 0 {
+		return
+	}
+	publishChanges(ctx, pub, router, changes)
+	publishCallSnapshots(ctx, pub, router.Prefix(), corr.Calls(), changes, stateTopics, changes[len(changes)-1].Timestamp)
+}
+
+// publishChanges publishes each change, logging rather than returning
+// failures so one bad publish doesn't stall the event loop.
+func publishChanges(ctx context.Context, pub publisher.Publisher, router *topic.Router, changes []correlator.CallStateChange) {
+	for _, change := range changes {
+		if err := publishChange(ctx, pub, router, change); err != nil {
+			log.Printf("publish error: %v", err)
 		}
 	}
 }
 
 // mqttPayload is the JSON structure published to MQTT.
 type mqttPayload struct {
-	Event            string   `json:"event"`
-	Description      string   `json:"description"`
-	CallID           string   `json:"call_id"`
-	From             endpoint `json:"from"`
-	To               endpoint `json:"to"`
-	Timestamp        string   `json:"timestamp"`
-	RingDuration     *float64 `json:"ring_duration_seconds,omitempty"`
-	Cause            string   `json:"cause,omitempty"`
-	CauseDescription string   `json:"cause_description,omitempty"`
-	CauseCode        *int     `json:"cause_code,omitempty"`
-	TalkDuration     *float64 `json:"talk_duration_seconds,omitempty"`
-	TotalDuration    *float64 `json:"total_duration_seconds,omitempty"`
+	Event            string     `json:"event"`
+	Description      string     `json:"description"`
+	CallID           string     `json:"call_id"`
+	From             endpoint   `json:"from"`
+	To               endpoint   `json:"to"`
+	Timestamp        string     `json:"timestamp"`
+	RingDuration     *float64   `json:"ring_duration_seconds,omitempty"`
+	AnsweredBy       *endpoint  `json:"answered_by,omitempty"`
+	MissedBy         []endpoint `json:"missed_by,omitempty"`
+	PickedUpBy       *endpoint  `json:"picked_up_by,omitempty"`
+	Mailbox          string     `json:"mailbox,omitempty"`
+	Queue            string     `json:"queue,omitempty"`
+	QueuePosition    *int       `json:"queue_position,omitempty"`
+	QueueWait        *float64   `json:"queue_wait_seconds,omitempty"`
+	Agent            *endpoint  `json:"agent,omitempty"`
+	ParkingLot       string     `json:"parking_lot,omitempty"`
+	ParkingSlot      string     `json:"parking_slot,omitempty"`
+	UnparkReason     string     `json:"unpark_reason,omitempty"`
+	RetrievedBy      *endpoint  `json:"retrieved_by,omitempty"`
+	Leg              *leg       `json:"leg,omitempty"`
+	TransferType     string     `json:"transfer_type,omitempty"`
+	TransferredBy    *endpoint  `json:"transferred_by,omitempty"`
+	Outcome          string     `json:"outcome,omitempty"`
+	Cause            string     `json:"cause,omitempty"`
+	CauseDescription string     `json:"cause_description,omitempty"`
+	CauseCategory    string     `json:"cause_category,omitempty"`
+	CauseCode        *int       `json:"cause_code,omitempty"`
+	TalkDuration     *float64   `json:"talk_duration_seconds,omitempty"`
+	TotalDuration    *float64   `json:"total_duration_seconds,omitempty"`
+	HoldDuration     *float64   `json:"hold_duration_seconds,omitempty"`
+	HoldCount        *int       `json:"hold_count,omitempty"`
 }
 
 type endpoint struct {
@@ -153,14 +403,73 @@ type endpoint struct {
 	Name      string `json:"name,omitempty"`
 }
 
+type leg struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Extension string `json:"extension"`
+	Name      string `json:"name,omitempty"`
+}
+
 var stateDescriptions = map[correlator.CallState]string{
 	correlator.StateRinging:  "A call is ringing and waiting to be answered",
 	correlator.StateAnswered: "The call has been answered and parties are now connected",
 	correlator.StateHungUp:   "The call has ended",
+
+	correlator.StateTransferred: "The call has been transferred to another party",
+	correlator.StateVoicemail:   "The call was not answered and has gone to voicemail",
+	correlator.StateHeld:        "The call has been put on hold",
+	correlator.StateResumed:     "The call has been taken off hold",
+	correlator.StateUpdated:     "The caller ID of a party to the call has changed",
+
+	correlator.StateQueued:         "The call is waiting in a queue",
+	correlator.StateAbandoned:      "The caller hung up while waiting in a queue",
+	correlator.StateAgentConnected: "The call has been answered by a queue member",
+
+	correlator.StateParked:   "The call has been parked",
+	correlator.StateUnparked: "The call has left its parking slot",
+}
+
+var legDescriptions = map[correlator.LegState]string{
+	correlator.LegDialing:           "A destination of the call is being dialed",
+	correlator.LegRinging:           "A destination of the call is ringing",
+	correlator.LegAnswered:          "A destination of the call answered",
+	correlator.LegAnsweredElsewhere: "The call was answered by another destination",
+	correlator.LegNoAnswer:          "A destination of the call did not answer",
+	correlator.LegBusy:              "A destination of the call was busy",
+	correlator.LegCancelled:         "Dialing a destination was cancelled by the caller",
+	correlator.LegUnavailable:       "A destination of the call was unavailable",
+	correlator.LegCongestion:        "A destination of the call could not be reached due to congestion",
+	correlator.LegFailed:            "Dialing a destination of the call failed",
 }
 
-func publishChange(ctx context.Context, pub publisher.Publisher, prefix string, change correlator.CallStateChange) error {
-	topic := fmt.Sprintf("%s/call/%s/%s", prefix, change.CallID, change.State)
+// dialOutcome converts who answered and who missed the call for the payload.
+func dialOutcome(change correlator.CallStateChange) (*endpoint, []endpoint) {
+	var answeredBy *endpoint
+	if change.AnsweredBy != nil {
+		answeredBy = &endpoint{Extension: change.AnsweredBy.Extension, Name: change.AnsweredBy.Name}
+	}
+	var missedBy []endpoint
+	for _, ep := range change.MissedBy {
+		missedBy = append(missedBy, endpoint{Extension: ep.Extension, Name: ep.Name})
+	}
+	return answeredBy, missedBy
+}
+
+// pickedUpBy converts who picked the call up for the payload.
+func pickedUpBy(change correlator.CallStateChange) *endpoint {
+	if change.PickedUpBy == nil {
+		return nil
+	}
+	return &endpoint{Extension: change.PickedUpBy.Extension, Name: change.PickedUpBy.Name}
+}
+
+// publishChange publishes change to every topic the router gives it,
+// returning the first failure.
+func publishChange(ctx context.Context, pub publisher.Publisher, router *topic.Router, change correlator.CallStateChange) error {
+	topics := router.Topics(change)
+	if len(topics) == 0 {
+		return nil
+	}
 
 	payload := mqttPayload{
 		Event:       string(change.State),
@@ -180,12 +489,72 @@ func publishChange(ctx context.Context, pub publisher.Publisher, prefix string,
 	switch change.State {
 	case correlator.StateAnswered:
 		payload.RingDuration = &change.RingDuration
+		payload.AnsweredBy, payload.MissedBy = dialOutcome(change)
+		payload.PickedUpBy = pickedUpBy(change)
+	case correlator.StateLeg:
+		if change.Leg != nil {
+			payload.Description = legDescriptions[change.Leg.State]
+			payload.Leg = &leg{
+				ID:        change.Leg.ID,
+				State:     string(change.Leg.State),
+				Extension: change.Leg.Endpoint.Extension,
+				Name:      change.Leg.Endpoint.Name,
+			}
+		}
+	case correlator.StateVoicemail:
+		payload.Mailbox = change.Mailbox
+		_, payload.MissedBy = dialOutcome(change)
+	case correlator.StateQueued:
+		payload.Queue = change.Queue
+		if change.QueuePosition > 0 { // unknown for a call found on resync
+			payload.QueuePosition = &change.QueuePosition
+		}
+	case correlator.StateAbandoned:
+		payload.Queue = change.Queue
+		payload.QueuePosition = &change.QueuePosition
+		payload.QueueWait = &change.QueueWait
+	case correlator.StateAgentConnected:
+		payload.Queue = change.Queue
+		payload.QueueWait = &change.QueueWait
+		payload.Agent = &endpoint{Extension: change.Agent.Extension, Name: change.Agent.Name}
+	case correlator.StateParked:
+		payload.ParkingLot = change.ParkingLot
+		payload.ParkingSlot = change.ParkingSlot
+	case correlator.StateUnparked:
+		payload.ParkingLot = change.ParkingLot
+		payload.ParkingSlot = change.ParkingSlot
+		payload.UnparkReason = change.UnparkReason
+		if change.RetrievedBy != nil {
+			payload.RetrievedBy = &endpoint{Extension: change.RetrievedBy.Extension, Name: change.RetrievedBy.Name}
+		}
+	case correlator.StateHeld:
+		payload.HoldCount = &change.HoldCount
+	case correlator.StateResumed:
+		payload.HoldDuration = &change.HoldDuration
+		payload.HoldCount = &change.HoldCount
+	case correlator.StateTransferred:
+		payload.TransferType = change.TransferType
+		payload.TransferredBy = &endpoint{
+			Extension: change.TransferredBy.Extension,
+			Name:      change.TransferredBy.Name,
+		}
 	case correlator.StateHungUp:
+		payload.AnsweredBy, payload.MissedBy = dialOutcome(change)
+		payload.PickedUpBy = pickedUpBy(change)
+		payload.Outcome = string(change.Outcome)
+		payload.Mailbox = change.Mailbox
+		if change.Queue != "" {
+			payload.Queue = change.Queue
+			payload.QueueWait = &change.QueueWait
+		}
 		payload.Cause = change.Cause
 		payload.CauseDescription = change.CauseDescription
+		payload.CauseCategory = string(change.CauseCategory)
 		payload.CauseCode = &change.CauseCode
 		payload.TalkDuration = &change.TalkDuration
 		payload.TotalDuration = &change.TotalDuration
+		payload.HoldDuration = &change.HoldDuration
+		payload.HoldCount = &change.HoldCount
 	}
 
 	data, err := json.Marshal(payload)
@@ -193,6 +562,12 @@ func publishChange(ctx context.Context, pub publisher.Publisher, prefix string,
 		return fmt.Errorf("marshaling payload: %w", err)
 	}
 
-	log.Printf("publishing %s", topic)
-	return pub.Publish(ctx, topic, data)
+	var firstErr error
+	for _, t := range topics {
+		log.Printf("publishing %s", t)
+		if err := pub.Publish(ctx, t, data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
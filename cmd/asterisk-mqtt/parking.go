@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/parking"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
+)
+
+// parkingPayload is the retained JSON published for each parking lot.
+type parkingPayload struct {
+	Lot         string       `json:"lot"`
+	Description string       `json:"description"`
+	Count       int          `json:"count"`
+	Calls       []parkedCall `json:"calls"`
+	Timestamp   string       `json:"timestamp"`
+}
+
+type parkedCall struct {
+	Slot      string   `json:"slot"`
+	CallID    string   `json:"call_id"`
+	Extension string   `json:"extension"`
+	Name      string   `json:"name,omitempty"`
+	ParkedAt  string   `json:"parked_at"`
+	Timeout   *float64 `json:"timeout_seconds,omitempty"`
+}
+
+// syncParking seeds the tracker with every parking lot and the calls
+// parked in it. Without res_parking both actions fail, which is logged.
+func syncParking(ctx context.Context, client *ami.Client, tracker *parking.Tracker, pub publisher.Publisher, prefix string) {
+	var resps []ami.Response
+	for _, action := range []string{"ParkingLots", "ParkedCalls"} {
+		listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		resp, err := client.Send(listCtx, ami.NewAction(action))
+		cancel()
+		if err != nil {
+			log.Printf("parking sync: %s unavailable: %v", action, err)
+			return
+		}
+		resps = append(resps, resp)
+	}
+	publishParking(ctx, pub, prefix, tracker.Seed(resps...))
+}
+
+// publishParking publishes each lot as the retained value of its topic,
+// logging rather than returning failures.
+func publishParking(ctx context.Context, pub publisher.Publisher, prefix string, lots []parking.Lot) {
+	for _, lot := range lots {
+		if err := publishParkingLot(ctx, pub, prefix, lot); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishParkingLot(ctx context.Context, pub publisher.Publisher, prefix string, lot parking.Lot) error {
+	name := fmt.Sprintf("%s/parking/%s", prefix, topic.Level(lot.Name))
+
+	payload := parkingPayload{
+		Lot:         lot.Name,
+		Description: "No calls are parked",
+		Count:       len(lot.Calls),
+		Calls:       []parkedCall{},
+		Timestamp:   lot.Timestamp.UTC().Format(time.RFC3339),
+	}
+	switch n := len(lot.Calls); {
+	case n == 1:
+		payload.Description = "1 call is parked"
+	case n > 1:
+		payload.Description = fmt.Sprintf("%d calls are parked", n)
+	}
+	for _, call := range lot.Calls {
+		pc := parkedCall{
+			Slot:      call.Slot,
+			CallID:    call.CallID,
+			Extension: call.Extension,
+			Name:      call.Name,
+			ParkedAt:  call.ParkedAt.UTC().Format(time.RFC3339),
+		}
+		if call.Timeout > 0 {
+			timeout := call.Timeout.Seconds()
+			pc.Timeout = &timeout
+		}
+		payload.Calls = append(payload.Calls, pc)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.PublishRetained(ctx, name, data)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/parking"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishParkingLotRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	lot := parking.Lot{
+		Name: "default",
+		Calls: []parking.Call{
+			{Slot: "701", CallID: "1770888500.1", Extension: "1986", Name: "Martin",
+				ParkedAt: time.Unix(1770888500, 0), Timeout: 45 * time.Second},
+		},
+		Timestamp: time.Unix(1770888509, 0),
+	}
+	if err := publishParkingLot(context.Background(), mock, "asterisk", lot); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/parking/default" || !msgs[0].Retained {
+		t.Errorf("expected retained asterisk/parking/default, got %q retained=%v", msgs[0].Topic, msgs[0].Retained)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "lot", "default")
+	assertPayloadField(t, p, "description", "1 call is parked")
+	calls, ok := p["calls"].([]any)
+	if !ok || len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %v", p["calls"])
+	}
+	call := calls[0].(map[string]any)
+	assertPayloadField(t, call, "slot", "701")
+	assertPayloadField(t, call, "call_id", "1770888500.1")
+	assertPayloadField(t, call, "parked_at", "2026-02-12T09:28:20Z")
+	if call["timeout_seconds"] != 45.0 {
+		t.Errorf("expected timeout_seconds=45, got %v", call["timeout_seconds"])
+	}
+}
+
+func TestSyncParking(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		switch action.Get("Action") {
+		case "ParkingLots":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "Parkinglot", "ActionID", id, "Name", "default", "StartSpace", "701", "StopSpace", "720"},
+				{"Event", "ParkinglotsComplete", "ActionID", id, "EventList", "Complete", "ListItems", "1"},
+			}
+		case "ParkedCalls":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "ParkedCallsComplete", "ActionID", id, "EventList", "Complete", "ListItems", "0"},
+			}
+		}
+		return nil
+	})
+
+	mock := publisher.NewMockPublisher()
+	syncParking(context.Background(), client, parking.NewTracker(), mock, "asterisk")
+
+	p := parsePayload(t, mock.Retained()["asterisk/parking/default"])
+	if p["count"] != 0.0 {
+		t.Errorf("expected an empty lot, got %v", p)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/presence"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
+)
+
+// presencePayload is the retained JSON published for each extension.
+type presencePayload struct {
+	Extension   string `json:"extension"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	Registered  bool   `json:"registered"`
+	DND         bool   `json:"dnd"`
+	Timestamp   string `json:"timestamp"`
+}
+
+var presenceDescriptions = map[presence.Status]string{
+	presence.StatusIdle:        "The phone is idle",
+	presence.StatusInUse:       "The phone is on a call",
+	presence.StatusBusy:        "The phone is busy",
+	presence.StatusRinging:     "The phone is ringing",
+	presence.StatusOnHold:      "The phone has a call on hold",
+	presence.StatusUnavailable: "The phone is not registered",
+	presence.StatusUnknown:     "The phone's state is not known",
+}
+
+// syncPresence seeds the tracker with every extension's current state,
+// from dialplan hints and PJSIP endpoints, so it is correct from the
+// start rather than from each phone's next change. Either list may be
+// unavailable, e.g. PJSIPShowEndpoints on a chan_sip system.
+func syncPresence(ctx context.Context, client *ami.Client, tracker *presence.Tracker, pub publisher.Publisher, prefix string) {
+	for _, action := range []string{"ExtensionStateList", "PJSIPShowEndpoints"} {
+		listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		resp, err := client.Send(listCtx, ami.NewAction(action))
+		cancel()
+		if err != nil {
+			log.Printf("presence sync: %s unavailable: %v", action, err)
+			continue
+		}
+		publishPresence(ctx, pub, prefix, tracker.Seed(resp))
+	}
+}
+
+// publishPresence publishes each extension state as the retained value of
+// its topic, logging rather than returning failures.
+func publishPresence(ctx context.Context, pub publisher.Publisher, prefix string, states []presence.State) {
+	for _, s := range states {
+		if err := publishExtensionState(ctx, pub, prefix, s); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishExtensionState(ctx context.Context, pub publisher.Publisher, prefix string, s presence.State) error {
+	name := fmt.Sprintf("%s/extension/%s/state", prefix, topic.Level(s.Extension))
+
+	description := presenceDescriptions[s.Status]
+	if s.DND {
+		description += ", with do not disturb on"
+	}
+	data, err := json.Marshal(presencePayload{
+		Extension:   s.Extension,
+		Description: description,
+		State:       string(s.Status),
+		Registered:  s.Registered,
+		DND:         s.DND,
+		Timestamp:   s.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.PublishRetained(ctx, name, data)
+}
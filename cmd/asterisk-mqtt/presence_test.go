@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/presence"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishExtensionStateRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	s := presence.State{
+		Extension:  "21",
+		Status:     presence.StatusIdle,
+		Registered: true,
+		DND:        true,
+		Timestamp:  time.Unix(1770888509, 0),
+	}
+	if err := publishExtensionState(context.Background(), mock, "asterisk", s); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/extension/21/state" || !msgs[0].Retained {
+		t.Errorf("expected retained asterisk/extension/21/state, got %q retained=%v", msgs[0].Topic, msgs[0].Retained)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "extension", "21")
+	assertPayloadField(t, p, "state", "idle")
+	assertPayloadField(t, p, "description", "The phone is idle, with do not disturb on")
+	if p["registered"] != true || p["dnd"] != true {
+		t.Errorf("unexpected flags in %v", p)
+	}
+}
+
+func TestSyncPresence(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		switch action.Get("Action") {
+		case "ExtensionStateList":
+			return [][]string{
+				{"Response", "Success", "ActionID", id, "EventList", "start"},
+				{"Event", "ExtensionStatus", "ActionID", id, "Exten", "21", "Context", "ext-local",
+					"Hint", "PJSIP/21&Custom:DND21", "Status", "1", "StatusText", "InUse"},
+				{"Event", "ExtensionStateListComplete", "ActionID", id, "EventList", "Complete", "ListItems", "1"},
+			}
+		case "PJSIPShowEndpoints":
+			// e.g. chan_pjsip not loaded
+			return [][]string{{"Response", "Error", "ActionID", id, "Message", "Invalid/unknown command"}}
+		}
+		return nil
+	})
+
+	mock := publisher.NewMockPublisher()
+	syncPresence(context.Background(), client, presence.NewTracker(), mock, "asterisk")
+
+	retained := mock.Retained()
+	if len(retained) != 1 {
+		t.Fatalf("expected 1 retained extension, got %d", len(retained))
+	}
+	p := parsePayload(t, retained["asterisk/extension/21/state"])
+	assertPayloadField(t, p, "state", "in_use")
+}
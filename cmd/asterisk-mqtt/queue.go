@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/queue"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
+)
+
+// queuePayload is the retained JSON summary published for each queue.
+type queuePayload struct {
+	Queue          string  `json:"queue"`
+	Description    string  `json:"description"`
+	CallersWaiting int     `json:"callers_waiting"`
+	LongestWait    float64 `json:"longest_wait_seconds"`
+	Members        int     `json:"members_logged_in"`
+	Available      int     `json:"members_available"`
+	Timestamp      string  `json:"timestamp"`
+}
+
+// syncQueues seeds the tracker with every queue's callers and members.
+// Systems without app_queue loaded reject QueueStatus, which is logged.
+func syncQueues(ctx context.Context, client *ami.Client, tracker *queue.Tracker, pub publisher.Publisher, prefix string) {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := client.Send(listCtx, ami.NewAction("QueueStatus"))
+	if err != nil {
+		log.Printf("queue sync unavailable: %v", err)
+		return
+	}
+	publishQueues(ctx, pub, prefix, tracker.Seed(resp))
+}
+
+// publishQueues publishes each queue summary as the retained value of its
+// topic, logging rather than returning failures.
+func publishQueues(ctx context.Context, pub publisher.Publisher, prefix string, summaries []queue.Summary) {
+	for _, s := range summaries {
+		if err := publishQueueSummary(ctx, pub, prefix, s); err != nil {
+			log.Printf("publish error: %v", err)
+		}
+	}
+}
+
+func publishQueueSummary(ctx context.Context, pub publisher.Publisher, prefix string, s queue.Summary) error {
+	name := fmt.Sprintf("%s/queue/%s/summary", prefix, topic.Level(s.Queue))
+
+	description := "No callers are waiting"
+	switch {
+	case s.Waiting == 1:
+		description = "1 caller is waiting"
+	case s.Waiting > 1:
+		description = fmt.Sprintf("%d callers are waiting", s.Waiting)
+	}
+	data, err := json.Marshal(queuePayload{
+		Queue:          s.Queue,
+		Description:    description,
+		CallersWaiting: s.Waiting,
+		LongestWait:    s.LongestWait.Seconds(),
+		Members:        s.Members,
+		Available:      s.Available,
+		Timestamp:      s.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", name)
+	return pub.PublishRetained(ctx, name, data)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+	"github.com/sweeney/asterisk-mqtt/internal/queue"
+)
+
+func TestPublishQueueSummaryRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	s := queue.Summary{
+		Queue:       "sales",
+		Waiting:     2,
+		LongestWait: 90 * time.Second,
+		Members:     3,
+		Available:   1,
+		Timestamp:   time.Unix(1770888509, 0),
+	}
+	if err := publishQueueSummary(context.Background(), mock, "asterisk", s); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].Topic != "asterisk/queue/sales/summary" || !msgs[0].Retained {
+		t.Errorf("expected retained asterisk/queue/sales/summary, got %q retained=%v", msgs[0].Topic, msgs[0].Retained)
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "queue", "sales")
+	assertPayloadField(t, p, "description", "2 callers are waiting")
+	if p["callers_waiting"] != 2.0 || p["longest_wait_seconds"] != 90.0 ||
+		p["members_logged_in"] != 3.0 || p["members_available"] != 1.0 {
+		t.Errorf("unexpected counts in %v", p)
+	}
+	assertPayloadField(t, p, "timestamp", "2026-02-12T09:28:29Z")
+}
+
+func TestSyncQueues(t *testing.T) {
+	client := servedClient(t, func(action ami.Event) [][]string {
+		id := action.Get("ActionID")
+		if action.Get("Action") != "QueueStatus" {
+			return nil
+		}
+		return [][]string{
+			{"Response", "Success", "ActionID", id, "EventList", "start", "Message", "Queue status will follow"},
+			{"Event", "QueueParams", "ActionID", id, "Queue", "sales", "Calls", "1"},
+			{"Event", "QueueMember", "ActionID", id, "Queue", "sales", "Name", "Kitchen", "Location", "PJSIP/21",
+				"Status", "1", "Paused", "0"},
+			{"Event", "QueueEntry", "ActionID", id, "Queue", "sales", "Position", "1", "Uniqueid", "1770888500.1", "Wait", "30"},
+			{"Event", "QueueStatusComplete", "ActionID", id, "EventList", "Complete", "ListItems", "3"},
+		}
+	})
+
+	mock := publisher.NewMockPublisher()
+	syncQueues(context.Background(), client, queue.NewTracker(), mock, "asterisk")
+
+	retained := mock.Retained()
+	if len(retained) != 1 {
+		t.Fatalf("expected 1 retained queue, got %d", len(retained))
+	}
+	p := parsePayload(t, retained["asterisk/queue/sales/summary"])
+	if p["callers_waiting"] != 1.0 || p["longest_wait_seconds"] != 30.0 || p["members_logged_in"] != 1.0 {
+		t.Errorf("unexpected summary %v", p)
+	}
+}
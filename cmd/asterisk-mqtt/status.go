@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+// version is the bridge version reported on the status topic, set at
+// build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// statusPayload is the retained JSON published to {prefix}/bridge/status.
+type statusPayload struct {
+	Status         string `json:"status"`
+	Description    string `json:"description"`
+	Version        string `json:"version"`
+	AMIConnected   bool   `json:"ami_connected"`
+	AsteriskBanner string `json:"asterisk_banner,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+}
+
+func statusTopic(prefix string) string {
+	return prefix + "/bridge/status"
+}
+
+// offlineStatus is the payload left on the status topic when the bridge
+// stops, either by the broker as the Last Will or by a clean shutdown. It
+// is fixed when connecting, so it carries no timestamp.
+func offlineStatus() []byte {
+	data, _ := json.Marshal(statusPayload{
+		Status:      "offline",
+		Description: "The bridge is not running",
+		Version:     version,
+	})
+	return data
+}
+
+// publishStatus publishes that the bridge is online, and whether it is
+// connected to Asterisk. banner is the AMI banner of the current session,
+// or of the last one while disconnected.
+func publishStatus(ctx context.Context, pub publisher.Publisher, prefix string, amiConnected bool, banner string, now time.Time) error {
+	topic := statusTopic(prefix)
+
+	description := "The bridge is running but not connected to Asterisk"
+	if amiConnected {
+		description = "The bridge is running and connected to Asterisk"
+	}
+	data, err := json.Marshal(statusPayload{
+		Status:         "online",
+		Description:    description,
+		Version:        version,
+		AMIConnected:   amiConnected,
+		AsteriskBanner: banner,
+		Timestamp:      now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	log.Printf("publishing %s", topic)
+	return pub.PublishRetained(ctx, topic, data)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/publisher"
+)
+
+func TestPublishStatusRetained(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	now := time.Unix(1770888509, 0)
+	if err := publishStatus(context.Background(), mock, "asterisk", true, "Asterisk Call Manager/5.0.1", now); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	msgs := mock.Messages()
+	if len(msgs) != 1 || msgs[0].Topic != "asterisk/bridge/status" {
+		t.Fatalf("expected 1 message on asterisk/bridge/status, got %+v", msgs)
+	}
+	if !msgs[0].Retained {
+		t.Error("expected bridge status to be retained")
+	}
+	p := parsePayload(t, msgs[0].Payload)
+	assertPayloadField(t, p, "status", "online")
+	assertPayloadField(t, p, "description", "The bridge is running and connected to Asterisk")
+	assertPayloadField(t, p, "version", version)
+	assertPayloadField(t, p, "asterisk_banner", "Asterisk Call Manager/5.0.1")
+	assertPayloadField(t, p, "timestamp", "2026-02-12T09:28:29Z")
+	if p["ami_connected"] != true {
+		t.Errorf("expected ami_connected=true, got %v", p["ami_connected"])
+	}
+}
+
+func TestPublishStatusDisconnected(t *testing.T) {
+	mock := publisher.NewMockPublisher()
+	if err := publishStatus(context.Background(), mock, "asterisk", false, "", time.Now()); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+
+	p := parsePayload(t, mock.Messages()[0].Payload)
+	assertPayloadField(t, p, "status", "online")
+	if p["ami_connected"] != false {
+		t.Errorf("expected ami_connected=false, got %v", p["ami_connected"])
+	}
+	if _, ok := p["asterisk_banner"]; ok {
+		t.Error("expected no asterisk_banner before the first AMI session")
+	}
+}
+
+func TestOfflineStatus(t *testing.T) {
+	var p map[string]any
+	if err := json.Unmarshal(offlineStatus(), &p); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	assertPayloadField(t, p, "status", "offline")
+	if p["ami_connected"] != false {
+		t.Errorf("expected ami_connected=false, got %v", p["ami_connected"])
+	}
+	if _, ok := p["timestamp"]; ok {
+		t.Error("the Will payload should not carry a timestamp")
+	}
+}
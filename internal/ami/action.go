@@ -0,0 +1,30 @@
+package ami
+
+import "strings"
+
+// Action is an AMI request sent to Asterisk.
+type Action struct {
+	Name    string
+	headers []header
+}
+
+// NewAction creates an Action with the given name and key-value pairs.
+func NewAction(name string, kvs ...string) Action {
+	a := Action{Name: name}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		a.headers = append(a.headers, header{Key: kvs[i], Value: kvs[i+1]})
+	}
+	return a
+}
+
+// encode renders the action in AMI wire format, tagged with the given ActionID.
+func (a Action) encode(actionID string) []byte {
+	var b strings.Builder
+	b.WriteString("Action: " + a.Name + "\r\n")
+	b.WriteString("ActionID: " + actionID + "\r\n")
+	for _, h := range a.headers {
+		b.WriteString(h.Key + ": " + h.Value + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
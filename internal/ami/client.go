@@ -0,0 +1,325 @@
+package ami
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Send once the connection has been closed.
+var ErrClosed = errors.New("AMI connection closed")
+
+// AuthError is returned by Login when Asterisk rejects the credentials.
+// Retrying with the same credentials will not succeed.
+type AuthError struct {
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("AMI login rejected: %s", e.Message)
+}
+
+// ResponseError is returned when Asterisk answers an action with
+// "Response: Error".
+type ResponseError struct {
+	Action  string
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("AMI action %s failed: %s", e.Action, e.Message)
+}
+
+// Response is Asterisk's reply to an action.
+type Response struct {
+	Event
+
+	// Events holds the follow-up events for list actions such as
+	// CoreShowChannels, excluding the closing "EventList: Complete" marker.
+	Events []Event
+}
+
+// pendingAction is an action awaiting its response.
+type pendingAction struct {
+	name   string
+	resp   Response
+	inList bool // response said "EventList: start"; collecting follow-ups
+	done   chan Response
+}
+
+// abandonedTTL is how long the ActionID of an action Send gave up on is
+// remembered, for dropping the rest of its reply when it arrives late.
+const abandonedTTL = time.Minute
+
+// Client is a connection to the Asterisk Manager Interface. It multiplexes
+// actions over the connection by ActionID and delivers unsolicited events
+// through Next.
+type Client struct {
+	conn    net.Conn
+	parser  *Parser
+	banner  string
+	version string
+	nextID  atomic.Uint64
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	pending   map[string]*pendingAction
+	abandoned map[string]time.Time // ActionID to when Send gave up on it
+	queue     []Event              // unsolicited events not yet returned by Next
+	notify    chan struct{}        // signalled when queue grows
+	closed    chan struct{}        // closed when the read loop exits
+}
+
+// Dial connects to AMI at addr and reads the banner.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial AMI: %w", err)
+	}
+	c, err := NewClient(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient wraps an established connection, reads the AMI banner from it
+// and starts routing incoming messages.
+func NewClient(ctx context.Context, conn net.Conn) (*Client, error) {
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	banner, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading AMI banner: %w", err)
+	}
+	banner = strings.TrimSpace(banner)
+	if !stop() {
+		return nil, fmt.Errorf("reading AMI banner: %w", ctx.Err())
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c := &Client{
+		conn:      conn,
+		parser:    NewParser(reader),
+		banner:    banner,
+		version:   parseBannerVersion(banner),
+		pending:   make(map[string]*pendingAction),
+		abandoned: make(map[string]time.Time),
+		notify:    make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// parseBannerVersion extracts the protocol version from a banner such as
+// "Asterisk Call Manager/5.0.1".
+func parseBannerVersion(banner string) string {
+	if i := strings.LastIndex(banner, "/"); i >= 0 {
+		return banner[i+1:]
+	}
+	return ""
+}
+
+// Banner returns the banner line sent by Asterisk on connect.
+func (c *Client) Banner() string {
+	return c.banner
+}
+
+// Version returns the AMI protocol version parsed from the banner,
+// or empty string if the banner had no version.
+func (c *Client) Version() string {
+	return c.version
+}
+
+// Login authenticates the session and waits for Asterisk's reply.
+// Returns an *AuthError if the credentials were rejected.
+func (c *Client) Login(ctx context.Context, username, secret string) error {
+	_, err := c.Send(ctx, NewAction("Login", "Username", username, "Secret", secret))
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && strings.EqualFold(respErr.Message, "Authentication failed") {
+		return &AuthError{Message: respErr.Message}
+	}
+	return err
+}
+
+// Send writes an action tagged with a fresh ActionID and waits for the
+// matching response. For list actions the returned Response also carries
+// every follow-up event up to "EventList: Complete". A "Response: Error"
+// reply is returned as a *ResponseError.
+func (c *Client) Send(ctx context.Context, action Action) (Response, error) {
+	id := c.newActionID()
+	p := &pendingAction{name: action.Name, done: make(chan Response, 1)}
+
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return Response{}, ErrClosed
+	default:
+	}
+	c.pending[id] = p
+	c.mu.Unlock()
+
+	if err := c.write(ctx, action.encode(id)); err != nil {
+		c.forget(id)
+		return Response{}, fmt.Errorf("sending %s: %w", action.Name, err)
+	}
+
+	select {
+	case resp := <-p.done:
+		if resp.Get("Response") == "Error" {
+			return resp, &ResponseError{Action: action.Name, Message: resp.Get("Message")}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		c.abandon(id)
+		return Response{}, ctx.Err()
+	case <-c.closed:
+		return Response{}, ErrClosed
+	}
+}
+
+// Next returns the next unsolicited event. It blocks until one is
+// available, and returns a zero Event and false once the connection is
+// closed and all queued events have been consumed.
+func (c *Client) Next() (Event, bool) {
+	for {
+		c.mu.Lock()
+		if len(c.queue) > 0 {
+			evt := c.queue[0]
+			c.queue = c.queue[1:]
+			c.mu.Unlock()
+			return evt, true
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.notify:
+		case <-c.closed:
+			c.mu.Lock()
+			empty := len(c.queue) == 0
+			c.mu.Unlock()
+			if empty {
+				return Event{}, false
+			}
+		}
+	}
+}
+
+// Close closes the underlying connection. Pending and future calls to
+// Send fail with ErrClosed.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) newActionID() string {
+	return "asterisk-mqtt-" + strconv.FormatUint(c.nextID.Add(1), 10)
+}
+
+func (c *Client) write(ctx context.Context, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// abandon forgets an action Send gave up on, but remembers its ActionID
+// for a while so that late list events aren't mistaken for unsolicited
+// ones.
+func (c *Client) abandon(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+	now := time.Now()
+	for old, at := range c.abandoned {
+		if now.Sub(at) > abandonedTTL {
+			delete(c.abandoned, old)
+		}
+	}
+	c.abandoned[id] = now
+}
+
+// readLoop routes every incoming block either to the action waiting on
+// its ActionID or to the unsolicited event queue.
+func (c *Client) readLoop() {
+	defer close(c.closed)
+
+	for {
+		evt, ok := c.parser.Next()
+		if !ok {
+			return
+		}
+		c.route(evt)
+	}
+}
+
+func (c *Client) route(evt Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := evt.Get("ActionID")
+	if _, ok := c.abandoned[id]; ok && id != "" {
+		// The rest of a reply nobody is waiting for any more; it ends
+		// with a plain response or the list's closing event.
+		eventList := evt.Get("EventList")
+		if (evt.IsResponse() && !strings.EqualFold(eventList, "start")) || strings.EqualFold(eventList, "Complete") {
+			delete(c.abandoned, id)
+		}
+		return
+	}
+	p := c.pending[id]
+	if id == "" || p == nil {
+		if evt.IsResponse() {
+			return // reply to an action nobody is waiting for any more
+		}
+		c.queue = append(c.queue, evt)
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	switch {
+	case evt.IsResponse():
+		p.resp.Event = evt
+		if strings.EqualFold(evt.Get("EventList"), "start") {
+			p.inList = true
+			return
+		}
+	case p.inList && strings.EqualFold(evt.Get("EventList"), "Complete"):
+	case p.inList:
+		p.resp.Events = append(p.resp.Events, evt)
+		return
+	default:
+		return // stray event tagged with our ActionID before the response
+	}
+
+	delete(c.pending, id)
+	p.done <- p.resp
+}
@@ -0,0 +1,374 @@
+package ami_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// fakeAMI is the server side of a net.Pipe speaking just enough AMI for tests.
+type fakeAMI struct {
+	conn   net.Conn
+	parser *ami.Parser
+}
+
+func newFakeAMI(t *testing.T, banner string) (*fakeAMI, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	go server.Write([]byte(banner + "\r\n"))
+	return &fakeAMI{conn: server, parser: ami.NewParser(bufio.NewReader(server))}, client
+}
+
+// readAction reads the next action block the client sent.
+func (f *fakeAMI) readAction(t *testing.T) ami.Event {
+	t.Helper()
+	evt, ok := f.parser.Next()
+	if !ok {
+		t.Fatal("expected an action from the client")
+	}
+	return evt
+}
+
+func (f *fakeAMI) send(kvs ...string) {
+	var s string
+	for i := 0; i+1 < len(kvs); i += 2 {
+		s += fmt.Sprintf("%s: %s\r\n", kvs[i], kvs[i+1])
+	}
+	f.conn.Write([]byte(s + "\r\n"))
+}
+
+func TestClientParsesBannerVersion(t *testing.T) {
+	_, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Banner() != "Asterisk Call Manager/5.0.1" {
+		t.Errorf("expected full banner, got %q", c.Banner())
+	}
+	if c.Version() != "5.0.1" {
+		t.Errorf("expected version=5.0.1, got %q", c.Version())
+	}
+}
+
+func TestClientLoginSuccess(t *testing.T) {
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Login(context.Background(), "admin", "s3cret") }()
+
+	login := srv.readAction(t)
+	if login.Get("Action") != "Login" {
+		t.Errorf("expected Action=Login, got %q", login.Get("Action"))
+	}
+	if login.Get("Username") != "admin" || login.Get("Secret") != "s3cret" {
+		t.Errorf("unexpected credentials: %q / %q", login.Get("Username"), login.Get("Secret"))
+	}
+	id := login.Get("ActionID")
+	if id == "" {
+		t.Fatal("expected login to carry an ActionID")
+	}
+
+	// An unrelated response must not satisfy the login
+	srv.send("Response", "Success", "ActionID", "someone-else")
+	srv.send("Response", "Success", "ActionID", id, "Message", "Authentication accepted")
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected login to succeed, got %v", err)
+	}
+}
+
+func TestClientLoginAuthFailed(t *testing.T) {
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Login(context.Background(), "admin", "wrong") }()
+
+	id := srv.readAction(t).Get("ActionID")
+	srv.send("Response", "Error", "ActionID", id, "Message", "Authentication failed")
+
+	err = <-errCh
+	var authErr *ami.AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected *AuthError, got %v", err)
+	}
+	if authErr.Message != "Authentication failed" {
+		t.Errorf("expected message 'Authentication failed', got %q", authErr.Message)
+	}
+}
+
+func TestClientLoginOtherError(t *testing.T) {
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Login(context.Background(), "admin", "s3cret") }()
+
+	id := srv.readAction(t).Get("ActionID")
+	srv.send("Response", "Error", "ActionID", id, "Message", "Permission denied")
+
+	err = <-errCh
+	var authErr *ami.AuthError
+	if errors.As(err, &authErr) {
+		t.Fatal("expected a non-auth error")
+	}
+	var respErr *ami.ResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("expected *ResponseError, got %v", err)
+	}
+}
+
+func TestClientLoginConnectionClosed(t *testing.T) {
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Login(context.Background(), "admin", "s3cret") }()
+
+	srv.readAction(t)
+	srv.conn.Close()
+
+	if err := <-errCh; err == nil {
+		t.Fatal("expected error when connection closes during login")
+	}
+}
+
+func TestClientLoginContextTimeout(t *testing.T) {
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Login(ctx, "admin", "s3cret") }()
+
+	srv.readAction(t) // never answer
+
+	if err := <-errCh; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func newTestClient(t *testing.T) (*fakeAMI, *ami.Client) {
+	t.Helper()
+	srv, conn := newFakeAMI(t, "Asterisk Call Manager/5.0.1")
+	c, err := ami.NewClient(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+type sendResult struct {
+	resp ami.Response
+	err  error
+}
+
+func sendAsync(ctx context.Context, c *ami.Client, action ami.Action) <-chan sendResult {
+	ch := make(chan sendResult, 1)
+	go func() {
+		resp, err := c.Send(ctx, action)
+		ch <- sendResult{resp, err}
+	}()
+	return ch
+}
+
+func TestClientSendRoutesResponsesByActionID(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	first := sendAsync(context.Background(), c, ami.NewAction("Ping"))
+	firstID := srv.readAction(t).Get("ActionID")
+	second := sendAsync(context.Background(), c, ami.NewAction("CoreSettings"))
+	secondID := srv.readAction(t).Get("ActionID")
+
+	if firstID == secondID {
+		t.Fatalf("expected distinct ActionIDs, both were %q", firstID)
+	}
+
+	// Answer out of order
+	srv.send("Response", "Success", "ActionID", secondID, "AsteriskVersion", "20.5.0")
+	srv.send("Response", "Success", "ActionID", firstID, "Ping", "Pong")
+
+	r1 := <-first
+	if r1.err != nil || r1.resp.Get("Ping") != "Pong" {
+		t.Errorf("expected Ping reply, got %+v", r1)
+	}
+	r2 := <-second
+	if r2.err != nil || r2.resp.Get("AsteriskVersion") != "20.5.0" {
+		t.Errorf("expected CoreSettings reply, got %+v", r2)
+	}
+}
+
+func TestClientSendCollectsEventList(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	res := sendAsync(context.Background(), c, ami.NewAction("CoreShowChannels"))
+	id := srv.readAction(t).Get("ActionID")
+
+	srv.send("Response", "Success", "ActionID", id, "EventList", "start", "Message", "Channels will follow")
+	srv.send("Event", "CoreShowChannel", "ActionID", id, "Channel", "PJSIP/1986-00000019")
+	srv.send("Event", "Newstate", "Channel", "PJSIP/21-0000001a") // unsolicited, interleaved
+	srv.send("Event", "CoreShowChannel", "ActionID", id, "Channel", "PJSIP/21-0000001a")
+	srv.send("Event", "CoreShowChannelsComplete", "ActionID", id, "EventList", "Complete", "ListItems", "2")
+
+	r := <-res
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	if len(r.resp.Events) != 2 {
+		t.Fatalf("expected 2 list events, got %d", len(r.resp.Events))
+	}
+	if r.resp.Events[1].Get("Channel") != "PJSIP/21-0000001a" {
+		t.Errorf("unexpected second list event: %q", r.resp.Events[1].Get("Channel"))
+	}
+
+	evt, ok := c.Next()
+	if !ok || evt.Type() != "Newstate" {
+		t.Errorf("expected interleaved Newstate via Next, got %q", evt.Type())
+	}
+}
+
+func TestClientSendErrorResponse(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	res := sendAsync(context.Background(), c, ami.NewAction("Originate"))
+	id := srv.readAction(t).Get("ActionID")
+	srv.send("Response", "Error", "ActionID", id, "Message", "Extension does not exist.")
+
+	r := <-res
+	var respErr *ami.ResponseError
+	if !errors.As(r.err, &respErr) {
+		t.Fatalf("expected *ResponseError, got %v", r.err)
+	}
+	if respErr.Action != "Originate" || respErr.Message != "Extension does not exist." {
+		t.Errorf("unexpected error contents: %+v", respErr)
+	}
+}
+
+func TestClientSendContextCancelled(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := sendAsync(ctx, c, ami.NewAction("Ping"))
+	id := srv.readAction(t).Get("ActionID")
+	cancel()
+
+	if r := <-res; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", r.err)
+	}
+
+	// A late reply for the abandoned action is dropped, not delivered as an event
+	srv.send("Response", "Success", "ActionID", id, "Ping", "Pong")
+	srv.send("Event", "FullyBooted")
+	evt, ok := c.Next()
+	if !ok || evt.Type() != "FullyBooted" {
+		t.Errorf("expected FullyBooted, got %q", evt.Type())
+	}
+}
+
+func TestClientSendDropsLateListEvents(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := sendAsync(ctx, c, ami.NewAction("CoreShowChannels"))
+	id := srv.readAction(t).Get("ActionID")
+	srv.send("Response", "Success", "ActionID", id, "EventList", "start", "Message", "Channels will follow")
+	cancel()
+
+	if r := <-res; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", r.err)
+	}
+
+	// The rest of the abandoned list is dropped, not delivered as events
+	srv.send("Event", "CoreShowChannel", "ActionID", id, "Channel", "PJSIP/1986-00000019")
+	srv.send("Event", "CoreShowChannelsComplete", "ActionID", id, "EventList", "Complete", "ListItems", "1")
+	srv.send("Event", "FullyBooted")
+	evt, ok := c.Next()
+	if !ok || evt.Type() != "FullyBooted" {
+		t.Errorf("expected FullyBooted, got %q", evt.Type())
+	}
+}
+
+func TestClientSendForgetsAbandonedActionOnceAnswered(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := sendAsync(ctx, c, ami.NewAction("Ping"))
+	id := srv.readAction(t).Get("ActionID")
+	cancel()
+	<-res
+
+	// Only the late reply itself is dropped; the ActionID is then
+	// forgotten, so a later event that happens to carry it is delivered
+	srv.send("Response", "Success", "ActionID", id, "Ping", "Pong")
+	srv.send("Event", "UserEvent", "ActionID", id, "UserEvent", "Later")
+	evt, ok := c.Next()
+	if !ok || evt.Type() != "UserEvent" {
+		t.Errorf("expected UserEvent, got %q", evt.Type())
+	}
+}
+
+func TestClientSendAfterClose(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	res := sendAsync(context.Background(), c, ami.NewAction("Ping"))
+	srv.readAction(t)
+	srv.conn.Close()
+
+	if r := <-res; !errors.Is(r.err, ami.ErrClosed) {
+		t.Fatalf("expected ErrClosed for in-flight action, got %v", r.err)
+	}
+	if _, err := c.Send(context.Background(), ami.NewAction("Ping")); !errors.Is(err, ami.ErrClosed) {
+		t.Fatalf("expected ErrClosed after close, got %v", err)
+	}
+}
+
+func TestClientNextDeliversEventsUntilClose(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	srv.send("Event", "Newchannel", "Linkedid", "1.1")
+	srv.send("Event", "Hangup", "Linkedid", "1.1")
+	srv.conn.Close()
+
+	var types []string
+	for {
+		evt, ok := c.Next()
+		if !ok {
+			break
+		}
+		types = append(types, evt.Type())
+	}
+	if len(types) != 2 || types[0] != "Newchannel" || types[1] != "Hangup" {
+		t.Errorf("expected [Newchannel Hangup], got %v", types)
+	}
+}
@@ -2,6 +2,7 @@ package ami
 
 import (
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -34,6 +35,15 @@ func (e Event) Get(key string) string {
 	return ""
 }
 
+// GetKnown returns the value for the given key like Get, but empty for
+// Asterisk's "<unknown>" placeholder, as in CallerIDName: <unknown>.
+func (e Event) GetKnown(key string) string {
+	if v := e.Get(key); v != "<unknown>" {
+		return v
+	}
+	return ""
+}
+
 // Type returns the Event header value (the AMI event type).
 func (e Event) Type() string {
 	return e.Get("Event")
@@ -57,6 +67,41 @@ func (e Event) GetTime(key string) time.Time {
 	return t
 }
 
+// GetEpoch returns the timestamp for the given key parsed as AMI's
+// "seconds.microseconds" Unix epoch format, or zero time.
+func (e Event) GetEpoch(key string) time.Time {
+	v := e.Get(key)
+	if v == "" {
+		return time.Time{}
+	}
+	secStr, fracStr, _ := strings.Cut(v, ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	var nsec int64
+	if fracStr != "" {
+		if len(fracStr) > 9 {
+			fracStr = fracStr[:9]
+		}
+		frac, err := strconv.ParseInt(fracStr, 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		for i := len(fracStr); i < 9; i++ {
+			frac *= 10
+		}
+		nsec = frac
+	}
+	return time.Unix(sec, nsec)
+}
+
+// Timestamp returns the time Asterisk generated the event, taken from the
+// Timestamp header sent when timestampevents=yes, or zero time if absent.
+func (e Event) Timestamp() time.Time {
+	return e.GetEpoch("Timestamp")
+}
+
 // Headers returns all headers as key-value pairs.
 func (e Event) Headers() []header {
 	return e.headers
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sweeney/asterisk-mqtt/internal/ami"
 )
@@ -243,6 +244,11 @@ func TestEventAccessors(t *testing.T) {
 	if evt.GetInt("Channel") != 0 {
 		t.Errorf("expected GetInt on non-numeric to return 0, got %d", evt.GetInt("Channel"))
 	}
+
+	cid := ami.NewEvent("CallerIDNum", "21", "CallerIDName", "<unknown>")
+	if cid.GetKnown("CallerIDNum") != "21" || cid.GetKnown("CallerIDName") != "" {
+		t.Errorf("expected GetKnown to drop only <unknown>, got %q / %q", cid.GetKnown("CallerIDNum"), cid.GetKnown("CallerIDName"))
+	}
 	if !evt.IsResponse() == true {
 		// This is not a response
 	}
@@ -253,6 +259,29 @@ func TestEventAccessors(t *testing.T) {
 	}
 }
 
+func TestEventTimestamp(t *testing.T) {
+	evt := ami.NewEvent("Event", "Newstate", "Timestamp", "1770888509.123456")
+
+	ts := evt.Timestamp()
+	want := time.Unix(1770888509, 123456000)
+	if !ts.Equal(want) {
+		t.Errorf("expected %v, got %v", want, ts)
+	}
+
+	if ts := ami.NewEvent("Timestamp", "1770888509").Timestamp(); !ts.Equal(time.Unix(1770888509, 0)) {
+		t.Errorf("expected whole-second timestamp, got %v", ts)
+	}
+	if ts := ami.NewEvent("Timestamp", "1770888509.5").Timestamp(); !ts.Equal(time.Unix(1770888509, 500000000)) {
+		t.Errorf("expected half-second timestamp, got %v", ts)
+	}
+	if ts := ami.NewEvent("Event", "Newstate").Timestamp(); !ts.IsZero() {
+		t.Errorf("expected zero time without Timestamp header, got %v", ts)
+	}
+	if ts := ami.NewEvent("Timestamp", "2026-02-12T10:30:00Z").Timestamp(); !ts.IsZero() {
+		t.Errorf("expected zero time for non-epoch value, got %v", ts)
+	}
+}
+
 func TestParserStreamReading(t *testing.T) {
 	input := "Event: Test\r\nKey: Value\r\n\r\nEvent: Test2\r\nKey2: Value2\r\n\r\n"
 	parser := ami.NewParser(strings.NewReader(input))
@@ -0,0 +1,274 @@
+// Package conference tracks who is in each ConfBridge conference room
+// from AMI events and action responses.
+package conference
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Participant is one channel in a conference.
+type Participant struct {
+	ID        string // channel Uniqueid
+	Extension string
+	Name      string
+	Admin     bool
+	Muted     bool
+	Talking   bool
+	JoinedAt  time.Time
+}
+
+// Room is the state of one conference. A room with no participants has
+// ended; Started is then zero.
+type Room struct {
+	Name         string
+	Started      time.Time
+	Participants []Participant // in join order
+	Timestamp    time.Time
+}
+
+// EventType is something that happened to a participant.
+type EventType string
+
+const (
+	EventJoined EventType = "joined"
+	EventLeft   EventType = "left"
+)
+
+// Event is a participant joining or leaving a room.
+type Event struct {
+	Type        EventType
+	Room        string
+	Participant Participant
+	Count       int // participants in the room afterwards
+	Timestamp   time.Time
+}
+
+// Tracker keeps the state of every active room.
+type Tracker struct {
+	rooms map[string]*Room
+	clock func() time.Time
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		rooms: make(map[string]*Room),
+		clock: time.Now,
+	}
+}
+
+// Process ingests an AMI event and returns the room it changed, if any,
+// and the joins and leaves it caused.
+func (t *Tracker) Process(evt ami.Event) ([]Room, []Event) {
+	name := evt.Get("Conference")
+	if name == "" {
+		return nil, nil
+	}
+	now := evt.Timestamp()
+	if now.IsZero() {
+		now = t.clock()
+	}
+
+	switch evt.Type() {
+	case "ConfBridgeStart":
+		if t.rooms[name] != nil {
+			return nil, nil
+		}
+		t.room(name, now)
+		return t.report(name, now), nil
+
+	case "ConfBridgeEnd":
+		r := t.rooms[name]
+		if r == nil {
+			return nil, nil
+		}
+		var events []Event
+		for _, p := range r.Participants {
+			events = append(events, Event{Type: EventLeft, Room: name, Participant: p, Timestamp: now})
+		}
+		delete(t.rooms, name)
+		return []Room{{Name: name, Timestamp: now}}, events
+
+	case "ConfBridgeJoin":
+		r := t.room(name, now)
+		p := participant(evt)
+		p.JoinedAt = now
+		if i := r.find(p.ID); i >= 0 {
+			r.Participants[i] = p
+			return t.report(name, now), nil
+		}
+		r.Participants = append(r.Participants, p)
+		return t.report(name, now), []Event{{
+			Type: EventJoined, Room: name, Participant: p, Count: len(r.Participants), Timestamp: now,
+		}}
+
+	case "ConfBridgeLeave":
+		r := t.rooms[name]
+		if r == nil {
+			return nil, nil
+		}
+		i := r.find(evt.Get("Uniqueid"))
+		if i < 0 {
+			return nil, nil
+		}
+		p := r.Participants[i]
+		r.Participants = append(r.Participants[:i], r.Participants[i+1:]...)
+		event := Event{Type: EventLeft, Room: name, Participant: p, Count: len(r.Participants), Timestamp: now}
+		if len(r.Participants) == 0 {
+			// ConfBridgeEnd follows, but the room is already empty.
+			delete(t.rooms, name)
+			return []Room{{Name: name, Timestamp: now}}, []Event{event}
+		}
+		return t.report(name, now), []Event{event}
+
+	case "ConfBridgeTalking":
+		return t.updateParticipant(name, evt.Get("Uniqueid"), now, func(p *Participant) {
+			p.Talking = evt.Get("TalkingStatus") == "on"
+		}), nil
+	case "ConfBridgeMute":
+		return t.updateParticipant(name, evt.Get("Uniqueid"), now, func(p *Participant) { p.Muted = true }), nil
+	case "ConfBridgeUnmute":
+		return t.updateParticipant(name, evt.Get("Uniqueid"), now, func(p *Participant) { p.Muted = false }), nil
+	}
+	return nil, nil
+}
+
+// Seed replaces what the tracker knows with the ConfbridgeList responses
+// of every active room, returning each room whose participants changed,
+// including rooms that ended while the tracker wasn't watching. Rooms
+// seen for the first time are taken to have started now.
+func (t *Tracker) Seed(lists []ami.Response) []Room {
+	now := t.clock()
+	prev := t.rooms
+	t.rooms = make(map[string]*Room)
+
+	for _, resp := range lists {
+		for _, evt := range resp.Events {
+			name := evt.Get("Conference")
+			if evt.Type() != "ConfbridgeList" || name == "" {
+				continue
+			}
+			started := now
+			if old := prev[name]; old != nil {
+				started = old.Started
+			}
+			r := t.room(name, started)
+			p := participant(evt)
+			p.Talking = yes(evt.Get("Talking"))
+			p.JoinedAt = now
+			if old := prev[name]; old != nil {
+				if i := old.find(p.ID); i >= 0 {
+					p.JoinedAt = old.Participants[i].JoinedAt
+				}
+			}
+			r.Participants = append(r.Participants, p)
+		}
+	}
+
+	var names []string
+	for name := range prev {
+		names = append(names, name)
+	}
+	for name := range t.rooms {
+		if prev[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var rooms []Room
+	for _, name := range names {
+		r := t.rooms[name]
+		if r == nil {
+			rooms = append(rooms, Room{Name: name, Timestamp: now})
+			continue
+		}
+		if old := prev[name]; old != nil && sameParticipants(old.Participants, r.Participants) {
+			continue
+		}
+		rooms = append(rooms, t.report(name, now)...)
+	}
+	return rooms
+}
+
+func (t *Tracker) room(name string, started time.Time) *Room {
+	r := t.rooms[name]
+	if r == nil {
+		r = &Room{Name: name, Started: started}
+		t.rooms[name] = r
+	}
+	return r
+}
+
+// updateParticipant applies fn to a participant, returning the room if
+// the participant is known.
+func (t *Tracker) updateParticipant(name, id string, now time.Time, fn func(*Participant)) []Room {
+	r := t.rooms[name]
+	if r == nil {
+		return nil
+	}
+	i := r.find(id)
+	if i < 0 {
+		return nil
+	}
+	before := r.Participants[i]
+	fn(&r.Participants[i])
+	if r.Participants[i] == before {
+		return nil
+	}
+	return t.report(name, now)
+}
+
+// report returns a copy of the room as of now.
+func (t *Tracker) report(name string, now time.Time) []Room {
+	r := t.rooms[name]
+	r.Timestamp = now
+	room := *r
+	room.Participants = append([]Participant(nil), r.Participants...)
+	return []Room{room}
+}
+
+func (r *Room) find(id string) int {
+	for i, p := range r.Participants {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// participant reads a participant from ConfBridgeJoin or ConfbridgeList.
+func participant(evt ami.Event) Participant {
+	id := evt.Get("Uniqueid")
+	if id == "" {
+		id = evt.Get("Channel")
+	}
+	return Participant{
+		ID:        id,
+		Extension: evt.GetKnown("CallerIDNum"),
+		Name:      evt.GetKnown("CallerIDName"),
+		Admin:     yes(evt.Get("Admin")),
+		Muted:     yes(evt.Get("Muted")),
+	}
+}
+
+func sameParticipants(a, b []Participant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Muted != b[i].Muted || a[i].Talking != b[i].Talking {
+			return false
+		}
+	}
+	return true
+}
+
+// yes parses AMI's Yes/No flags.
+func yes(v string) bool {
+	return strings.EqualFold(v, "yes") || v == "1"
+}
@@ -0,0 +1,140 @@
+package conference_test
+
+import (
+	"testing"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/conference"
+)
+
+func join(room, id, ext, name string, kvs ...string) ami.Event {
+	return ami.NewEvent(append([]string{"Event", "ConfBridgeJoin", "Conference", room, "Uniqueid", id,
+		"CallerIDNum", ext, "CallerIDName", name}, kvs...)...)
+}
+
+func leave(room, id string, kvs ...string) ami.Event {
+	return ami.NewEvent(append([]string{"Event", "ConfBridgeLeave", "Conference", room, "Uniqueid", id}, kvs...)...)
+}
+
+func TestJoinAndLeave(t *testing.T) {
+	tr := conference.NewTracker()
+
+	rooms, events := tr.Process(ami.NewEvent("Event", "ConfBridgeStart", "Conference", "1000",
+		"Timestamp", "1770888500.000000"))
+	if len(rooms) != 1 || rooms[0].Name != "1000" || len(rooms[0].Participants) != 0 || len(events) != 0 {
+		t.Fatalf("expected an empty started room, got %+v %+v", rooms, events)
+	}
+	if rooms[0].Started.Unix() != 1770888500 {
+		t.Errorf("expected start time from the event, got %v", rooms[0].Started)
+	}
+
+	rooms, events = tr.Process(join("1000", "c.1", "21", "Kitchen", "Timestamp", "1770888501.000000"))
+	if len(events) != 1 || events[0].Type != conference.EventJoined || events[0].Participant.Extension != "21" || events[0].Count != 1 {
+		t.Errorf("expected 21 to join, got %+v", events)
+	}
+	if len(rooms) != 1 || len(rooms[0].Participants) != 1 || rooms[0].Started.Unix() != 1770888500 {
+		t.Errorf("expected 1 participant, got %+v", rooms)
+	}
+
+	_, events = tr.Process(join("1000", "c.2", "1986", "Martin", "Admin", "Yes"))
+	if len(events) != 1 || !events[0].Participant.Admin || events[0].Count != 2 {
+		t.Errorf("expected admin 1986 to join, got %+v", events)
+	}
+
+	rooms, events = tr.Process(leave("1000", "c.1"))
+	if len(events) != 1 || events[0].Type != conference.EventLeft || events[0].Participant.Extension != "21" || events[0].Count != 1 {
+		t.Errorf("expected 21 to leave, got %+v", events)
+	}
+	if len(rooms) != 1 || len(rooms[0].Participants) != 1 || rooms[0].Participants[0].Extension != "1986" {
+		t.Errorf("expected only 1986 left, got %+v", rooms)
+	}
+
+	rooms, events = tr.Process(leave("1000", "c.2"))
+	if len(events) != 1 || len(rooms) != 1 || len(rooms[0].Participants) != 0 || !rooms[0].Started.IsZero() {
+		t.Errorf("expected the room to end, got %+v %+v", rooms, events)
+	}
+
+	rooms, events = tr.Process(ami.NewEvent("Event", "ConfBridgeEnd", "Conference", "1000"))
+	if len(rooms) != 0 || len(events) != 0 {
+		t.Errorf("expected nothing for an already empty room, got %+v %+v", rooms, events)
+	}
+}
+
+func TestTalkingAndMute(t *testing.T) {
+	tr := conference.NewTracker()
+	tr.Process(join("1000", "c.1", "21", "Kitchen"))
+
+	rooms, _ := tr.Process(ami.NewEvent("Event", "ConfBridgeTalking", "Conference", "1000", "Uniqueid", "c.1", "TalkingStatus", "on"))
+	if len(rooms) != 1 || !rooms[0].Participants[0].Talking {
+		t.Errorf("expected 21 talking, got %+v", rooms)
+	}
+	if rooms, _ := tr.Process(ami.NewEvent("Event", "ConfBridgeTalking", "Conference", "1000", "Uniqueid", "c.1", "TalkingStatus", "on")); len(rooms) != 0 {
+		t.Errorf("expected unchanged talking to be suppressed, got %+v", rooms)
+	}
+
+	rooms, _ = tr.Process(ami.NewEvent("Event", "ConfBridgeMute", "Conference", "1000", "Uniqueid", "c.1"))
+	if len(rooms) != 1 || !rooms[0].Participants[0].Muted {
+		t.Errorf("expected 21 muted, got %+v", rooms)
+	}
+	rooms, _ = tr.Process(ami.NewEvent("Event", "ConfBridgeUnmute", "Conference", "1000", "Uniqueid", "c.1"))
+	if len(rooms) != 1 || rooms[0].Participants[0].Muted {
+		t.Errorf("expected 21 unmuted, got %+v", rooms)
+	}
+
+	if rooms, _ := tr.Process(ami.NewEvent("Event", "ConfBridgeMute", "Conference", "1000", "Uniqueid", "c.9")); len(rooms) != 0 {
+		t.Errorf("expected unknown participant to be ignored, got %+v", rooms)
+	}
+}
+
+func TestEndLeavesEveryone(t *testing.T) {
+	tr := conference.NewTracker()
+	tr.Process(join("1000", "c.1", "21", "Kitchen"))
+	tr.Process(join("1000", "c.2", "1986", "Martin"))
+
+	rooms, events := tr.Process(ami.NewEvent("Event", "ConfBridgeEnd", "Conference", "1000"))
+	if len(events) != 2 || events[0].Type != conference.EventLeft {
+		t.Errorf("expected both participants to leave, got %+v", events)
+	}
+	if len(rooms) != 1 || len(rooms[0].Participants) != 0 {
+		t.Errorf("expected an empty room, got %+v", rooms)
+	}
+}
+
+func TestProcessIgnoresOtherEvents(t *testing.T) {
+	tr := conference.NewTracker()
+	if rooms, events := tr.Process(ami.NewEvent("Event", "Newchannel", "Conference", "1000")); len(rooms) != 0 || len(events) != 0 {
+		t.Errorf("expected nothing, got %+v %+v", rooms, events)
+	}
+	if rooms, events := tr.Process(join("", "c.1", "21", "Kitchen")); len(rooms) != 0 || len(events) != 0 {
+		t.Errorf("expected nothing without a conference, got %+v %+v", rooms, events)
+	}
+}
+
+func TestSeedFromConfbridgeList(t *testing.T) {
+	tr := conference.NewTracker()
+	tr.Process(join("1000", "c.1", "21", "Kitchen"))
+	tr.Process(join("2000", "c.5", "22", "Office"))
+
+	got := tr.Seed([]ami.Response{
+		{Events: []ami.Event{
+			ami.NewEvent("Event", "ConfbridgeList", "Conference", "1000", "Uniqueid", "c.1",
+				"CallerIDNum", "21", "CallerIDName", "Kitchen", "Admin", "No", "Muted", "No"),
+			ami.NewEvent("Event", "ConfbridgeListComplete", "EventList", "Complete"),
+		}},
+		{Events: []ami.Event{
+			ami.NewEvent("Event", "ConfbridgeList", "Conference", "3000", "Uniqueid", "c.7",
+				"CallerIDNum", "1986", "CallerIDName", "Martin", "Admin", "Yes", "Muted", "Yes", "Talking", "Yes"),
+		}},
+	})
+	// 1000 is unchanged, 2000 ended while disconnected and 3000 is new
+	if len(got) != 2 {
+		t.Fatalf("expected 2 rooms, got %+v", got)
+	}
+	if got[0].Name != "2000" || len(got[0].Participants) != 0 {
+		t.Errorf("expected 2000 to have ended, got %+v", got[0])
+	}
+	p := got[1].Participants
+	if got[1].Name != "3000" || len(p) != 1 || !p[0].Admin || !p[0].Muted || !p[0].Talking {
+		t.Errorf("unexpected room 3000 %+v", got[1])
+	}
+}
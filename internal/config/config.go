@@ -4,13 +4,21 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+	"github.com/sweeney/asterisk-mqtt/internal/topic"
 )
 
 type Config struct {
-	AMI  AMIConfig  `yaml:"ami"`
-	MQTT MQTTConfig `yaml:"mqtt"`
+	AMI   AMIConfig   `yaml:"ami"`
+	MQTT  MQTTConfig  `yaml:"mqtt"`
+	Calls CallsConfig `yaml:"calls"`
 }
 
 type AMIConfig struct {
@@ -24,6 +32,89 @@ type MQTTConfig struct {
 	Broker      string `yaml:"broker"`
 	ClientID    string `yaml:"client_id"`
 	TopicPrefix string `yaml:"topic_prefix"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+
+	TLS MQTTTLSConfig `yaml:"tls"`
+
+	// BufferSize messages are held in memory while the broker is
+	// unreachable; beyond that they go to SpoolDir, if set, or the oldest
+	// are dropped. The spool also keeps unsent messages across restarts.
+	BufferSize     int           `yaml:"buffer_size"`
+	SpoolDir       string        `yaml:"spool_dir"`
+	PublishTimeout time.Duration `yaml:"publish_timeout"`
+}
+
+// MQTTTLSConfig configures TLS for ssl://, mqtts:// and wss:// brokers.
+// Without a CA file the system roots are used.
+type MQTTTLSConfig struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// InsecureSkipVerify accepts any broker certificate. For lab use only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// mqttSchemes lists the broker URL schemes the MQTT client can dial, and
+// whether each is secured with TLS.
+var mqttSchemes = map[string]bool{
+	"tcp":   false,
+	"mqtt":  false,
+	"ws":    false,
+	"ssl":   true,
+	"tls":   true,
+	"mqtts": true,
+	"wss":   true,
+}
+
+// IsTLS reports whether the broker URL uses a TLS scheme.
+func (c *MQTTConfig) IsTLS() bool {
+	scheme, _, _ := strings.Cut(c.Broker, "://")
+	return mqttSchemes[strings.ToLower(scheme)]
+}
+
+// CallsConfig bounds how long a call may be tracked before it is presumed
+// to have ended without a Hangup event. Zero disables a limit.
+type CallsConfig struct {
+	MaxRinging  time.Duration `yaml:"max_ringing"`
+	MaxAnswered time.Duration `yaml:"max_answered"`
+
+	// LegEvents publishes the progress of each dialed destination, e.g.
+	// every phone in a hunt group, as well as the call as a whole.
+	LegEvents bool `yaml:"leg_events"`
+
+	// IdentityUpdates publishes an update when a party's caller ID changes
+	// mid-call, e.g. once a CID lookup has named the caller.
+	IdentityUpdates bool `yaml:"identity_updates"`
+
+	// StateTopics keeps each call's current state retained on its own
+	// topic while it is in progress, alongside the list of all calls.
+	StateTopics bool `yaml:"state_topics"`
+
+	// Topics replaces the topics call events are published to; see
+	// topic.DefaultRoutes for the layout used without it.
+	Topics []TopicRoute `yaml:"topics"`
+
+	// CauseDescriptions replaces the description published for a hangup
+	// cause, keyed by Q.850 code or cause name, e.g. to translate them.
+	CauseDescriptions map[string]string `yaml:"cause_descriptions"`
+}
+
+// TopicRoute publishes the call events listed in Events, or all of them,
+// to the topic rendered from the Topic template.
+type TopicRoute struct {
+	Topic  string   `yaml:"topic"`
+	Events []string `yaml:"events"`
+}
+
+// Routes converts the configured topic routes for topic.NewRouter.
+func (c *CallsConfig) Routes() []topic.Route {
+	var routes []topic.Route
+	for _, r := range c.Topics {
+		routes = append(routes, topic.Route{Template: r.Topic, Events: r.Events})
+	}
+	return routes
 }
 
 func (c *AMIConfig) Addr() string {
@@ -45,6 +136,13 @@ func Load(path string) (*Config, error) {
 			Broker:      "tcp://localhost:1883",
 			ClientID:    "asterisk-mqtt",
 			TopicPrefix: "asterisk",
+
+			BufferSize:     1000,
+			PublishTimeout: 5 * time.Second,
+		},
+		Calls: CallsConfig{
+			MaxRinging:  10 * time.Minute,
+			MaxAnswered: 12 * time.Hour,
 		},
 	}
 
@@ -72,8 +170,8 @@ func (c *Config) validate() error {
 	if c.AMI.Secret == "" {
 		return fmt.Errorf("ami.secret is required")
 	}
-	if c.MQTT.Broker == "" {
-		return fmt.Errorf("mqtt.broker is required")
+	if err := c.MQTT.validate(); err != nil {
+		return err
 	}
 	if c.MQTT.ClientID == "" {
 		return fmt.Errorf("mqtt.client_id is required")
@@ -81,5 +179,78 @@ func (c *Config) validate() error {
 	if c.MQTT.TopicPrefix == "" {
 		return fmt.Errorf("mqtt.topic_prefix is required")
 	}
+	if c.Calls.MaxRinging < 0 {
+		return fmt.Errorf("calls.max_ringing must not be negative, got %s", c.Calls.MaxRinging)
+	}
+	if c.Calls.MaxAnswered < 0 {
+		return fmt.Errorf("calls.max_answered must not be negative, got %s", c.Calls.MaxAnswered)
+	}
+	for i, route := range c.Calls.Routes() {
+		if err := topic.Validate(route); err != nil {
+			return fmt.Errorf("calls.topics[%d]: %w", i, err)
+		}
+	}
+	return c.Calls.validateCauseDescriptions()
+}
+
+func (c *MQTTConfig) validate() error {
+	if c.Broker == "" {
+		return fmt.Errorf("mqtt.broker is required")
+	}
+	scheme, _, ok := strings.Cut(c.Broker, "://")
+	if _, known := mqttSchemes[strings.ToLower(scheme)]; !ok || !known {
+		return fmt.Errorf("mqtt.broker must be a tcp://, mqtt://, ws://, ssl://, tls://, mqtts:// or wss:// URL, got %q", c.Broker)
+	}
+	if c.BufferSize < 1 {
+		return fmt.Errorf("mqtt.buffer_size must be at least 1, got %d", c.BufferSize)
+	}
+	if c.PublishTimeout <= 0 {
+		return fmt.Errorf("mqtt.publish_timeout must be positive, got %s", c.PublishTimeout)
+	}
+	if c.Password != "" && c.Username == "" {
+		return fmt.Errorf("mqtt.password requires mqtt.username")
+	}
+
+	tls := c.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("mqtt.tls.cert_file and mqtt.tls.key_file must be set together")
+	}
+	if tls != (MQTTTLSConfig{}) && !c.IsTLS() {
+		return fmt.Errorf("mqtt.tls requires an ssl://, tls://, mqtts:// or wss:// broker, got %q", c.Broker)
+	}
+	for _, f := range []struct{ name, path string }{
+		{"ca_file", tls.CAFile},
+		{"cert_file", tls.CertFile},
+		{"key_file", tls.KeyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("mqtt.tls.%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *CallsConfig) validateCauseDescriptions() error {
+	keys := make([]string, 0, len(c.CauseDescriptions))
+	for key := range c.CauseDescriptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if code, err := strconv.Atoi(key); err == nil {
+			if code < 0 || code > 127 {
+				return fmt.Errorf("calls.cause_descriptions: cause code must be between 0 and 127, got %d", code)
+			}
+		} else if !correlator.IsCauseName(key) {
+			return fmt.Errorf("calls.cause_descriptions: unknown cause %q", key)
+		}
+		if c.CauseDescriptions[key] == "" {
+			return fmt.Errorf("calls.cause_descriptions: description for %q is empty", key)
+		}
+	}
 	return nil
 }
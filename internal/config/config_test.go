@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func writeConfig(t *testing.T, content string) string {
@@ -67,6 +68,162 @@ ami:
 	if cfg.MQTT.TopicPrefix != "asterisk" {
 		t.Errorf("expected default topic_prefix=asterisk, got %s", cfg.MQTT.TopicPrefix)
 	}
+	if cfg.MQTT.BufferSize != 1000 {
+		t.Errorf("expected default buffer_size=1000, got %d", cfg.MQTT.BufferSize)
+	}
+	if cfg.MQTT.SpoolDir != "" {
+		t.Errorf("expected no spool_dir by default, got %s", cfg.MQTT.SpoolDir)
+	}
+	if cfg.MQTT.PublishTimeout != 5*time.Second {
+		t.Errorf("expected default publish_timeout=5s, got %s", cfg.MQTT.PublishTimeout)
+	}
+	if cfg.Calls.MaxRinging != 10*time.Minute {
+		t.Errorf("expected default max_ringing=10m, got %s", cfg.Calls.MaxRinging)
+	}
+	if cfg.Calls.MaxAnswered != 12*time.Hour {
+		t.Errorf("expected default max_answered=12h, got %s", cfg.Calls.MaxAnswered)
+	}
+	if cfg.Calls.LegEvents {
+		t.Error("expected leg_events to default to false")
+	}
+	if cfg.Calls.IdentityUpdates {
+		t.Error("expected identity_updates to default to false")
+	}
+	if cfg.Calls.StateTopics {
+		t.Error("expected state_topics to default to false")
+	}
+}
+
+func TestLoadCallLimits(t *testing.T) {
+	path := writeConfig(t, `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  max_ringing: 90s
+  max_answered: 0s
+  leg_events: true
+  identity_updates: true
+  state_topics: true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Calls.MaxRinging != 90*time.Second {
+		t.Errorf("expected max_ringing=90s, got %s", cfg.Calls.MaxRinging)
+	}
+	if cfg.Calls.MaxAnswered != 0 {
+		t.Errorf("expected max_answered=0 (disabled), got %s", cfg.Calls.MaxAnswered)
+	}
+	if !cfg.Calls.LegEvents {
+		t.Error("expected leg_events=true")
+	}
+	if !cfg.Calls.IdentityUpdates {
+		t.Error("expected identity_updates=true")
+	}
+	if !cfg.Calls.StateTopics {
+		t.Error("expected state_topics=true")
+	}
+}
+
+func TestLoadCauseDescriptions(t *testing.T) {
+	path := writeConfig(t, `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  cause_descriptions:
+    "17": La ligne est occupée
+    cancelled: L'appelant a raccroché
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Calls.CauseDescriptions["17"]; got != "La ligne est occupée" {
+		t.Errorf("unexpected description for 17: %q", got)
+	}
+	if got := cfg.Calls.CauseDescriptions["cancelled"]; got != "L'appelant a raccroché" {
+		t.Errorf("unexpected description for cancelled: %q", got)
+	}
+}
+
+func TestLoadMQTTTLS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ca.pem", "client.crt", "client.key"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := writeConfig(t, `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: mqtts://broker:8883
+  username: bridge
+  password: hunter2
+  tls:
+    ca_file: `+filepath.Join(dir, "ca.pem")+`
+    cert_file: `+filepath.Join(dir, "client.crt")+`
+    key_file: `+filepath.Join(dir, "client.key")+`
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MQTT.Username != "bridge" || cfg.MQTT.Password != "hunter2" {
+		t.Errorf("expected credentials bridge/hunter2, got %s/%s", cfg.MQTT.Username, cfg.MQTT.Password)
+	}
+	if cfg.MQTT.TLS.CertFile != filepath.Join(dir, "client.crt") {
+		t.Errorf("expected cert_file in %s, got %s", dir, cfg.MQTT.TLS.CertFile)
+	}
+	if !cfg.MQTT.IsTLS() {
+		t.Error("expected mqtts:// to be a TLS broker")
+	}
+}
+
+func TestMQTTIsTLS(t *testing.T) {
+	for broker, want := range map[string]bool{
+		"tcp://localhost:1883":  false,
+		"ws://localhost:9001":   false,
+		"ssl://broker:8883":     true,
+		"MQTTS://broker:8883":   true,
+		"wss://broker:443/mqtt": true,
+	} {
+		cfg := MQTTConfig{Broker: broker}
+		if got := cfg.IsTLS(); got != want {
+			t.Errorf("%s: expected IsTLS=%v, got %v", broker, want, got)
+		}
+	}
+}
+
+func TestLoadTopics(t *testing.T) {
+	path := writeConfig(t, `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  topics:
+    - topic: "{prefix}/extension/{to.extension}/{event}"
+    - topic: "{prefix}/events"
+      events: [ringing, answered, hungup]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	routes := cfg.Calls.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].Template != "{prefix}/extension/{to.extension}/{event}" || len(routes[0].Events) != 0 {
+		t.Errorf("unexpected first route %+v", routes[0])
+	}
+	if routes[1].Template != "{prefix}/events" || len(routes[1].Events) != 3 {
+		t.Errorf("unexpected second route %+v", routes[1])
+	}
 }
 
 func TestLoadMissingFile(t *testing.T) {
@@ -137,6 +294,141 @@ ami:
 mqtt:
   topic_prefix: ""
 `, "mqtt.topic_prefix is required"},
+		{"negative max_ringing", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  max_ringing: -1m
+`, "calls.max_ringing must not be negative, got -1m0s"},
+		{"negative max_answered", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  max_answered: -1h
+`, "calls.max_answered must not be negative, got -1h0m0s"},
+		{"cause code out of range", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  cause_descriptions:
+    "128": Hors plage
+`, "calls.cause_descriptions: cause code must be between 0 and 127, got 128"},
+		{"unknown cause name", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  cause_descriptions:
+    user_bussy: Occupé
+`, `calls.cause_descriptions: unknown cause "user_bussy"`},
+		{"empty cause description", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  cause_descriptions:
+    "17": ""
+`, `calls.cause_descriptions: description for "17" is empty`},
+		{"unknown broker scheme", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: http://localhost:1883
+`, `mqtt.broker must be a tcp://, mqtt://, ws://, ssl://, tls://, mqtts:// or wss:// URL, got "http://localhost:1883"`},
+		{"broker without scheme", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: localhost:1883
+`, `mqtt.broker must be a tcp://, mqtt://, ws://, ssl://, tls://, mqtts:// or wss:// URL, got "localhost:1883"`},
+		{"zero buffer_size", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  buffer_size: 0
+`, "mqtt.buffer_size must be at least 1, got 0"},
+		{"zero publish_timeout", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  publish_timeout: 0s
+`, "mqtt.publish_timeout must be positive, got 0s"},
+		{"password without username", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  password: s3cret
+`, "mqtt.password requires mqtt.username"},
+		{"cert without key", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: ssl://broker:8883
+  tls:
+    cert_file: /etc/ssl/client.crt
+`, "mqtt.tls.cert_file and mqtt.tls.key_file must be set together"},
+		{"key without cert", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: ssl://broker:8883
+  tls:
+    key_file: /etc/ssl/client.key
+`, "mqtt.tls.cert_file and mqtt.tls.key_file must be set together"},
+		{"tls with plain broker", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: tcp://broker:1883
+  tls:
+    insecure_skip_verify: true
+`, `mqtt.tls requires an ssl://, tls://, mqtts:// or wss:// broker, got "tcp://broker:1883"`},
+		{"missing ca file", `
+ami:
+  username: admin
+  secret: s3cret
+mqtt:
+  broker: mqtts://broker:8883
+  tls:
+    ca_file: /nonexistent/ca.pem
+`, "mqtt.tls.ca_file: stat /nonexistent/ca.pem: no such file or directory"},
+		{"unknown topic placeholder", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  topics:
+    - topic: "{prefix}/events"
+    - topic: "{prefix}/extension/{to.ext}/{event}"
+`, `calls.topics[1]: topic "{prefix}/extension/{to.ext}/{event}": unknown placeholder {to.ext}`},
+		{"unknown topic event", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  topics:
+    - topic: "{prefix}/events"
+      events: [rung]
+`, `calls.topics[0]: topic "{prefix}/events": unknown event "rung"`},
+		{"empty topic", `
+ami:
+  username: admin
+  secret: s3cret
+calls:
+  topics:
+    - events: [hungup]
+`, `calls.topics[0]: topic template is empty`},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,150 @@
+package correlator
+
+import "strconv"
+
+// CauseCategory is a coarse grouping of hangup causes by who is
+// responsible for them.
+type CauseCategory string
+
+const (
+	// CauseUser means the parties ended or declined the call.
+	CauseUser CauseCategory = "user"
+	// CauseNetwork means a trunk, network or protocol failure.
+	CauseNetwork CauseCategory = "network"
+	// CauseConfig means the number, route or service isn't set up to
+	// allow the call.
+	CauseConfig CauseCategory = "config"
+)
+
+// CauseInfo describes a hangup cause.
+type CauseInfo struct {
+	Code        int
+	Name        string
+	Description string
+	Category    CauseCategory
+}
+
+// HangupCause maps Q.850 cause codes, as reported by Asterisk, to names
+// and descriptions.
+var HangupCause = map[int]CauseInfo{
+	0:   {0, "unknown", "Unknown or no cause provided", ""},
+	1:   {1, "unallocated_number", "The number dialed does not exist", CauseConfig},
+	2:   {2, "no_route_transit_net", "There is no route to the network the call must pass through", CauseNetwork},
+	3:   {3, "no_route_destination", "There is no route to the destination", CauseNetwork},
+	5:   {5, "misdialled_trunk_prefix", "The trunk prefix was dialed incorrectly", CauseConfig},
+	6:   {6, "channel_unacceptable", "The channel offered for the call was not acceptable", CauseNetwork},
+	7:   {7, "call_awarded_delivered", "The call was delivered over an already established channel", CauseNetwork},
+	8:   {8, "pre_empted", "The call was pre-empted", CauseNetwork},
+	14:  {14, "number_ported_not_here", "The number has been ported to another network", CauseConfig},
+	16:  {16, "normal_clearing", "The call was hung up normally by one of the parties", CauseUser},
+	17:  {17, "user_busy", "The destination was busy", CauseUser},
+	18:  {18, "no_answer", "The destination did not answer", CauseUser},
+	19:  {19, "no_answer", "The destination did not answer within the timeout", CauseUser},
+	20:  {20, "subscriber_absent", "The destination is not registered or cannot be reached", CauseUser},
+	21:  {21, "call_rejected", "The call was rejected by the destination", CauseUser},
+	22:  {22, "number_changed", "The number dialed has changed", CauseConfig},
+	23:  {23, "redirected_to_new_destination", "The call was redirected to a new destination", CauseConfig},
+	26:  {26, "answered_elsewhere", "The call was answered by another destination", CauseUser},
+	27:  {27, "destination_out_of_order", "The destination is out of order", CauseNetwork},
+	28:  {28, "invalid_number_format", "The number dialed is incomplete or badly formatted", CauseConfig},
+	29:  {29, "facility_rejected", "A requested network service was rejected", CauseConfig},
+	30:  {30, "response_to_status_enquiry", "The call ended in response to a status enquiry", CauseNetwork},
+	31:  {31, "normal_unspecified", "Normal call clearing, unspecified cause", CauseUser},
+	34:  {34, "congestion", "All circuits are busy or no circuit is available", CauseNetwork},
+	38:  {38, "network_out_of_order", "The network is out of order", CauseNetwork},
+	41:  {41, "normal_temporary_failure", "The network failed temporarily", CauseNetwork},
+	42:  {42, "switch_congestion", "The switching equipment is congested", CauseNetwork},
+	43:  {43, "access_info_discarded", "Network access information was discarded", CauseNetwork},
+	44:  {44, "requested_chan_unavail", "The requested circuit or channel is not available", CauseNetwork},
+	50:  {50, "facility_not_subscribed", "The requested network service is not subscribed to", CauseConfig},
+	52:  {52, "outgoing_call_barred", "Outgoing calls are barred", CauseConfig},
+	54:  {54, "incoming_call_barred", "Incoming calls are barred at the destination", CauseConfig},
+	57:  {57, "bearercapability_notauth", "The call type is not authorized", CauseConfig},
+	58:  {58, "bearercapability_notavail", "The call type is not currently available", CauseConfig},
+	65:  {65, "bearercapability_notimpl", "The call type is not implemented", CauseConfig},
+	66:  {66, "chan_not_implemented", "The channel type is not implemented", CauseConfig},
+	69:  {69, "facility_not_implemented", "The requested network service is not implemented", CauseConfig},
+	81:  {81, "invalid_call_reference", "The call reference was invalid", CauseNetwork},
+	88:  {88, "incompatible_destination", "The destination cannot accept this type of call", CauseConfig},
+	95:  {95, "invalid_msg_unspecified", "An invalid message was received", CauseNetwork},
+	96:  {96, "mandatory_ie_missing", "A message was missing a mandatory element", CauseNetwork},
+	97:  {97, "message_type_nonexist", "A message of an unknown type was received", CauseNetwork},
+	98:  {98, "wrong_message", "A message was received that was not valid in the call state", CauseNetwork},
+	99:  {99, "ie_nonexist", "A message contained an unknown element", CauseNetwork},
+	100: {100, "invalid_ie_contents", "A message contained an invalid element", CauseNetwork},
+	101: {101, "wrong_call_state", "A message was received that was not valid in the call state", CauseNetwork},
+	102: {102, "recovery_on_timer_expire", "A protocol timer expired", CauseNetwork},
+	103: {103, "mandatory_ie_length_error", "A message element had an invalid length", CauseNetwork},
+	111: {111, "protocol_error", "A protocol error occurred", CauseNetwork},
+	127: {127, "interworking", "An interworking error occurred", CauseNetwork},
+}
+
+// syntheticCauses are the causes the correlator reports itself, for calls
+// whose end it inferred rather than read from a Hangup event.
+var syntheticCauses = map[string]CauseInfo{
+	"cancelled":          {Name: "cancelled", Description: "The call was cancelled by the caller before being answered", Category: CauseUser},
+	"transferred":        {Name: "transferred", Description: "The call was joined to another call by an attended transfer", Category: CauseUser},
+	"picked_up":          {Name: "picked_up", Description: "The call picked up another ringing call and continues as that call", Category: CauseUser},
+	"unparked":           {Name: "unparked", Description: "The call retrieved a parked call and continues as that call", Category: CauseUser},
+	"lost":               {Name: "lost", Description: "The call ended while the bridge was disconnected from Asterisk"},
+	"expired":            {Name: "expired", Description: "The call was dropped after exceeding the maximum call age"},
+	"asterisk_restarted": {Name: "asterisk_restarted", Description: "Asterisk restarted while the call was in progress"},
+	"asterisk_shutdown":  {Name: "asterisk_shutdown", Description: "Asterisk shut down while the call was in progress"},
+}
+
+// LookupCause returns the cause for a Q.850 code. Codes outside the table
+// are reported as "unknown", keeping the code.
+func LookupCause(code int) CauseInfo {
+	if info, ok := HangupCause[code]; ok {
+		return info
+	}
+	info := HangupCause[0]
+	info.Code = code
+	return info
+}
+
+// IsCauseName reports whether name is a cause the correlator can report,
+// either from the Q.850 table or one of its own.
+func IsCauseName(name string) bool {
+	if _, ok := syntheticCauses[name]; ok {
+		return true
+	}
+	for _, info := range HangupCause {
+		if info.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCauseDescriptions overrides the description reported for hangup
+// causes, e.g. to translate them. Keys are either a Q.850 code ("17") or
+// a cause name ("user_busy", "cancelled"); a code takes precedence over
+// the name it shares with other codes.
+func WithCauseDescriptions(descriptions map[string]string) Option {
+	return func(corr *Correlator) {
+		corr.causeCodeText = map[int]string{}
+		corr.causeNameText = map[string]string{}
+		for key, text := range descriptions {
+			if code, err := strconv.Atoi(key); err == nil {
+				corr.causeCodeText[code] = text
+			} else {
+				corr.causeNameText[key] = text
+			}
+		}
+	}
+}
+
+// describe returns info's description, or its configured override.
+// Synthetic causes have no code, so only their name is matched.
+func (c *Correlator) describe(info CauseInfo, fromCode bool) string {
+	if fromCode {
+		if text, ok := c.causeCodeText[info.Code]; ok {
+			return text
+		}
+	}
+	if text, ok := c.causeNameText[info.Name]; ok {
+		return text
+	}
+	return info.Description
+}
@@ -11,28 +11,131 @@ type Clock func() time.Time
 
 // callState tracks the internal state of an in-progress call.
 type callState struct {
-	linkedID   string
-	from       Endpoint
-	to         Endpoint
-	ringTime   time.Time
-	answerTime time.Time
-	answered   bool
-	rung       bool
-	cancelled  bool // DialEnd with DialStatus=CANCEL seen
+	linkedID    string
+	from        Endpoint
+	fromChannel string // Uniqueid of the channel of the party in from
+	to          Endpoint
+	createdAt   time.Time
+	ringTime    time.Time
+	answerTime  time.Time
+	answered    bool
+	rung        bool
+	cancelled   bool // DialEnd with DialStatus=CANCEL seen
+	voicemail   bool // picked up by the VoiceMail application
+	mailbox     string
+
+	answerChannel string // Uniqueid of the channel whose answer answered the call
+	stale         bool   // tracked across an AMI disconnect, not yet confirmed
+
+	pendingAnswer *CallStateChange // the dialplan's own answer, not yet published; see releaseAnswer
+
+	queue     string // app_queue queue the call entered
+	queueJoin time.Time
+	queueWait time.Duration
+	queued    bool // waiting in the queue; not answered until an agent connects
+	abandoned bool // caller gave up waiting in the queue
+	leftQueue bool // left the queue without an agent answering, e.g. it timed out
+
+	parked bool // ends when the last channel hangs up, like transferred
+
+	channels    map[string]bool // Uniqueids of live channels in this call
+	bridgedIn   map[string]bool // channels known only from BridgeEnter; see handleBridgeLeave
+	transferred bool            // ends when the last channel hangs up
+
+	held      bool
+	holdStart time.Time
+	holdTotal time.Duration // completed holds
+	holdCount int
+
+	dests       []*dialDest // every destination dialed, in DialBegin order
+	answeredBy  *dialDest   // the destination that picked up
+	pickedUpBy  *Endpoint   // who answered in place of a destination by call pickup
+	toNameGuess bool        // to.Name came from a DialBegin for another extension
+
+	state CallState // as last reported; see Calls
+	since time.Time // when state was entered
+}
+
+// dialDest is one destination channel dialed for a call, e.g. one
+// member of a hunt group.
+type dialDest struct {
+	uniqueID string
+	channel  string // channel name at DialBegin; see pickedUp
+	endpoint Endpoint
+	rung     bool
+	state    LegState // last state reported by leg events
+}
+
+// dest returns the dialed destination with the given channel Uniqueid.
+func (cs *callState) dest(uniqueID string) *dialDest {
+	for _, d := range cs.dests {
+		if d.uniqueID == uniqueID {
+			return d
+		}
+	}
+	return nil
+}
+
+// answeredByEndpoint returns the endpoint that answered, or nil if unknown.
+func (cs *callState) answeredByEndpoint() *Endpoint {
+	if cs.pickedUpBy != nil {
+		ep := *cs.pickedUpBy
+		return &ep
+	}
+	if cs.answeredBy == nil {
+		return nil
+	}
+	ep := cs.answeredBy.endpoint
+	return &ep
+}
+
+// missedBy lists destinations that rang but did not answer. A destination
+// whose call was picked up from another phone didn't answer either.
+func (cs *callState) missedBy() []Endpoint {
+	var missed []Endpoint
+	for _, d := range cs.dests {
+		if d.rung && (d != cs.answeredBy || cs.pickedUpBy != nil) {
+			missed = append(missed, d.endpoint)
+		}
+	}
+	return missed
+}
+
+func (cs *callState) addChannel(uniqueID string) {
+	if uniqueID != "" {
+		cs.channels[uniqueID] = true
+		delete(cs.bridgedIn, uniqueID)
+	}
 }
 
 // Correlator tracks AMI events and emits CallStateChange structs
 // when calls transition between lifecycle states.
 type Correlator struct {
-	calls map[string]*callState // keyed by Linkedid
-	clock Clock
+	calls   map[string]*callState // keyed by Linkedid
+	aliases map[string]string     // Linkedid merged into another call -> that call's ID
+	clock   Clock
+
+	clockOffset time.Duration // how far the clock is ahead of Asterisk's; see now
+
+	onDecision     func(Decision)
+	sessionEndedAt time.Time // when the last AMI session was lost
+
+	maxRinging  time.Duration // see WithMaxRinging
+	maxAnswered time.Duration // see WithMaxAnswered
+	legEvents   bool          // see WithLegEvents
+
+	identityUpdates bool // see WithIdentityUpdates
+
+	causeCodeText map[int]string    // see WithCauseDescriptions
+	causeNameText map[string]string // see WithCauseDescriptions
 }
 
 // New creates a new Correlator.
 func New() *Correlator {
 	return &Correlator{
-		calls: make(map[string]*callState),
-		clock: time.Now,
+		calls:   make(map[string]*callState),
+		aliases: make(map[string]string),
+		clock:   time.Now,
 	}
 }
 
@@ -55,24 +158,85 @@ func NewWithOptions(opts ...Option) *Correlator {
 
 // Process ingests an AMI event and returns any resulting state changes.
 func (c *Correlator) Process(evt ami.Event) []CallStateChange {
+	if ts := evt.Timestamp(); !ts.IsZero() {
+		c.clockOffset = c.clock().Sub(ts)
+	}
+	return c.record(c.process(evt))
+}
+
+func (c *Correlator) process(evt ami.Event) []CallStateChange {
 	if evt.IsResponse() {
 		return nil
 	}
 
-	linkedID := evt.Get("Linkedid")
+	switch evt.Type() {
+	case "FullyBooted":
+		return c.handleFullyBooted(evt)
+	case "Shutdown":
+		return c.handleShutdown(evt)
+	case "BlindTransfer":
+		return c.handleBlindTransfer(evt)
+	case "AttendedTransfer":
+		return c.handleAttendedTransfer(evt)
+	case "Pickup":
+		return c.handlePickup(evt)
+	case "ParkedCall":
+		return c.handleParkedCall(evt)
+	case "UnParkedCall":
+		return c.handleUnParkedCall(evt)
+	case "ParkedCallTimeOut":
+		return c.handleParkedCallEnd(evt, UnparkTimeout)
+	case "ParkedCallGiveUp":
+		return c.handleParkedCallEnd(evt, UnparkGaveUp)
+	}
+
+	linkedID := c.resolve(evt.Get("Linkedid"))
 	if linkedID == "" {
 		return nil
 	}
+	var changes []CallStateChange
+	if cs := c.calls[linkedID]; cs != nil {
+		c.confirm(cs)
+		changes = cs.releaseAnswer(evt)
+	}
+	return append(changes, c.processCall(evt, linkedID)...)
+}
 
+// processCall handles the events that belong to a single call.
+func (c *Correlator) processCall(evt ami.Event, linkedID string) []CallStateChange {
 	switch evt.Type() {
 	case "Newchannel":
 		return c.handleNewchannel(evt, linkedID)
 	case "DialBegin":
 		return c.handleDialBegin(evt, linkedID)
+	case "DialState":
+		return c.handleDialState(evt, linkedID)
 	case "Newstate":
 		return c.handleNewstate(evt, linkedID)
 	case "DialEnd":
 		return c.handleDialEnd(evt, linkedID)
+	case "BridgeEnter":
+		return c.handleBridgeEnter(evt, linkedID)
+	case "BridgeLeave":
+		return c.handleBridgeLeave(evt, linkedID)
+	case "Newexten", "VarSet":
+		return c.handleDialplanApp(evt, linkedID)
+	case "QueueCallerJoin":
+		return c.handleQueueCallerJoin(evt, linkedID)
+	case "QueueCallerAbandon":
+		return c.handleQueueCallerAbandon(evt, linkedID)
+	case "QueueCallerLeave":
+		return c.handleQueueCallerLeave(evt, linkedID)
+	case "AgentConnect":
+		return c.handleAgentConnect(evt, linkedID)
+	case "NewCallerid":
+		return c.handleNewCallerid(evt, linkedID)
+	case "NewConnectedLine":
+		return c.handleNewConnectedLine(evt, linkedID)
+	case "Hold":
+		return c.handleHold(evt, linkedID)
+	case "Unhold":
+		return c.handleUnhold(evt, linkedID)
 	case "Hangup":
 		return c.handleHangup(evt, linkedID)
 	default:
@@ -80,18 +244,59 @@ func (c *Correlator) Process(evt ami.Event) []CallStateChange {
 	}
 }
 
+// eventTime returns when Asterisk generated evt, falling back to the clock
+// for events without a Timestamp header (timestampevents=no).
+func (c *Correlator) eventTime(evt ami.Event) time.Time {
+	if ts := evt.Timestamp(); !ts.IsZero() {
+		return ts
+	}
+	return c.clock()
+}
+
+// now returns the current time on the clock event times come from:
+// Asterisk's, as of the last event with a Timestamp, plus the time passed
+// on our clock since. Comparing call times with the clock directly would
+// be thrown out by any skew between the two hosts, or by a stalled or
+// replayed event stream.
+func (c *Correlator) now() time.Time {
+	return c.clock().Add(-c.clockOffset)
+}
+
 // ActiveCalls returns the number of calls currently being tracked.
 func (c *Correlator) ActiveCalls() int {
 	return len(c.calls)
 }
 
+// resolve maps a Linkedid to the ID of the call it belongs to, following
+// any merge made by an attended transfer.
+func (c *Correlator) resolve(linkedID string) string {
+	if id, ok := c.aliases[linkedID]; ok {
+		return id
+	}
+	return linkedID
+}
+
+// remove stops tracking a call, along with any Linkedids merged into it.
+func (c *Correlator) remove(callID string) {
+	delete(c.calls, callID)
+	for alias, id := range c.aliases {
+		if id == callID {
+			delete(c.aliases, alias)
+		}
+	}
+}
+
 func (c *Correlator) handleNewchannel(evt ami.Event, linkedID string) []CallStateChange {
-	if _, exists := c.calls[linkedID]; exists {
+	if cs, exists := c.calls[linkedID]; exists {
+		cs.addChannel(evt.Get("Uniqueid"))
 		return nil
 	}
 
 	c.calls[linkedID] = &callState{
-		linkedID: linkedID,
+		linkedID:    linkedID,
+		createdAt:   c.eventTime(evt),
+		channels:    map[string]bool{evt.Get("Uniqueid"): true},
+		fromChannel: evt.Get("Uniqueid"),
 		from: Endpoint{
 			Extension: evt.Get("CallerIDNum"),
 			Name:      evt.Get("CallerIDName"),
@@ -108,12 +313,45 @@ func (c *Correlator) handleDialBegin(evt ami.Event, linkedID string) []CallState
 	if cs == nil {
 		return nil
 	}
-	if cs.to.Name == "" {
-		if name := evt.Get("DestCallerIDName"); name != "" {
-			cs.to.Name = name
-		}
+
+	d := &dialDest{
+		uniqueID: evt.Get("DestUniqueid"),
+		channel:  evt.Get("DestChannel"),
+		endpoint: Endpoint{
+			Extension: evt.Get("DestCallerIDNum"),
+			Name:      evt.Get("DestCallerIDName"),
+		},
 	}
-	return nil
+	cs.dests = append(cs.dests, d)
+
+	// The dialed extension's name is only known for sure when a destination
+	// has that extension. Otherwise borrow the first destination's name,
+	// and drop it again if more turn up — it was a group, not a phone.
+	switch {
+	case d.endpoint.Extension == cs.to.Extension && d.endpoint.Name != "":
+		cs.to.Name = d.endpoint.Name
+		cs.toNameGuess = false
+	case cs.to.Name == "" && len(cs.dests) == 1:
+		cs.to.Name = d.endpoint.Name
+		cs.toNameGuess = true
+	case cs.toNameGuess:
+		cs.to.Name = ""
+		cs.toNameGuess = false
+	}
+	return c.setLegState(cs, d, LegDialing, evt)
+}
+
+func (c *Correlator) handleDialState(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+	d := cs.dest(evt.Get("DestUniqueid"))
+	if d == nil || evt.Get("DialStatus") != "RINGING" {
+		return nil
+	}
+	d.rung = true
+	return c.setLegState(cs, d, LegRinging, evt)
 }
 
 func (c *Correlator) handleNewstate(evt ami.Event, linkedID string) []CallStateChange {
@@ -123,10 +361,15 @@ func (c *Correlator) handleNewstate(evt ami.Event, linkedID string) []CallStateC
 	}
 
 	stateDesc := evt.Get("ChannelStateDesc")
-	now := c.clock()
+	now := c.eventTime(evt)
+
+	d := cs.dest(evt.Get("Uniqueid"))
 
 	switch stateDesc {
 	case "Ringing":
+		if d != nil {
+			d.rung = true
+		}
 		if cs.rung {
 			return nil
 		}
@@ -141,35 +384,116 @@ func (c *Correlator) handleNewstate(evt ami.Event, linkedID string) []CallStateC
 		}}
 
 	case "Up":
-		if cs.answered {
+		if cs.answered || cs.voicemail || cs.queued {
 			return nil
 		}
-		cs.answered = true
-		cs.answerTime = now
-		ringDur := 0.0
-		if !cs.ringTime.IsZero() {
-			ringDur = now.Sub(cs.ringTime).Seconds()
+		uniqueID := evt.Get("Uniqueid")
+		if d == nil && uniqueID == cs.fromChannel && len(cs.dests) == 0 {
+			// The dialplan answered the caller itself, perhaps to queue
+			// the call; see releaseAnswer.
+			change := cs.answer(now, uniqueID, nil)
+			cs.pendingAnswer = &change
+			return nil
 		}
-		return []CallStateChange{{
-			State:        StateAnswered,
-			CallID:       linkedID,
-			From:         cs.from,
-			To:           cs.to,
-			RingDuration: ringDur,
-			Timestamp:    now,
-		}}
+		if d != nil {
+			if picker, ok := pickedUp(d, evt); ok {
+				cs.setPickedUp(picker)
+			}
+		}
+		return []CallStateChange{cs.answer(now, uniqueID, d)}
 	}
 
 	return nil
 }
 
+// answer marks the call answered by the channel uniqueID, which is the
+// destination d if one was dialed, and returns the answered change.
+func (cs *callState) answer(now time.Time, uniqueID string, d *dialDest) CallStateChange {
+	cs.answered = true
+	cs.answerTime = now
+	cs.answerChannel = uniqueID
+	if d != nil {
+		cs.answeredBy = d
+	}
+	ringDur := 0.0
+	if !cs.ringTime.IsZero() {
+		ringDur = now.Sub(cs.ringTime).Seconds()
+	}
+	return CallStateChange{
+		State:        StateAnswered,
+		CallID:       cs.linkedID,
+		From:         cs.from,
+		To:           cs.to,
+		AnsweredBy:   cs.answeredByEndpoint(),
+		MissedBy:     cs.missedBy(),
+		PickedUpBy:   cs.pickedUpByEndpoint(),
+		RingDuration: ringDur,
+		Timestamp:    now,
+	}
+}
+
 func (c *Correlator) handleDialEnd(evt ami.Event, linkedID string) []CallStateChange {
 	cs := c.calls[linkedID]
 	if cs == nil {
 		return nil
 	}
-	if evt.Get("DialStatus") == "CANCEL" {
+	status := evt.Get("DialStatus")
+	d := cs.dest(evt.Get("DestUniqueid"))
+	switch status {
+	case "CANCEL":
 		cs.cancelled = true
+	case "ANSWER":
+		if d != nil && cs.answeredBy == nil {
+			cs.answeredBy = d
+		}
+	}
+	if d == nil {
+		return nil
+	}
+	return c.setLegState(cs, d, dialEndLegState(cs, d, status), evt)
+}
+
+// handleBridgeEnter adopts channels that join a tracked call's bridge
+// without a Newchannel we saw, such as the new leg of a blind transfer
+// created before the transfer was reported. It also settles who answered
+// when that wasn't clear from Newstate or DialEnd, and fills in the
+// transfer target's name once its channel is connected.
+func (c *Correlator) handleBridgeEnter(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+	uniqueID := evt.Get("Uniqueid")
+	adopted := uniqueID != "" && !cs.channels[uniqueID]
+	cs.addChannel(uniqueID)
+	if adopted {
+		if cs.bridgedIn == nil {
+			cs.bridgedIn = map[string]bool{}
+		}
+		cs.bridgedIn[uniqueID] = true
+	}
+
+	if d := cs.dest(uniqueID); d != nil && cs.answered && cs.answeredBy == nil {
+		cs.answeredBy = d
+	}
+	if cs.transferred && cs.to.Name == "" && evt.Get("CallerIDNum") == cs.to.Extension {
+		cs.to.Name = evt.GetKnown("CallerIDName")
+	}
+	return nil
+}
+
+// handleBridgeLeave lets go of a channel that handleBridgeEnter adopted
+// once it leaves the bridge, e.g. a Local channel optimized out of a
+// transfer's new leg, so that it no longer keeps the call alive.
+func (c *Correlator) handleBridgeLeave(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+	uniqueID := evt.Get("Uniqueid")
+	if cs.bridgedIn[uniqueID] {
+		delete(cs.bridgedIn, uniqueID)
+		delete(cs.channels, uniqueID)
 	}
 	return nil
 }
@@ -180,23 +504,29 @@ func (c *Correlator) handleHangup(evt ami.Event, linkedID string) []CallStateCha
 		return nil
 	}
 
-	// Only emit hangup once — on the first Hangup event for this call
 	uniqueID := evt.Get("Uniqueid")
-	if uniqueID != linkedID {
+	delete(cs.channels, uniqueID)
+
+	// Only emit hangup once — on the first Hangup event for this call.
+	// A transferred or parked call may have lost its originating channel,
+	// so it ends with its last remaining channel instead.
+	if cs.transferred || cs.parked {
+		if len(cs.channels) > 0 {
+			return nil
+		}
+	} else if uniqueID != linkedID {
 		return nil
 	}
 
-	now := c.clock()
+	now := c.eventTime(evt)
 	causeCode := evt.GetInt("Cause")
+	cs.endHold(now)
 
-	causeName := "unknown"
-	causeDesc := "Unknown or no cause provided"
-	if cs.cancelled && !cs.answered {
-		causeName = "cancelled"
-		causeDesc = "The call was cancelled by the caller before being answered"
-	} else if info, ok := HangupCause[causeCode]; ok {
-		causeName = info.Name
-		causeDesc = info.Description
+	cause := LookupCause(causeCode)
+	causeDesc := c.describe(cause, true)
+	if cs.cancelled && !cs.answered && !cs.voicemail {
+		cause = syntheticCauses["cancelled"]
+		causeDesc = c.describe(cause, false)
 	}
 
 	talkDur := 0.0
@@ -213,14 +543,24 @@ func (c *Correlator) handleHangup(evt ami.Event, linkedID string) []CallStateCha
 		CallID:           linkedID,
 		From:             cs.from,
 		To:               cs.to,
-		Cause:            causeName,
+		AnsweredBy:       cs.answeredByEndpoint(),
+		MissedBy:         cs.missedBy(),
+		PickedUpBy:       cs.pickedUpByEndpoint(),
+		Mailbox:          cs.mailbox,
+		Queue:            cs.queue,
+		QueueWait:        cs.queueWait.Seconds(),
+		Outcome:          cs.outcome(causeCode),
+		Cause:            cause.Name,
 		CauseDescription: causeDesc,
+		CauseCategory:    cause.Category,
 		CauseCode:        causeCode,
 		TalkDuration:     talkDur,
 		TotalDuration:    totalDur,
+		HoldDuration:     cs.holdTotal.Seconds(),
+		HoldCount:        cs.holdCount,
 		Timestamp:        now,
 	}
 
-	delete(c.calls, linkedID)
+	c.remove(linkedID)
 	return []CallStateChange{change}
 }
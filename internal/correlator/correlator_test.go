@@ -495,3 +495,2183 @@ func assertTo(t *testing.T, c correlator.CallStateChange, ext string) {
 		t.Errorf("expected to.extension=%s, got %s", ext, c.To.Extension)
 	}
 }
+
+// --- Resync after reconnect (CoreShowChannels snapshot) ---
+
+func coreShowChannel(linkedID, uniqueID, callerNum, callerName, state, duration string, extra ...string) ami.Event {
+	kvs := []string{
+		"Event", "CoreShowChannel",
+		"Uniqueid", uniqueID, "Linkedid", linkedID,
+		"CallerIDNum", callerNum, "CallerIDName", callerName,
+		"ChannelStateDesc", state, "Duration", duration,
+	}
+	return ami.NewEvent(append(kvs, extra...)...)
+}
+
+func TestResyncEmitsLostHangupForVanishedCalls(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	c.Process(ami.NewEvent("Event", "Newchannel",
+		"CallerIDNum", "1986", "CallerIDName", "Martin",
+		"Exten", "21", "Uniqueid", "gone.1", "Linkedid", "gone.1"))
+	c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Ringing", "Uniqueid", "gone.2", "Linkedid", "gone.1"))
+
+	now = now.Add(20 * time.Second)
+	changes := c.Resync(nil)
+
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	if changes[0].State != correlator.StateHungUp || changes[0].CallID != "gone.1" {
+		t.Errorf("expected hungup for gone.1, got %s for %s", changes[0].State, changes[0].CallID)
+	}
+	if changes[0].Cause != "lost" {
+		t.Errorf("expected cause=lost, got %s", changes[0].Cause)
+	}
+	if changes[0].CauseDescription == "" {
+		t.Error("expected non-empty cause_description")
+	}
+	if changes[0].TotalDuration != 20.0 {
+		t.Errorf("expected total_duration=20.0, got %f", changes[0].TotalDuration)
+	}
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected 0 active calls, got %d", c.ActiveCalls())
+	}
+}
+
+func TestResyncRebuildsUnknownCalls(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	changes := c.Resync([]ami.Event{
+		coreShowChannel("up.1", "up.1", "1986", "Martin", "Up", "00:00:40",
+			"Exten", "s", "ConnectedLineNum", "21", "ConnectedLineName", "Kitchen"),
+		coreShowChannel("up.1", "up.2", "21", "Kitchen", "Up", "00:00:30"),
+		coreShowChannel("ring.1", "ring.1", "21", "Kitchen", "Ring", "00:00:05",
+			"Exten", "1986", "ConnectedLineNum", "<unknown>"),
+		coreShowChannel("ring.1", "ring.2", "1986", "Martin", "Ringing", "00:00:04"),
+	})
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	assertAnswered(t, changes[0], "up.1")
+	assertFrom(t, changes[0], "Martin", "1986")
+	assertTo(t, changes[0], "21")
+	if changes[0].To.Name != "Kitchen" {
+		t.Errorf("expected to.name=Kitchen, got %s", changes[0].To.Name)
+	}
+	if changes[0].RingDuration != 10.0 {
+		t.Errorf("expected ring_duration=10.0, got %f", changes[0].RingDuration)
+	}
+
+	assertRinging(t, changes[1], "ring.1")
+	assertFrom(t, changes[1], "Kitchen", "21")
+	assertTo(t, changes[1], "1986")
+
+	if c.ActiveCalls() != 2 {
+		t.Fatalf("expected 2 active calls, got %d", c.ActiveCalls())
+	}
+
+	// The rebuilt call hangs up normally with durations from the snapshot
+	now = now.Add(5 * time.Second)
+	hangup := c.Process(ami.NewEvent("Event", "Hangup",
+		"Cause", "16", "Uniqueid", "up.1", "Linkedid", "up.1"))
+	if len(hangup) != 1 {
+		t.Fatal("expected hungup for rebuilt call")
+	}
+	assertHungUp(t, hangup[0], "up.1", 16, "normal_clearing")
+	if hangup[0].TalkDuration != 35.0 {
+		t.Errorf("expected talk_duration=35.0, got %f", hangup[0].TalkDuration)
+	}
+	if hangup[0].TotalDuration != 45.0 {
+		t.Errorf("expected total_duration=45.0, got %f", hangup[0].TotalDuration)
+	}
+}
+
+func TestResyncKeepsKnownCallsAndReportsMissedAnswer(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	c.Process(ami.NewEvent("Event", "Newchannel",
+		"CallerIDNum", "1986", "CallerIDName", "Martin",
+		"Exten", "21", "Uniqueid", "keep.1", "Linkedid", "keep.1"))
+	c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Ringing", "Uniqueid", "keep.2", "Linkedid", "keep.1"))
+
+	// Still ringing: nothing to report
+	changes := c.Resync([]ami.Event{
+		coreShowChannel("keep.1", "keep.1", "1986", "Martin", "Ring", "00:00:02"),
+		coreShowChannel("keep.1", "keep.2", "21", "Kitchen", "Ringing", "00:00:02"),
+	})
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes for an unchanged call, got %d", len(changes))
+	}
+
+	// Answered while disconnected: report it once
+	now = now.Add(10 * time.Second)
+	snapshot := []ami.Event{
+		coreShowChannel("keep.1", "keep.1", "1986", "Martin", "Up", "00:00:12"),
+		coreShowChannel("keep.1", "keep.2", "21", "Kitchen", "Up", "00:00:04"),
+	}
+	changes = c.Resync(snapshot)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	assertAnswered(t, changes[0], "keep.1")
+	assertTo(t, changes[0], "21")
+	if changes[0].RingDuration != 6.0 {
+		t.Errorf("expected ring_duration=6.0, got %f", changes[0].RingDuration)
+	}
+
+	if again := c.Resync(snapshot); len(again) != 0 {
+		t.Errorf("expected repeated resync to be a no-op, got %d changes", len(again))
+	}
+}
+
+// --- Session boundaries ---
+
+func recordDecisions(decisions *[]correlator.Decision) correlator.Option {
+	return correlator.WithDecisionHook(func(d correlator.Decision) {
+		*decisions = append(*decisions, d)
+	})
+}
+
+func startRingingCall(c *correlator.Correlator, linkedID string) {
+	c.Process(ami.NewEvent("Event", "Newchannel",
+		"CallerIDNum", "1986", "CallerIDName", "Martin",
+		"Exten", "21", "Uniqueid", linkedID, "Linkedid", linkedID))
+	c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Ringing", "Uniqueid", linkedID+"0", "Linkedid", linkedID))
+}
+
+func assertDecision(t *testing.T, d correlator.Decision, callID string, action correlator.DecisionAction) {
+	t.Helper()
+	if d.CallID != callID || d.Action != action {
+		t.Errorf("expected %s for %s, got %s for %s (%s)", action, callID, d.Action, d.CallID, d.Reason)
+	}
+	if d.Reason == "" {
+		t.Error("expected a decision reason")
+	}
+}
+
+func TestSessionEndedKeepsCalls(t *testing.T) {
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(recordDecisions(&decisions))
+
+	startRingingCall(c, "held.1")
+	c.SessionEnded()
+
+	if c.ActiveCalls() != 1 {
+		t.Fatalf("expected call to survive session end, got %d active", c.ActiveCalls())
+	}
+	if len(decisions) != 0 {
+		t.Errorf("expected no decisions until the next session, got %d", len(decisions))
+	}
+
+	// Activity on the call in the new session confirms it
+	c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Up", "Uniqueid", "held.10", "Linkedid", "held.1"))
+	if len(decisions) != 1 {
+		t.Fatalf("expected 1 decision, got %d", len(decisions))
+	}
+	assertDecision(t, decisions[0], "held.1", correlator.DecisionKeep)
+}
+
+func TestResyncDecisions(t *testing.T) {
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(recordDecisions(&decisions))
+
+	startRingingCall(c, "a.1")
+	startRingingCall(c, "b.1")
+	startRingingCall(c, "c.1")
+	c.SessionEnded()
+
+	c.Resync([]ami.Event{
+		coreShowChannel("a.1", "a.10", "21", "Kitchen", "Ringing", "00:00:03"),
+		coreShowChannel("b.1", "b.10", "21", "Kitchen", "Up", "00:00:03"),
+		coreShowChannel("d.1", "d.1", "21", "Kitchen", "Ring", "00:00:01"),
+	})
+
+	if len(decisions) != 4 {
+		t.Fatalf("expected 4 decisions, got %d: %+v", len(decisions), decisions)
+	}
+	assertDecision(t, decisions[0], "c.1", correlator.DecisionExpire)
+	assertDecision(t, decisions[1], "a.1", correlator.DecisionKeep)
+	assertDecision(t, decisions[2], "b.1", correlator.DecisionReconcile)
+	assertDecision(t, decisions[3], "d.1", correlator.DecisionReconcile)
+}
+
+func TestFullyBootedAfterRestartExpiresStaleCalls(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		recordDecisions(&decisions))
+
+	startRingingCall(c, "old.1")
+	c.SessionEnded()
+
+	// Asterisk came back 30s later having been up for only 10s
+	now = now.Add(30 * time.Second)
+	startRingingCall(c, "new.1")
+	changes := c.Process(ami.NewEvent("Event", "FullyBooted",
+		"Status", "Fully Booted", "Uptime", "10", "LastReload", "10"))
+
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	assertHungUp(t, changes[0], "old.1", 0, "asterisk_restarted")
+	if c.ActiveCalls() != 1 {
+		t.Errorf("expected only the new call to remain, got %d", c.ActiveCalls())
+	}
+	if len(decisions) != 1 {
+		t.Fatalf("expected 1 decision, got %d", len(decisions))
+	}
+	assertDecision(t, decisions[0], "old.1", correlator.DecisionExpire)
+}
+
+func TestFullyBootedWithoutRestartKeepsStaleCalls(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		recordDecisions(&decisions))
+
+	startRingingCall(c, "blip.1")
+	c.SessionEnded()
+
+	now = now.Add(3 * time.Second)
+	changes := c.Process(ami.NewEvent("Event", "FullyBooted",
+		"Status", "Fully Booted", "Uptime", "86400", "LastReload", "3600"))
+
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %d", len(changes))
+	}
+	if c.ActiveCalls() != 1 {
+		t.Errorf("expected call to be kept, got %d active", c.ActiveCalls())
+	}
+	if len(decisions) != 1 {
+		t.Fatalf("expected 1 decision, got %d", len(decisions))
+	}
+	assertDecision(t, decisions[0], "blip.1", correlator.DecisionKeep)
+}
+
+func TestFullyBootedOnFirstSessionIsIgnored(t *testing.T) {
+	c := correlator.New()
+	startRingingCall(c, "first.1")
+
+	changes := c.Process(ami.NewEvent("Event", "FullyBooted", "Status", "Fully Booted", "Uptime", "1"))
+	if len(changes) != 0 {
+		t.Errorf("expected no changes without a prior session, got %d", len(changes))
+	}
+	if c.ActiveCalls() != 1 {
+		t.Errorf("expected call to be untouched, got %d active", c.ActiveCalls())
+	}
+}
+
+func TestShutdownExpiresAllCalls(t *testing.T) {
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(recordDecisions(&decisions))
+
+	startRingingCall(c, "s.1")
+	startRingingCall(c, "s.2")
+
+	changes := c.Process(ami.NewEvent("Event", "Shutdown", "Shutdown", "Cleanly", "Restart", "True"))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	assertHungUp(t, changes[0], "s.1", 0, "asterisk_shutdown")
+	assertHungUp(t, changes[1], "s.2", 0, "asterisk_shutdown")
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected 0 active calls, got %d", c.ActiveCalls())
+	}
+	if len(decisions) != 2 || decisions[0].Reason != "asterisk restarting" {
+		t.Errorf("expected 2 expire decisions citing restart, got %+v", decisions)
+	}
+}
+
+// --- Stale call reaper ---
+
+func TestReapExpiresLongRingingCall(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var decisions []correlator.Decision
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(2*time.Minute),
+		correlator.WithMaxAnswered(time.Hour),
+		recordDecisions(&decisions))
+
+	startRingingCall(c, "ring.1")
+
+	now = now.Add(2 * time.Minute)
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Fatalf("expected nothing reaped at the limit, got %d", len(changes))
+	}
+
+	now = now.Add(time.Second)
+	changes := c.Reap()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 reaped call, got %d", len(changes))
+	}
+	assertHungUp(t, changes[0], "ring.1", 0, "expired")
+	if changes[0].TalkDuration != 0 {
+		t.Errorf("expected zero talk_duration, got %f", changes[0].TalkDuration)
+	}
+	if changes[0].TotalDuration != 121.0 {
+		t.Errorf("expected total_duration=121.0, got %f", changes[0].TotalDuration)
+	}
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected 0 active calls, got %d", c.ActiveCalls())
+	}
+	if len(decisions) != 1 {
+		t.Fatalf("expected 1 decision, got %d", len(decisions))
+	}
+	assertDecision(t, decisions[0], "ring.1", correlator.DecisionExpire)
+}
+
+func TestReapExpiresLongAnsweredCall(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(2*time.Minute),
+		correlator.WithMaxAnswered(time.Hour))
+
+	startRingingCall(c, "talk.1")
+	now = now.Add(10 * time.Second)
+	c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Up", "Uniqueid", "talk.10", "Linkedid", "talk.1"))
+
+	// Past the ringing limit, but answered calls use the answered limit
+	now = now.Add(30 * time.Minute)
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Fatalf("expected answered call to survive, got %d reaped", len(changes))
+	}
+
+	now = now.Add(31 * time.Minute)
+	changes := c.Reap()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 reaped call, got %d", len(changes))
+	}
+	assertHungUp(t, changes[0], "talk.1", 0, "expired")
+	if changes[0].TalkDuration != 61*60 {
+		t.Errorf("expected talk_duration=3660, got %f", changes[0].TalkDuration)
+	}
+}
+
+func TestReapUsesCreationTimeForCallsThatNeverRang(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(time.Minute))
+
+	c.Process(ami.NewEvent("Event", "Newchannel",
+		"CallerIDNum", "1986", "Exten", "21", "Uniqueid", "dial.1", "Linkedid", "dial.1"))
+
+	now = now.Add(2 * time.Minute)
+	changes := c.Reap()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 reaped call, got %d", len(changes))
+	}
+	assertHungUp(t, changes[0], "dial.1", 0, "expired")
+}
+
+func TestReapUsesAsteriskClock(t *testing.T) {
+	// Our clock runs an hour ahead of Asterisk's
+	now := time.Unix(1770888000, 0).Add(time.Hour)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(2*time.Minute))
+
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "Exten", "21",
+			"Uniqueid", "sk.1", "Linkedid", "sk.1", "Timestamp", "1770888000.000000"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Ringing",
+			"Uniqueid", "sk.10", "Linkedid", "sk.1", "Timestamp", "1770888000.000000"),
+	)
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Fatalf("expected a call that just started ringing to survive, got %+v", changes)
+	}
+
+	now = now.Add(3 * time.Minute)
+	changes := c.Reap()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 reaped call, got %d", len(changes))
+	}
+	if changes[0].TotalDuration != 180 {
+		t.Errorf("expected total_duration=180, got %v", changes[0].TotalDuration)
+	}
+}
+
+func TestReapGivesVoicemailTheAnsweredLimit(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(10*time.Minute),
+		correlator.WithMaxAnswered(time.Hour))
+
+	startRingingCall(c, "vr.1")
+	processEvents(c, voicemailApp("vr.1", "vr.1", "21@default"))
+
+	now = now.Add(20 * time.Minute)
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Fatalf("expected a long voicemail message to survive, got %+v", changes)
+	}
+	now = now.Add(time.Hour)
+	if changes := c.Reap(); len(changes) != 1 || changes[0].Outcome != correlator.OutcomeVoicemail {
+		t.Errorf("expected the voicemail call to expire, got %+v", changes)
+	}
+}
+
+func TestReapGivesQueuedCallsTheAnsweredLimit(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(10*time.Minute),
+		correlator.WithMaxAnswered(time.Hour))
+
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "qr.1", "Linkedid", "qr.1"),
+		queueCallerJoin("qr.1", "sales", "1", "1770888000.000000"),
+	)
+
+	now = now.Add(20 * time.Minute)
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Fatalf("expected a long queue wait to survive, got %+v", changes)
+	}
+	changes := processEvents(c,
+		ami.NewEvent("Event", "AgentConnect", "Uniqueid", "qr.1", "Linkedid", "qr.1", "Queue", "sales",
+			"DestUniqueid", "qr.2", "DestCallerIDNum", "21", "HoldTime", "1200"),
+	)
+	if len(changes) != 2 || changes[1].State != correlator.StateAgentConnected {
+		t.Fatalf("expected answered, agent_connected; got %+v", changes)
+	}
+}
+
+func TestReapExpiresQueuedCallsAfterTheAnsweredLimit(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(10*time.Minute),
+		correlator.WithMaxAnswered(time.Hour))
+
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "qx.1", "Linkedid", "qx.1"),
+		queueCallerJoin("qx.1", "sales", "1", "1770888000.000000"),
+	)
+
+	now = now.Add(61 * time.Minute)
+	if changes := c.Reap(); len(changes) != 1 || changes[0].Cause != "expired" {
+		t.Errorf("expected the queued call to expire, got %+v", changes)
+	}
+}
+
+func TestReapDisabledByDefault(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	startRingingCall(c, "forever.1")
+	now = now.Add(365 * 24 * time.Hour)
+
+	if changes := c.Reap(); len(changes) != 0 {
+		t.Errorf("expected no reaping without limits, got %d", len(changes))
+	}
+	if c.ActiveCalls() != 1 {
+		t.Errorf("expected call to remain tracked, got %d", c.ActiveCalls())
+	}
+}
+
+// --- Event timestamps ---
+
+func TestDurationsUseEventTimestamps(t *testing.T) {
+	// A frozen clock, as when replaying a capture or draining a backlog
+	wall := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return wall }))
+
+	c.Process(ami.NewEvent("Event", "Newchannel", "Timestamp", "1770888509.000000",
+		"CallerIDNum", "1986", "Exten", "21", "Uniqueid", "ts.1", "Linkedid", "ts.1"))
+	ringing := c.Process(ami.NewEvent("Event", "Newstate", "Timestamp", "1770888509.250000",
+		"ChannelStateDesc", "Ringing", "Uniqueid", "ts.2", "Linkedid", "ts.1"))
+	answered := c.Process(ami.NewEvent("Event", "Newstate", "Timestamp", "1770888513.750000",
+		"ChannelStateDesc", "Up", "Uniqueid", "ts.2", "Linkedid", "ts.1"))
+	hungup := c.Process(ami.NewEvent("Event", "Hangup", "Timestamp", "1770888545.750000",
+		"Cause", "16", "Uniqueid", "ts.1", "Linkedid", "ts.1"))
+
+	if len(ringing) != 1 || len(answered) != 1 || len(hungup) != 1 {
+		t.Fatal("expected ringing, answered and hungup")
+	}
+	if !ringing[0].Timestamp.Equal(time.Unix(1770888509, 250000000)) {
+		t.Errorf("expected ringing timestamp from event, got %v", ringing[0].Timestamp)
+	}
+	if answered[0].RingDuration != 4.5 {
+		t.Errorf("expected ring_duration=4.5, got %f", answered[0].RingDuration)
+	}
+	if hungup[0].TalkDuration != 32.0 {
+		t.Errorf("expected talk_duration=32.0, got %f", hungup[0].TalkDuration)
+	}
+	if hungup[0].TotalDuration != 36.5 {
+		t.Errorf("expected total_duration=36.5, got %f", hungup[0].TotalDuration)
+	}
+}
+
+func TestEventsWithoutTimestampUseClock(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	c.Process(ami.NewEvent("Event", "Newchannel",
+		"CallerIDNum", "1986", "Exten", "21", "Uniqueid", "mix.1", "Linkedid", "mix.1"))
+	ringing := c.Process(ami.NewEvent("Event", "Newstate",
+		"ChannelStateDesc", "Ringing", "Uniqueid", "mix.2", "Linkedid", "mix.1"))
+
+	if len(ringing) != 1 || !ringing[0].Timestamp.Equal(now) {
+		t.Fatalf("expected ringing stamped with clock time %v", now)
+	}
+}
+
+// --- Transfers ---
+
+func processEvents(c *correlator.Correlator, events ...ami.Event) []correlator.CallStateChange {
+	var changes []correlator.CallStateChange
+	for _, evt := range events {
+		changes = append(changes, c.Process(evt)...)
+	}
+	return changes
+}
+
+// answeredCall sets up caller → callee on the given Linkedid, answered,
+// with the caller's channel as linkedID and the callee's as calleeUID.
+func answeredCall(c *correlator.Correlator, linkedID, calleeUID, callerNum, callerName, calleeNum, calleeName string) {
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", callerNum, "CallerIDName", callerName,
+			"Exten", calleeNum, "Uniqueid", linkedID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", calleeNum, "CallerIDName", calleeName,
+			"Uniqueid", calleeUID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "DialBegin", "DestCallerIDName", calleeName,
+			"Uniqueid", linkedID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Ringing",
+			"Uniqueid", calleeUID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up",
+			"Uniqueid", calleeUID, "Linkedid", linkedID),
+	)
+}
+
+func TestBlindTransferByCallee(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "bt.1", "bt.2", "1986", "Martin", "21", "Kitchen")
+
+	// Kitchen blind-transfers Martin to 22
+	changes := processEvents(c,
+		ami.NewEvent("Event", "BridgeLeave", "Uniqueid", "bt.2", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "BlindTransfer", "Result", "Success",
+			"TransfererCallerIDNum", "21", "TransfererCallerIDName", "Kitchen",
+			"TransfererUniqueid", "bt.2", "TransfererLinkedid", "bt.1",
+			"TransfereeCallerIDNum", "1986", "TransfereeCallerIDName", "Martin",
+			"TransfereeUniqueid", "bt.1", "TransfereeLinkedid", "bt.1",
+			"Extension", "22"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bt.2", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "22", "CallerIDName", "Office",
+			"Uniqueid", "bt.3", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "bt.3", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "BridgeEnter", "CallerIDNum", "22", "CallerIDName", "Office",
+			"Uniqueid", "bt.3", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bt.3", "Linkedid", "bt.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bt.1", "Linkedid", "bt.1"),
+	)
+
+	if len(changes) != 2 {
+		t.Fatalf("expected transferred + hungup, got %d changes", len(changes))
+	}
+	tr := changes[0]
+	if tr.State != correlator.StateTransferred || tr.CallID != "bt.1" {
+		t.Fatalf("expected transferred for bt.1, got %s for %s", tr.State, tr.CallID)
+	}
+	if tr.TransferType != "blind" {
+		t.Errorf("expected transfer_type=blind, got %s", tr.TransferType)
+	}
+	if tr.TransferredBy.Extension != "21" || tr.TransferredBy.Name != "Kitchen" {
+		t.Errorf("expected transferred_by=21 Kitchen, got %+v", tr.TransferredBy)
+	}
+	assertFrom(t, tr, "Martin", "1986")
+	assertTo(t, tr, "22")
+
+	assertHungUp(t, changes[1], "bt.1", 16, "normal_clearing")
+	assertTo(t, changes[1], "22")
+	if changes[1].To.Name != "Office" {
+		t.Errorf("expected target name from BridgeEnter, got %q", changes[1].To.Name)
+	}
+}
+
+func TestBlindTransferForgetsLegThatLeftTheBridge(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "bl.1", "bl.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "BlindTransfer", "Result", "Success",
+			"TransfererCallerIDNum", "21", "TransfererUniqueid", "bl.2", "TransfererLinkedid", "bl.1",
+			"TransfereeCallerIDNum", "1986", "TransfereeUniqueid", "bl.1", "TransfereeLinkedid", "bl.1",
+			"Extension", "22"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bl.2", "Linkedid", "bl.1"),
+		// The new leg's Local channel joins the bridge, then is optimized
+		// out in favour of 22's own channel
+		ami.NewEvent("Event", "BridgeEnter", "Uniqueid", "bl.3", "Linkedid", "bl.1"),
+		ami.NewEvent("Event", "BridgeEnter", "CallerIDNum", "22", "Uniqueid", "bl.4", "Linkedid", "bl.1"),
+		ami.NewEvent("Event", "BridgeLeave", "Uniqueid", "bl.3", "Linkedid", "bl.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bl.4", "Linkedid", "bl.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bl.1", "Linkedid", "bl.1"),
+	)
+
+	if len(changes) != 2 || changes[1].State != correlator.StateHungUp {
+		t.Fatalf("expected transferred + hungup, got %+v", changes)
+	}
+}
+
+func TestBridgeLeaveKeepsTheCallsOwnChannels(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "bk.1", "bk.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "BridgeEnter", "Uniqueid", "bk.2", "Linkedid", "bk.1"),
+		ami.NewEvent("Event", "BridgeLeave", "Uniqueid", "bk.2", "Linkedid", "bk.1"),
+		ami.NewEvent("Event", "BlindTransfer", "Result", "Success",
+			"TransfererCallerIDNum", "1986", "TransfererUniqueid", "bk.1", "TransfererLinkedid", "bk.1",
+			"TransfereeCallerIDNum", "21", "TransfereeUniqueid", "bk.2", "TransfereeLinkedid", "bk.1",
+			"Extension", "22"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bk.1", "Linkedid", "bk.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateTransferred {
+		t.Fatalf("expected only transferred while 21 is still connected, got %+v", changes)
+	}
+}
+
+func TestBlindTransferByCallerKeepsCallAlive(t *testing.T) {
+	c := correlator.New()
+	// Kitchen calls Martin, then transfers Martin to 22. Kitchen's channel
+	// is the call's originating channel, which normally ends the call.
+	answeredCall(c, "bc.1", "bc.2", "21", "Kitchen", "1986", "Martin")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "BlindTransfer", "Result", "Success",
+			"TransfererCallerIDNum", "21", "TransfererCallerIDName", "Kitchen",
+			"TransfererUniqueid", "bc.1", "TransfererLinkedid", "bc.1",
+			"TransfereeCallerIDNum", "1986", "TransfereeCallerIDName", "Martin",
+			"TransfereeUniqueid", "bc.2", "TransfereeLinkedid", "bc.1",
+			"Extension", "22"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bc.1", "Linkedid", "bc.1"),
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "22", "Uniqueid", "bc.3", "Linkedid", "bc.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateTransferred {
+		t.Fatalf("expected only a transferred change, got %+v", changes)
+	}
+	if c.ActiveCalls() != 1 {
+		t.Fatalf("expected transferred call to stay tracked, got %d", c.ActiveCalls())
+	}
+
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bc.2", "Linkedid", "bc.1"))
+	if len(changes) != 0 {
+		t.Fatalf("expected call to continue while the target is up, got %d changes", len(changes))
+	}
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "bc.3", "Linkedid", "bc.1"))
+	if len(changes) != 1 {
+		t.Fatalf("expected hungup when the last channel ends, got %d changes", len(changes))
+	}
+	assertHungUp(t, changes[0], "bc.1", 16, "normal_clearing")
+	assertFrom(t, changes[0], "Martin", "1986")
+	assertTo(t, changes[0], "22")
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected 0 active calls, got %d", c.ActiveCalls())
+	}
+}
+
+func TestAttendedTransferMergesCalls(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "at.1", "at.2", "1986", "Martin", "21", "Kitchen")
+	// Kitchen consults Office
+	answeredCall(c, "ac.1", "ac.2", "21", "Kitchen", "22", "Office")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "AttendedTransfer", "Result", "Success", "DestType", "Bridge",
+			"OrigTransfererCallerIDNum", "21", "OrigTransfererCallerIDName", "Kitchen",
+			"OrigTransfererUniqueid", "at.2", "OrigTransfererLinkedid", "at.1",
+			"SecondTransfererCallerIDNum", "21", "SecondTransfererCallerIDName", "Kitchen",
+			"SecondTransfererUniqueid", "ac.1", "SecondTransfererLinkedid", "ac.1",
+			"TransfereeCallerIDNum", "1986", "TransfereeCallerIDName", "Martin",
+			"TransfereeUniqueid", "at.1", "TransfereeLinkedid", "at.1",
+			"TransferTargetCallerIDNum", "22", "TransferTargetCallerIDName", "Office",
+			"TransferTargetUniqueid", "ac.2", "TransferTargetLinkedid", "ac.1"),
+	)
+	if len(changes) != 2 {
+		t.Fatalf("expected transferred + consult hungup, got %d changes", len(changes))
+	}
+
+	tr := changes[0]
+	if tr.State != correlator.StateTransferred || tr.CallID != "at.1" {
+		t.Fatalf("expected transferred for at.1, got %s for %s", tr.State, tr.CallID)
+	}
+	if tr.TransferType != "attended" {
+		t.Errorf("expected transfer_type=attended, got %s", tr.TransferType)
+	}
+	if tr.TransferredBy.Extension != "21" {
+		t.Errorf("expected transferred_by=21, got %+v", tr.TransferredBy)
+	}
+	assertFrom(t, tr, "Martin", "1986")
+	assertTo(t, tr, "22")
+	if tr.To.Name != "Office" {
+		t.Errorf("expected to.name=Office, got %q", tr.To.Name)
+	}
+
+	assertHungUp(t, changes[1], "ac.1", 0, "transferred")
+	if c.ActiveCalls() != 1 {
+		t.Fatalf("expected consultation call to be merged, got %d active", c.ActiveCalls())
+	}
+
+	// Transferer legs hang up; target leg events arrive under the
+	// consultation Linkedid but belong to the original call.
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "at.2", "Linkedid", "at.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ac.1", "Linkedid", "ac.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ac.2", "Linkedid", "ac.1"),
+	)
+	if len(changes) != 0 {
+		t.Fatalf("expected call to continue while the transferee is up, got %d changes", len(changes))
+	}
+
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "at.1", "Linkedid", "at.1"))
+	if len(changes) != 1 {
+		t.Fatalf("expected final hungup, got %d changes", len(changes))
+	}
+	assertHungUp(t, changes[0], "at.1", 16, "normal_clearing")
+	assertTo(t, changes[0], "22")
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected 0 active calls, got %d", c.ActiveCalls())
+	}
+}
+
+func TestFailedTransferIgnored(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "ft.1", "ft.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := c.Process(ami.NewEvent("Event", "BlindTransfer", "Result", "Fail",
+		"TransfererUniqueid", "ft.2", "TransfererLinkedid", "ft.1",
+		"TransfereeUniqueid", "ft.1", "TransfereeLinkedid", "ft.1", "Extension", "99"))
+	if len(changes) != 0 {
+		t.Errorf("expected failed transfer to be ignored, got %d changes", len(changes))
+	}
+}
+
+// --- Hunt groups: who answered, who missed ---
+
+func TestUnansweredHuntgroupListsMissedMembers(t *testing.T) {
+	changes := processAll(t, loadRawFixture(t, "unanswered-huntgroup.raw"))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 state changes, got %d", len(changes))
+	}
+
+	if changes[0].To.Name != "" {
+		t.Errorf("expected no name for hunt group 666, got %q", changes[0].To.Name)
+	}
+
+	hungup := changes[1]
+	if hungup.AnsweredBy != nil {
+		t.Errorf("expected no answered_by for unanswered call, got %+v", hungup.AnsweredBy)
+	}
+	if len(hungup.MissedBy) != 6 {
+		t.Fatalf("expected 6 missed members, got %d: %+v", len(hungup.MissedBy), hungup.MissedBy)
+	}
+	names := map[string]bool{}
+	for _, ep := range hungup.MissedBy {
+		names[ep.Name] = true
+	}
+	for _, name := range []string{"Office", "Games Room", "Kitchen", "Bea & Iris", "Minnie", "Alphie"} {
+		if !names[name] {
+			t.Errorf("expected %q in missed_by", name)
+		}
+	}
+}
+
+func TestAnsweredOutboundReportsAnsweredBy(t *testing.T) {
+	changes := processAll(t, loadRawFixture(t, "answered-outbound.raw"))
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 state changes, got %d", len(changes))
+	}
+	for _, change := range changes[1:] {
+		if change.AnsweredBy == nil || change.AnsweredBy.Extension != "21" || change.AnsweredBy.Name != "Kitchen" {
+			t.Errorf("%s: expected answered_by=21 Kitchen, got %+v", change.State, change.AnsweredBy)
+		}
+		if len(change.MissedBy) != 0 {
+			t.Errorf("%s: expected no missed_by, got %+v", change.State, change.MissedBy)
+		}
+	}
+}
+
+func huntgroupDial(linkedID string, members ...[3]string) []ami.Event {
+	events := []ami.Event{
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "CallerIDName", "Martin",
+			"Exten", "666", "Uniqueid", linkedID, "Linkedid", linkedID),
+	}
+	for _, m := range members {
+		events = append(events, ami.NewEvent("Event", "DialBegin",
+			"Uniqueid", linkedID, "Linkedid", linkedID,
+			"DestUniqueid", m[0], "DestCallerIDNum", m[1], "DestCallerIDName", m[2]))
+	}
+	for _, m := range members {
+		events = append(events,
+			ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Ringing", "Uniqueid", m[0], "Linkedid", linkedID),
+			ami.NewEvent("Event", "DialState", "DialStatus", "RINGING", "Uniqueid", linkedID, "Linkedid", linkedID,
+				"DestUniqueid", m[0]))
+	}
+	return events
+}
+
+func TestAnsweredHuntgroupReportsWinner(t *testing.T) {
+	c := correlator.New()
+	events := huntgroupDial("hg.1",
+		[3]string{"hg.2", "11", "Office"},
+		[3]string{"hg.3", "12", "Games Room"},
+		[3]string{"hg.4", "21", "Kitchen"})
+	events = append(events,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "hg.3", "Linkedid", "hg.1"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "CANCEL", "Uniqueid", "hg.1", "Linkedid", "hg.1", "DestUniqueid", "hg.2"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "ANSWER", "Uniqueid", "hg.1", "Linkedid", "hg.1", "DestUniqueid", "hg.3"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "CANCEL", "Uniqueid", "hg.1", "Linkedid", "hg.1", "DestUniqueid", "hg.4"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "hg.1", "Linkedid", "hg.1"),
+	)
+	changes := processEvents(c, events...)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 state changes, got %d", len(changes))
+	}
+	assertTo(t, changes[1], "666")
+	for _, change := range changes[1:] {
+		if change.AnsweredBy == nil || change.AnsweredBy.Extension != "12" || change.AnsweredBy.Name != "Games Room" {
+			t.Errorf("%s: expected answered_by=12 Games Room, got %+v", change.State, change.AnsweredBy)
+		}
+		if len(change.MissedBy) != 2 || change.MissedBy[0].Extension != "11" || change.MissedBy[1].Extension != "21" {
+			t.Errorf("%s: expected missed_by=[11 21], got %+v", change.State, change.MissedBy)
+		}
+	}
+	// A cancelled leg doesn't make an answered call "cancelled"
+	assertHungUp(t, changes[2], "hg.1", 16, "normal_clearing")
+}
+
+func TestAnsweredByFromDialEndWhenCallerAnswersFirst(t *testing.T) {
+	c := correlator.New()
+	events := huntgroupDial("de.1",
+		[3]string{"de.2", "11", "Office"},
+		[3]string{"de.3", "12", "Games Room"})
+	events = append(events,
+		// Caller's own channel goes Up first, so the winner isn't known yet
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "de.1", "Linkedid", "de.1"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "ANSWER", "Uniqueid", "de.1", "Linkedid", "de.1", "DestUniqueid", "de.2"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "de.1", "Linkedid", "de.1"),
+	)
+	changes := processEvents(c, events...)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 state changes, got %d", len(changes))
+	}
+	if changes[1].AnsweredBy != nil {
+		t.Errorf("expected answered_by unknown at answer time, got %+v", changes[1].AnsweredBy)
+	}
+	hungup := changes[2]
+	if hungup.AnsweredBy == nil || hungup.AnsweredBy.Extension != "11" {
+		t.Errorf("expected answered_by=11 from DialEnd, got %+v", hungup.AnsweredBy)
+	}
+	if len(hungup.MissedBy) != 1 || hungup.MissedBy[0].Extension != "12" {
+		t.Errorf("expected missed_by=[12], got %+v", hungup.MissedBy)
+	}
+}
+
+// --- Per-leg dial events ---
+
+// legChanges splits out the StateLeg changes, keyed by leg ID in the order
+// each leg's states were reported.
+func legChanges(changes []correlator.CallStateChange) (map[string][]correlator.LegState, []correlator.CallStateChange) {
+	legs := map[string][]correlator.LegState{}
+	var calls []correlator.CallStateChange
+	for _, change := range changes {
+		if change.State == correlator.StateLeg {
+			legs[change.Leg.ID] = append(legs[change.Leg.ID], change.Leg.State)
+			continue
+		}
+		calls = append(calls, change)
+	}
+	return legs, calls
+}
+
+func TestLegEventsDisabledByDefault(t *testing.T) {
+	for _, change := range processAll(t, loadRawFixture(t, "unanswered-huntgroup.raw")) {
+		if change.State == correlator.StateLeg {
+			t.Fatalf("unexpected leg change without WithLegEvents: %+v", change)
+		}
+	}
+}
+
+func TestLegEventsUnansweredHuntgroup(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithLegEvents(true))
+	changes := processEvents(c, loadRawFixture(t, "unanswered-huntgroup.raw")...)
+	legs, calls := legChanges(changes)
+
+	if len(calls) != 2 || calls[0].State != correlator.StateRinging || calls[1].State != correlator.StateHungUp {
+		t.Fatalf("expected call-level ringing and hungup to be unchanged, got %+v", calls)
+	}
+	if len(legs) != 6 {
+		t.Fatalf("expected 6 legs, got %d", len(legs))
+	}
+	for id, states := range legs {
+		want := []correlator.LegState{correlator.LegDialing, correlator.LegRinging, correlator.LegNoAnswer}
+		if len(states) != len(want) {
+			t.Errorf("leg %s: expected %v, got %v", id, want, states)
+			continue
+		}
+		for i := range want {
+			if states[i] != want[i] {
+				t.Errorf("leg %s: expected %v, got %v", id, want, states)
+				break
+			}
+		}
+	}
+
+	first := changes[0]
+	for _, change := range changes {
+		if change.State == correlator.StateLeg {
+			first = change
+			break
+		}
+	}
+	if first.Leg.Endpoint.Extension != "11" || first.Leg.Endpoint.Name != "Office" {
+		t.Errorf("expected first leg to dial 11 Office, got %+v", first.Leg.Endpoint)
+	}
+	if first.CallID != calls[0].CallID {
+		t.Errorf("expected leg change on call %s, got %s", calls[0].CallID, first.CallID)
+	}
+}
+
+func TestLegEventsAnsweredElsewhere(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithLegEvents(true))
+	events := huntgroupDial("le.1",
+		[3]string{"le.2", "11", "Office"},
+		[3]string{"le.3", "12", "Games Room"},
+		[3]string{"le.4", "21", "Kitchen"})
+	events = append(events,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "le.3", "Linkedid", "le.1"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "ANSWER", "Uniqueid", "le.1", "Linkedid", "le.1", "DestUniqueid", "le.3"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "CANCEL", "Uniqueid", "le.1", "Linkedid", "le.1", "DestUniqueid", "le.2"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "BUSY", "Uniqueid", "le.1", "Linkedid", "le.1", "DestUniqueid", "le.4"),
+	)
+	legs, _ := legChanges(processEvents(c, events...))
+
+	last := func(id string) correlator.LegState {
+		states := legs[id]
+		if len(states) == 0 {
+			return ""
+		}
+		return states[len(states)-1]
+	}
+	if got := last("le.3"); got != correlator.LegAnswered {
+		t.Errorf("expected le.3 answered, got %q", got)
+	}
+	if got := last("le.2"); got != correlator.LegAnsweredElsewhere {
+		t.Errorf("expected le.2 answered_elsewhere, got %q", got)
+	}
+	if got := last("le.4"); got != correlator.LegBusy {
+		t.Errorf("expected le.4 busy, got %q", got)
+	}
+}
+
+func TestLegEventsCancelledByCaller(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithLegEvents(true))
+	legs, _ := legChanges(processEvents(c, loadRawFixture(t, "unanswered-cancel.raw")...))
+
+	if len(legs) != 1 {
+		t.Fatalf("expected 1 leg, got %d", len(legs))
+	}
+	for id, states := range legs {
+		if states[len(states)-1] != correlator.LegCancelled {
+			t.Errorf("leg %s: expected to end cancelled, got %v", id, states)
+		}
+	}
+}
+
+func TestLegEventsNotRepeated(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithLegEvents(true))
+	events := huntgroupDial("lr.1", [3]string{"lr.2", "11", "Office"})
+	events = append(events, ami.NewEvent("Event", "DialState", "DialStatus", "RINGING",
+		"Uniqueid", "lr.1", "Linkedid", "lr.1", "DestUniqueid", "lr.2"))
+	legs, _ := legChanges(processEvents(c, events...))
+
+	if got := legs["lr.2"]; len(got) != 2 {
+		t.Errorf("expected dialing and a single ringing, got %v", got)
+	}
+}
+
+// --- Call outcomes ---
+
+func TestHungupOutcomeFromFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		outcome correlator.Outcome
+		cause   string
+	}{
+		{"answered-outbound.raw", correlator.OutcomeAnswered, "normal_clearing"},
+		{"answered-internal.raw", correlator.OutcomeAnswered, "normal_clearing"},
+		{"unanswered-cancel.raw", correlator.OutcomeCancelled, "cancelled"},
+		{"unanswered-huntgroup.raw", correlator.OutcomeNoAnswer, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			changes := processAll(t, loadRawFixture(t, tt.fixture))
+			if len(changes) == 0 {
+				t.Fatal("expected state changes")
+			}
+			hungup := changes[len(changes)-1]
+			if hungup.State != correlator.StateHungUp {
+				t.Fatalf("expected last change to be hungup, got %s", hungup.State)
+			}
+			if hungup.Outcome != tt.outcome {
+				t.Errorf("expected outcome=%s, got %s", tt.outcome, hungup.Outcome)
+			}
+			if tt.cause != "" && hungup.Cause != tt.cause {
+				t.Errorf("expected cause=%s, got %s", tt.cause, hungup.Cause)
+			}
+		})
+	}
+}
+
+// failedDial is a synthetic call from 1986 to 21 whose only destination
+// ends with dialStatus without ringing, and which hangs up with cause.
+func failedDial(linkedID, dialStatus, cause string) []ami.Event {
+	destUID := linkedID + "1"
+	return []ami.Event{
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "CallerIDName", "Martin",
+			"Exten", "21", "Uniqueid", linkedID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "21", "CallerIDName", "Kitchen",
+			"Uniqueid", destUID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "DialBegin", "Uniqueid", linkedID, "Linkedid", linkedID,
+			"DestUniqueid", destUID, "DestCallerIDNum", "21", "DestCallerIDName", "Kitchen"),
+		ami.NewEvent("Event", "DialEnd", "Uniqueid", linkedID, "Linkedid", linkedID,
+			"DestUniqueid", destUID, "DialStatus", dialStatus),
+		ami.NewEvent("Event", "Hangup", "Cause", cause, "Uniqueid", destUID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Hangup", "Cause", cause, "Uniqueid", linkedID, "Linkedid", linkedID),
+	}
+}
+
+func TestOutcomeFromDialStatus(t *testing.T) {
+	tests := []struct {
+		dialStatus string
+		cause      string
+		outcome    correlator.Outcome
+	}{
+		{"BUSY", "17", correlator.OutcomeBusy},
+		{"CONGESTION", "34", correlator.OutcomeCongestion},
+		{"CHANUNAVAIL", "20", correlator.OutcomeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialStatus, func(t *testing.T) {
+			changes := processEvents(correlator.New(), failedDial("fd.1", tt.dialStatus, tt.cause)...)
+			// The destination never rang, so only the hangup is reported
+			if len(changes) != 1 || changes[0].State != correlator.StateHungUp {
+				t.Fatalf("expected only a hungup change, got %+v", changes)
+			}
+			if changes[0].Outcome != tt.outcome {
+				t.Errorf("expected outcome=%s, got %s", tt.outcome, changes[0].Outcome)
+			}
+		})
+	}
+}
+
+func TestOutcomePrefersNoAnswerOverBusyMembers(t *testing.T) {
+	c := correlator.New()
+	events := huntgroupDial("ob.1",
+		[3]string{"ob.2", "11", "Office"},
+		[3]string{"ob.3", "12", "Games Room"})
+	events = append(events,
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "BUSY", "Uniqueid", "ob.1", "Linkedid", "ob.1", "DestUniqueid", "ob.2"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "NOANSWER", "Uniqueid", "ob.1", "Linkedid", "ob.1", "DestUniqueid", "ob.3"),
+		ami.NewEvent("Event", "Hangup", "Cause", "19", "Uniqueid", "ob.1", "Linkedid", "ob.1"),
+	)
+	changes := processEvents(c, events...)
+
+	if got := changes[len(changes)-1].Outcome; got != correlator.OutcomeNoAnswer {
+		t.Errorf("expected no_answer, got %s", got)
+	}
+}
+
+func TestOutcomeFromCauseWithoutDial(t *testing.T) {
+	tests := []struct {
+		cause   string
+		outcome correlator.Outcome
+	}{
+		{"17", correlator.OutcomeBusy},
+		{"21", correlator.OutcomeFailed}, // rejected, not busy
+		{"1", correlator.OutcomeUnavailable},
+		{"34", correlator.OutcomeCongestion},
+		{"16", correlator.OutcomeFailed},
+	}
+	for _, tt := range tests {
+		c := correlator.New()
+		changes := processEvents(c,
+			ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "Exten", "01632960000", "Uniqueid", "oc.1", "Linkedid", "oc.1"),
+			ami.NewEvent("Event", "Hangup", "Cause", tt.cause, "Uniqueid", "oc.1", "Linkedid", "oc.1"),
+		)
+		if len(changes) != 1 || changes[0].Outcome != tt.outcome {
+			t.Errorf("cause %s: expected outcome=%s, got %+v", tt.cause, tt.outcome, changes)
+		}
+	}
+}
+
+func TestExpiredCallOutcome(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxAnswered(time.Hour),
+	)
+	answeredCall(c, "ex.1", "ex.2", "1986", "Martin", "21", "Kitchen")
+
+	now = now.Add(2 * time.Hour)
+	changes := c.Reap()
+	if len(changes) != 1 || changes[0].Outcome != correlator.OutcomeAnswered {
+		t.Errorf("expected an expired answered call, got %+v", changes)
+	}
+}
+
+// --- Hangup cause table ---
+
+func TestLookupCause(t *testing.T) {
+	tests := []struct {
+		code     int
+		name     string
+		category correlator.CauseCategory
+	}{
+		{1, "unallocated_number", correlator.CauseConfig},
+		{16, "normal_clearing", correlator.CauseUser},
+		{20, "subscriber_absent", correlator.CauseUser},
+		{38, "network_out_of_order", correlator.CauseNetwork},
+		{58, "bearercapability_notavail", correlator.CauseConfig},
+		{127, "interworking", correlator.CauseNetwork},
+	}
+	for _, tt := range tests {
+		info := correlator.LookupCause(tt.code)
+		if info.Code != tt.code || info.Name != tt.name || info.Category != tt.category {
+			t.Errorf("cause %d: expected %s/%s, got %+v", tt.code, tt.name, tt.category, info)
+		}
+		if info.Description == "" {
+			t.Errorf("cause %d: expected a description", tt.code)
+		}
+	}
+
+	unknown := correlator.LookupCause(77)
+	if unknown.Name != "unknown" || unknown.Code != 77 {
+		t.Errorf("expected unknown cause keeping code 77, got %+v", unknown)
+	}
+}
+
+func TestHangupCauseTableIsConsistent(t *testing.T) {
+	for code, info := range correlator.HangupCause {
+		if info.Code != code {
+			t.Errorf("cause %d: entry has code %d", code, info.Code)
+		}
+		if info.Name == "" || info.Description == "" {
+			t.Errorf("cause %d: missing name or description", code)
+		}
+		if code != 0 && info.Category == "" {
+			t.Errorf("cause %d: missing category", code)
+		}
+	}
+}
+
+func TestIsCauseName(t *testing.T) {
+	for _, name := range []string{"user_busy", "network_out_of_order", "cancelled", "lost", "expired"} {
+		if !correlator.IsCauseName(name) {
+			t.Errorf("expected %q to be a cause name", name)
+		}
+	}
+	if correlator.IsCauseName("user_bussy") {
+		t.Error("expected user_bussy not to be a cause name")
+	}
+}
+
+func hangupWithCause(c *correlator.Correlator, id, cause string) correlator.CallStateChange {
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "Exten", "01632960000", "Uniqueid", id, "Linkedid", id),
+		ami.NewEvent("Event", "Hangup", "Cause", cause, "Uniqueid", id, "Linkedid", id),
+	)
+	return changes[len(changes)-1]
+}
+
+func TestHangupReportsPreviouslyUnknownCauses(t *testing.T) {
+	change := hangupWithCause(correlator.New(), "hc.1", "38")
+	if change.Cause != "network_out_of_order" || change.CauseCategory != correlator.CauseNetwork {
+		t.Errorf("expected network_out_of_order/network, got %s/%s", change.Cause, change.CauseCategory)
+	}
+}
+
+func TestCauseDescriptionOverrides(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithCauseDescriptions(map[string]string{
+		"19":        "Keine Antwort (Zeitüberschreitung)",
+		"no_answer": "Keine Antwort",
+		"cancelled": "Vom Anrufer abgebrochen",
+		"expired":   "Abgelaufen",
+	}))
+
+	if got := hangupWithCause(c, "ov.1", "19").CauseDescription; got != "Keine Antwort (Zeitüberschreitung)" {
+		t.Errorf("expected code override for 19, got %q", got)
+	}
+	if got := hangupWithCause(c, "ov.2", "18").CauseDescription; got != "Keine Antwort" {
+		t.Errorf("expected name override for 18, got %q", got)
+	}
+	if got := hangupWithCause(c, "ov.3", "16").CauseDescription; got != correlator.LookupCause(16).Description {
+		t.Errorf("expected default description for 16, got %q", got)
+	}
+
+	cancel := processEvents(c, loadRawFixture(t, "unanswered-cancel.raw")...)
+	if got := cancel[len(cancel)-1].CauseDescription; got != "Vom Anrufer abgebrochen" {
+		t.Errorf("expected override for cancelled, got %q", got)
+	}
+}
+
+func TestCauseDescriptionOverrideForExpiredCall(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxRinging(time.Minute),
+		correlator.WithCauseDescriptions(map[string]string{"expired": "Abgelaufen"}),
+	)
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "Exten", "21", "Uniqueid", "ox.1", "Linkedid", "ox.1"),
+	)
+
+	now = now.Add(2 * time.Minute)
+	changes := c.Reap()
+	if len(changes) != 1 || changes[0].CauseDescription != "Abgelaufen" {
+		t.Errorf("expected translated expired description, got %+v", changes)
+	}
+}
+
+// --- Hold and unhold ---
+
+func TestHoldAndResume(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+	answeredCall(c, "hd.1", "hd.2", "1986", "Martin", "21", "Kitchen")
+
+	// Kitchen presses hold; Martin hears music. Only one held change.
+	now = now.Add(10 * time.Second)
+	held := processEvents(c,
+		ami.NewEvent("Event", "Hold", "Uniqueid", "hd.2", "Linkedid", "hd.1", "MusicClass", "default"),
+		ami.NewEvent("Event", "MusicOnHoldStart", "Uniqueid", "hd.1", "Linkedid", "hd.1", "Class", "default"),
+	)
+	if len(held) != 1 || held[0].State != correlator.StateHeld {
+		t.Fatalf("expected a single held change, got %+v", held)
+	}
+	if held[0].HoldCount != 1 {
+		t.Errorf("expected hold_count=1, got %d", held[0].HoldCount)
+	}
+
+	now = now.Add(15 * time.Second)
+	resumed := processEvents(c,
+		ami.NewEvent("Event", "MusicOnHoldStop", "Uniqueid", "hd.1", "Linkedid", "hd.1"),
+		ami.NewEvent("Event", "Unhold", "Uniqueid", "hd.2", "Linkedid", "hd.1"),
+	)
+	if len(resumed) != 1 || resumed[0].State != correlator.StateResumed {
+		t.Fatalf("expected a single resumed change, got %+v", resumed)
+	}
+	if resumed[0].HoldDuration != 15.0 {
+		t.Errorf("expected hold_duration=15, got %v", resumed[0].HoldDuration)
+	}
+
+	// A second, shorter hold that is still in progress at hangup
+	now = now.Add(5 * time.Second)
+	processEvents(c, ami.NewEvent("Event", "Hold", "Uniqueid", "hd.2", "Linkedid", "hd.1"))
+	now = now.Add(4 * time.Second)
+	changes := processEvents(c, ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "hd.1", "Linkedid", "hd.1"))
+
+	if len(changes) != 1 {
+		t.Fatalf("expected hungup, got %+v", changes)
+	}
+	if changes[0].HoldDuration != 19.0 {
+		t.Errorf("expected hold_duration=19, got %v", changes[0].HoldDuration)
+	}
+	if changes[0].HoldCount != 2 {
+		t.Errorf("expected hold_count=2, got %d", changes[0].HoldCount)
+	}
+	if changes[0].TalkDuration != 34.0 {
+		t.Errorf("expected talk_duration=34, got %v", changes[0].TalkDuration)
+	}
+}
+
+func TestHoldIgnoredBeforeAnswer(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "Exten", "21", "Uniqueid", "hb.1", "Linkedid", "hb.1"),
+		ami.NewEvent("Event", "MusicOnHoldStart", "Uniqueid", "hb.1", "Linkedid", "hb.1"),
+		ami.NewEvent("Event", "MusicOnHoldStop", "Uniqueid", "hb.1", "Linkedid", "hb.1"),
+	)
+	if len(changes) != 0 {
+		t.Errorf("expected hold before answer to be ignored, got %+v", changes)
+	}
+}
+
+func TestQueueMusicOnHoldIsNotHold(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "hq.1", "Linkedid", "hq.1"),
+		queueCallerJoin("hq.1", "sales", "1", "1770888500.000000"),
+		ami.NewEvent("Event", "MusicOnHoldStart", "Uniqueid", "hq.1", "Linkedid", "hq.1", "Class", "default"),
+		ami.NewEvent("Event", "DialBegin", "Uniqueid", "hq.1", "Linkedid", "hq.1", "DestUniqueid", "hq.2",
+			"DestCallerIDNum", "21", "DestCallerIDName", "Kitchen"),
+		ami.NewEvent("Event", "AgentConnect", "Uniqueid", "hq.1", "Linkedid", "hq.1", "Queue", "sales",
+			"DestUniqueid", "hq.2", "DestCallerIDNum", "21", "MemberName", "Kitchen", "HoldTime", "20"),
+		// The music stops once the agent is bridged in
+		ami.NewEvent("Event", "MusicOnHoldStop", "Uniqueid", "hq.1", "Linkedid", "hq.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "hq.1", "Linkedid", "hq.1"),
+	)
+
+	for _, ch := range changes {
+		if ch.State == correlator.StateHeld || ch.State == correlator.StateResumed {
+			t.Errorf("expected no hold for queue music, got %+v", ch)
+		}
+	}
+	hungup := changes[len(changes)-1]
+	if hungup.HoldCount != 0 || hungup.HoldDuration != 0 {
+		t.Errorf("expected no hold time, got count=%d duration=%v", hungup.HoldCount, hungup.HoldDuration)
+	}
+}
+
+func TestParkedMusicOnHoldIsNotHold(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "hp.1", "hp.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := processEvents(c,
+		parkedCall("hp.1", "hp.1", "1986", "Martin", "701"),
+		ami.NewEvent("Event", "MusicOnHoldStart", "Uniqueid", "hp.1", "Linkedid", "hp.1", "Class", "default"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "hp.2", "Linkedid", "hp.1"),
+		ami.NewEvent("Event", "ParkedCallGiveUp", "ParkeeUniqueid", "hp.1", "ParkeeLinkedid", "hp.1",
+			"Parkinglot", "default", "ParkingSpace", "701"),
+		ami.NewEvent("Event", "MusicOnHoldStop", "Uniqueid", "hp.1", "Linkedid", "hp.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "hp.1", "Linkedid", "hp.1"),
+	)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected parked, unparked, hungup; got %+v", changes)
+	}
+	if changes[2].HoldCount != 0 || changes[2].HoldDuration != 0 {
+		t.Errorf("expected no hold time, got count=%d duration=%v", changes[2].HoldCount, changes[2].HoldDuration)
+	}
+}
+
+func TestExpiredCallCountsOpenHold(t *testing.T) {
+	now := time.Unix(1770888000, 0)
+	c := correlator.NewWithOptions(
+		correlator.WithClock(func() time.Time { return now }),
+		correlator.WithMaxAnswered(time.Hour),
+	)
+	answeredCall(c, "hx.1", "hx.2", "1986", "Martin", "21", "Kitchen")
+	processEvents(c, ami.NewEvent("Event", "Hold", "Uniqueid", "hx.2", "Linkedid", "hx.1"))
+
+	now = now.Add(2 * time.Hour)
+	changes := c.Reap()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 expired call, got %d", len(changes))
+	}
+	if changes[0].HoldDuration != 7200.0 {
+		t.Errorf("expected hold_duration=7200, got %v", changes[0].HoldDuration)
+	}
+	if changes[0].HoldCount != 1 {
+		t.Errorf("expected hold_count=1, got %d", changes[0].HoldCount)
+	}
+}
+
+// --- Voicemail ---
+
+func voicemailApp(linkedID, uniqueID, appData string) ami.Event {
+	return ami.NewEvent("Event", "Newexten", "Uniqueid", uniqueID, "Linkedid", linkedID,
+		"Context", "macro-vm", "Extension", "s", "Application", "VoiceMail", "AppData", appData)
+}
+
+func TestUnansweredHuntgroupGoesToVoicemail(t *testing.T) {
+	c := correlator.New()
+	events := huntgroupDial("vm.1",
+		[3]string{"vm.2", "11", "Office"},
+		[3]string{"vm.3", "12", "Games Room"})
+	events = append(events,
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "NOANSWER", "Uniqueid", "vm.1", "Linkedid", "vm.1", "DestUniqueid", "vm.2"),
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "NOANSWER", "Uniqueid", "vm.1", "Linkedid", "vm.1", "DestUniqueid", "vm.3"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "vm.1", "Linkedid", "vm.1", "Application", "Macro", "AppData", "vm,666"),
+		voicemailApp("vm.1", "vm.1", "666@default,u"),
+		// VoiceMail answers the caller's channel to play the greeting
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "vm.1", "Linkedid", "vm.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "vm.1", "Linkedid", "vm.1"),
+	)
+	changes := processEvents(c, events...)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected ringing, voicemail, hungup; got %d changes: %+v", len(changes), changes)
+	}
+	vm := changes[1]
+	if vm.State != correlator.StateVoicemail {
+		t.Fatalf("expected voicemail instead of answered, got %s", vm.State)
+	}
+	if vm.Mailbox != "666@default" {
+		t.Errorf("expected mailbox=666@default, got %q", vm.Mailbox)
+	}
+	if len(vm.MissedBy) != 2 {
+		t.Errorf("expected both members in missed_by, got %+v", vm.MissedBy)
+	}
+
+	hungup := changes[2]
+	assertHungUp(t, hungup, "vm.1", 16, "normal_clearing")
+	if hungup.Outcome != correlator.OutcomeVoicemail {
+		t.Errorf("expected outcome=voicemail, got %s", hungup.Outcome)
+	}
+	if hungup.Mailbox != "666@default" {
+		t.Errorf("expected mailbox on hungup, got %q", hungup.Mailbox)
+	}
+	if hungup.TalkDuration != 0 {
+		t.Errorf("expected no talk time for a voicemail call, got %v", hungup.TalkDuration)
+	}
+}
+
+func TestVoicemailAfterDialplanAnswer(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "21", "Uniqueid", "va.1", "Linkedid", "va.1"),
+		// The dialplan answers before playing an announcement, then sends the call to voicemail
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "va.1", "Linkedid", "va.1"),
+		ami.NewEvent("Event", "VarSet", "Uniqueid", "va.1", "Linkedid", "va.1", "Application", "voicemail",
+			"AppData", "21@default", "Variable", "VM_MESSAGEFILE"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "va.1", "Linkedid", "va.1"),
+	)
+
+	if len(changes) != 2 || changes[0].State != correlator.StateVoicemail {
+		t.Fatalf("expected voicemail, hungup; got %+v", changes)
+	}
+	if changes[1].Outcome != correlator.OutcomeVoicemail || changes[1].TalkDuration != 0 {
+		t.Errorf("expected outcome=voicemail without talk time, got %s / %v", changes[1].Outcome, changes[1].TalkDuration)
+	}
+}
+
+func TestVoicemailAfterMemberAnsweredIsIgnored(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "vx.1", "vx.2", "1986", "Martin", "21", "Kitchen")
+	processEvents(c,
+		ami.NewEvent("Event", "DialEnd", "DialStatus", "ANSWER", "Uniqueid", "vx.1", "Linkedid", "vx.1", "DestUniqueid", "vx.2"),
+	)
+
+	// 21 transfers the caller to a colleague's voicemail
+	changes := processEvents(c,
+		voicemailApp("vx.1", "vx.1", "22@default"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "vx.1", "Linkedid", "vx.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateHungUp {
+		t.Fatalf("expected only hungup, got %+v", changes)
+	}
+	if changes[0].Outcome != correlator.OutcomeAnswered || changes[0].Mailbox != "" {
+		t.Errorf("expected an answered call without mailbox, got %s / %q", changes[0].Outcome, changes[0].Mailbox)
+	}
+}
+
+func TestResyncRecognisesVoicemail(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	changes := c.Resync([]ami.Event{
+		coreShowChannel("rv.1", "rv.1", "01632960000", "", "Up", "00:00:40",
+			"Exten", "21", "Application", "VoiceMail", "ApplicationData", "21@default,u"),
+	})
+	if len(changes) != 1 || changes[0].State != correlator.StateVoicemail {
+		t.Fatalf("expected a voicemail change, got %+v", changes)
+	}
+	if changes[0].Mailbox != "21@default" {
+		t.Errorf("expected mailbox=21@default, got %q", changes[0].Mailbox)
+	}
+}
+
+func TestResyncRecognisesQueuedCaller(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	changes := c.Resync([]ami.Event{
+		coreShowChannel("rq.1", "rq.1", "01632960000", "", "Up", "00:02:00",
+			"Exten", "600", "Application", "Queue", "ApplicationData", "sales,t,,,300"),
+	})
+	if len(changes) != 1 || changes[0].State != correlator.StateQueued || changes[0].Queue != "sales" {
+		t.Fatalf("expected a queued change for sales, got %+v", changes)
+	}
+
+	// The call is still waiting for an agent, who then answers it
+	changes = processEvents(c,
+		ami.NewEvent("Event", "AgentConnect", "Uniqueid", "rq.1", "Linkedid", "rq.1", "Queue", "sales",
+			"DestUniqueid", "rq.2", "DestCallerIDNum", "21"),
+	)
+	if len(changes) != 2 || changes[0].State != correlator.StateAnswered || changes[1].State != correlator.StateAgentConnected {
+		t.Fatalf("expected answered, agent_connected; got %+v", changes)
+	}
+}
+
+func TestResyncQueueCallWithAgentIsAnswered(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := correlator.NewWithOptions(correlator.WithClock(func() time.Time { return now }))
+
+	changes := c.Resync([]ami.Event{
+		coreShowChannel("rq.3", "rq.3", "01632960000", "", "Up", "00:02:00",
+			"Exten", "600", "Application", "Queue", "ApplicationData", "sales"),
+		coreShowChannel("rq.3", "rq.4", "21", "Kitchen", "Up", "00:00:30",
+			"Application", "AppQueue", "ApplicationData", "(Outgoing Line)"),
+	})
+	if len(changes) != 1 || changes[0].State != correlator.StateAnswered {
+		t.Fatalf("expected an answered change, got %+v", changes)
+	}
+}
+
+func queueCallerJoin(linkedID, queue, position, ts string) ami.Event {
+	return ami.NewEvent("Event", "QueueCallerJoin", "Uniqueid", linkedID, "Linkedid", linkedID,
+		"Queue", queue, "Position", position, "Count", position, "Timestamp", ts)
+}
+
+func TestQueueCallAbandoned(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "qa.1", "Linkedid", "qa.1"),
+		// The queue answers the caller to play music on hold
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "qa.1", "Linkedid", "qa.1"),
+		queueCallerJoin("qa.1", "sales", "2", "1770888500.000000"),
+		ami.NewEvent("Event", "QueueCallerAbandon", "Uniqueid", "qa.1", "Linkedid", "qa.1", "Queue", "sales",
+			"Position", "1", "OriginalPosition", "2", "HoldTime", "35", "Timestamp", "1770888535.000000"),
+		ami.NewEvent("Event", "QueueCallerLeave", "Uniqueid", "qa.1", "Linkedid", "qa.1", "Queue", "sales"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "qa.1", "Linkedid", "qa.1"),
+	)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected queued, abandoned, hungup; got %d changes: %+v", len(changes), changes)
+	}
+	queued := changes[0]
+	if queued.State != correlator.StateQueued || queued.Queue != "sales" || queued.QueuePosition != 2 {
+		t.Errorf("expected queued in sales at position 2, got %+v", queued)
+	}
+	abandoned := changes[1]
+	if abandoned.State != correlator.StateAbandoned || abandoned.Queue != "sales" || abandoned.QueuePosition != 1 {
+		t.Errorf("expected abandoned from sales at position 1, got %+v", abandoned)
+	}
+	if abandoned.QueueWait != 35 {
+		t.Errorf("expected queue_wait=35 from HoldTime, got %v", abandoned.QueueWait)
+	}
+	hungup := changes[2]
+	if hungup.Outcome != correlator.OutcomeAbandoned {
+		t.Errorf("expected outcome=abandoned, got %s", hungup.Outcome)
+	}
+	if hungup.TalkDuration != 0 {
+		t.Errorf("expected no talk time, got %v", hungup.TalkDuration)
+	}
+	if hungup.Queue != "sales" || hungup.QueueWait != 35 {
+		t.Errorf("expected hungup to carry queue and wait, got %q / %v", hungup.Queue, hungup.QueueWait)
+	}
+}
+
+func TestQueueAgentConnected(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "qc.1", "Linkedid", "qc.1"),
+		queueCallerJoin("qc.1", "sales", "1", "1770888500.000000"),
+		ami.NewEvent("Event", "AgentCalled", "Uniqueid", "qc.1", "Linkedid", "qc.1", "Queue", "sales",
+			"DestUniqueid", "qc.2", "DestCallerIDNum", "21", "MemberName", "Kitchen", "Interface", "PJSIP/21"),
+		ami.NewEvent("Event", "DialBegin", "Uniqueid", "qc.1", "Linkedid", "qc.1", "DestUniqueid", "qc.2",
+			"DestCallerIDNum", "21", "DestCallerIDName", "Kitchen", "DestLinkedid", "qc.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "qc.2", "Linkedid", "qc.1"),
+		// No HoldTime: the wait is measured from QueueCallerJoin
+		ami.NewEvent("Event", "AgentConnect", "Uniqueid", "qc.1", "Linkedid", "qc.1", "Queue", "sales",
+			"DestUniqueid", "qc.2", "DestCallerIDNum", "21", "DestCallerIDName", "<unknown>", "MemberName", "Kitchen",
+			"Interface", "PJSIP/21", "Timestamp", "1770888512.000000"),
+		ami.NewEvent("Event", "AgentComplete", "Uniqueid", "qc.1", "Linkedid", "qc.1", "Queue", "sales",
+			"HoldTime", "12", "TalkTime", "60", "Reason", "caller"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "qc.1", "Linkedid", "qc.1"),
+	)
+
+	var connected *correlator.CallStateChange
+	for i := range changes {
+		if changes[i].State == correlator.StateAgentConnected {
+			connected = &changes[i]
+		}
+	}
+	if connected == nil {
+		t.Fatalf("expected an agent_connected change, got %+v", changes)
+	}
+	if connected.Queue != "sales" || connected.QueueWait != 12 {
+		t.Errorf("expected sales with queue_wait=12, got %q / %v", connected.Queue, connected.QueueWait)
+	}
+	if connected.Agent == nil || connected.Agent.Extension != "21" || connected.Agent.Name != "Kitchen" {
+		t.Errorf("expected agent 21 Kitchen, got %+v", connected.Agent)
+	}
+
+	// The agent's phone going up isn't the answer; AgentConnect is
+	answered := changes[len(changes)-3]
+	if answered.State != correlator.StateAnswered || !answered.Timestamp.Equal(connected.Timestamp) {
+		t.Errorf("expected answered just before agent_connected, got %+v", answered)
+	}
+	if answered.AnsweredBy == nil || answered.AnsweredBy.Extension != "21" {
+		t.Errorf("expected answered_by=21, got %+v", answered.AnsweredBy)
+	}
+
+	hungup := changes[len(changes)-1]
+	if hungup.Outcome != correlator.OutcomeAnswered {
+		t.Errorf("expected outcome=answered, got %s", hungup.Outcome)
+	}
+	if hungup.AnsweredBy == nil || hungup.AnsweredBy.Extension != "21" {
+		t.Errorf("expected answered_by=21, got %+v", hungup.AnsweredBy)
+	}
+}
+
+func TestQueueCallerLeavesWithoutAgent(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "ql.1", "Linkedid", "ql.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "ql.1", "Linkedid", "ql.1",
+			"Timestamp", "1770888500.000000"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Application", "Queue", "AppData", "sales,,,,60"),
+		queueCallerJoin("ql.1", "sales", "1", "1770888500.000000"),
+		ami.NewEvent("Event", "MusicOnHoldStart", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Class", "default"),
+		// The queue times out; the dialplan plays a message and hangs up
+		ami.NewEvent("Event", "QueueCallerLeave", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Queue", "sales",
+			"Position", "1", "Count", "0"),
+		ami.NewEvent("Event", "MusicOnHoldStop", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Timestamp", "1770888560.000000"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Application", "Playback", "AppData", "sorry"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ql.1", "Linkedid", "ql.1", "Timestamp", "1770888565.000000"),
+	)
+
+	if len(changes) != 2 || changes[0].State != correlator.StateQueued || changes[1].State != correlator.StateHungUp {
+		t.Fatalf("expected queued, hungup; got %+v", changes)
+	}
+	hungup := changes[1]
+	if hungup.Outcome != correlator.OutcomeLeftQueue {
+		t.Errorf("expected outcome=left_queue, got %s", hungup.Outcome)
+	}
+	if hungup.TalkDuration != 0 || hungup.HoldCount != 0 {
+		t.Errorf("expected no talk or hold time, got talk=%v holds=%d", hungup.TalkDuration, hungup.HoldCount)
+	}
+}
+
+func TestDialplanAnswerWithoutQueueIsReported(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "500", "Uniqueid", "iv.1", "Linkedid", "iv.1"),
+		// An IVR answers and plays a menu; the caller hangs up
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "iv.1", "Linkedid", "iv.1",
+			"Timestamp", "1770888500.000000"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "iv.1", "Linkedid", "iv.1", "Application", "Background", "AppData", "menu"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "iv.1", "Linkedid", "iv.1", "Timestamp", "1770888520.000000"),
+	)
+
+	if len(changes) != 2 || changes[0].State != correlator.StateAnswered || changes[1].State != correlator.StateHungUp {
+		t.Fatalf("expected answered, hungup; got %+v", changes)
+	}
+	if !changes[0].Timestamp.Equal(time.Unix(1770888500, 0)) {
+		t.Errorf("expected answered at the time of answer, got %v", changes[0].Timestamp)
+	}
+	if changes[1].Outcome != correlator.OutcomeAnswered || changes[1].TalkDuration != 20 {
+		t.Errorf("expected answered with 20s talk time, got %s / %v", changes[1].Outcome, changes[1].TalkDuration)
+	}
+}
+
+func TestDialplanAnswerReleasedByNextApplication(t *testing.T) {
+	c := correlator.New()
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "500", "Uniqueid", "ap.1", "Linkedid", "ap.1"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "ap.1", "Linkedid", "ap.1", "Application", "Answer"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "ap.1", "Linkedid", "ap.1"),
+	)
+
+	// An auto-attendant plays a greeting; the call is answered as it starts
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "ap.1", "Linkedid", "ap.1", "Application", "Playback", "AppData", "welcome"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateAnswered {
+		t.Fatalf("expected answered when Playback starts, got %+v", changes)
+	}
+	if calls := c.Calls(); len(calls) != 1 || calls[0].State != correlator.StateAnswered {
+		t.Errorf("expected the call active as answered, got %+v", calls)
+	}
+
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ap.1", "Linkedid", "ap.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateHungUp {
+		t.Fatalf("expected only hungup, got %+v", changes)
+	}
+}
+
+func TestDialplanAnswerHeldForQueueApplication(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01632960000", "Exten", "600", "Uniqueid", "aq.1", "Linkedid", "aq.1"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "aq.1", "Linkedid", "aq.1", "Application", "Answer"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "aq.1", "Linkedid", "aq.1"),
+		ami.NewEvent("Event", "Newexten", "Uniqueid", "aq.1", "Linkedid", "aq.1", "Application", "Queue", "AppData", "sales"),
+		queueCallerJoin("aq.1", "sales", "1", "1770888500.000000"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateQueued {
+		t.Fatalf("expected only queued, got %+v", changes)
+	}
+}
+
+func TestQueueEventsForUnknownCallAreIgnored(t *testing.T) {
+	c := correlator.New()
+	changes := processEvents(c,
+		queueCallerJoin("qu.1", "sales", "1", "1770888500.000000"),
+		ami.NewEvent("Event", "AgentConnect", "Uniqueid", "qu.1", "Linkedid", "qu.1", "Queue", "sales"),
+	)
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func parkedCall(linkedID, parkeeUID, parkeeNum, parkeeName, space string) ami.Event {
+	return ami.NewEvent("Event", "ParkedCall", "ParkeeUniqueid", parkeeUID, "ParkeeLinkedid", linkedID,
+		"ParkeeCallerIDNum", parkeeNum, "ParkeeCallerIDName", parkeeName,
+		"Parkinglot", "default", "ParkingSpace", space, "ParkingTimeout", "45")
+}
+
+func TestParkAndRetrieveByAnotherExtension(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "pk.1", "pk.2", "1986", "Martin", "21", "Kitchen")
+
+	// Kitchen parks Martin in 701 and hangs up
+	changes := processEvents(c,
+		parkedCall("pk.1", "pk.1", "1986", "Martin", "701"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "pk.2", "Linkedid", "pk.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateParked {
+		t.Fatalf("expected only parked, got %+v", changes)
+	}
+	if changes[0].ParkingLot != "default" || changes[0].ParkingSlot != "701" {
+		t.Errorf("expected default/701, got %q/%q", changes[0].ParkingLot, changes[0].ParkingSlot)
+	}
+
+	// The Office phone dials 701 to pick Martin up
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "22", "CallerIDName", "Office",
+			"Exten", "701", "Uniqueid", "rt.1", "Linkedid", "rt.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "rt.1", "Linkedid", "rt.1"),
+	)
+	changes = processEvents(c,
+		ami.NewEvent("Event", "UnParkedCall", "ParkeeUniqueid", "pk.1", "ParkeeLinkedid", "pk.1",
+			"ParkeeCallerIDNum", "1986", "ParkeeCallerIDName", "Martin",
+			"RetrieverUniqueid", "rt.1", "RetrieverLinkedid", "rt.1",
+			"RetrieverCallerIDNum", "22", "RetrieverCallerIDName", "Office",
+			"Parkinglot", "default", "ParkingSpace", "701"),
+	)
+	if len(changes) != 2 {
+		t.Fatalf("expected unparked and the retrieval call's hungup, got %+v", changes)
+	}
+	unparked := changes[0]
+	if unparked.State != correlator.StateUnparked || unparked.CallID != "pk.1" || unparked.UnparkReason != correlator.UnparkRetrieved {
+		t.Errorf("expected pk.1 unparked by retrieval, got %+v", unparked)
+	}
+	if unparked.RetrievedBy == nil || unparked.RetrievedBy.Extension != "22" {
+		t.Errorf("expected retrieved_by=22, got %+v", unparked.RetrievedBy)
+	}
+	if changes[1].State != correlator.StateHungUp || changes[1].CallID != "rt.1" || changes[1].Cause != "unparked" {
+		t.Errorf("expected rt.1 hungup with cause unparked, got %+v", changes[1])
+	}
+
+	// The retriever's channel events now belong to the parked call
+	changes = processEvents(c,
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "rt.1", "Linkedid", "rt.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "pk.1", "Linkedid", "pk.1"),
+	)
+	if len(changes) != 1 {
+		t.Fatalf("expected one hungup, got %+v", changes)
+	}
+	h := changes[0]
+	if h.CallID != "pk.1" || h.From.Extension != "1986" || h.To.Extension != "22" {
+		t.Errorf("expected pk.1 between 1986 and 22, got %+v", h)
+	}
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected no active calls, got %d", c.ActiveCalls())
+	}
+}
+
+func TestParkedCallOutlivesOriginator(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "po.1", "po.2", "21", "Kitchen", "01632960000", "")
+
+	// Kitchen, who placed the call, parks the other party and hangs up
+	changes := processEvents(c,
+		parkedCall("po.1", "po.2", "01632960000", "", "702"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "po.1", "Linkedid", "po.1"),
+	)
+	if len(changes) != 1 || changes[0].State != correlator.StateParked {
+		t.Fatalf("expected the call to stay up while parked, got %+v", changes)
+	}
+
+	changes = processEvents(c,
+		ami.NewEvent("Event", "ParkedCallGiveUp", "ParkeeUniqueid", "po.2", "ParkeeLinkedid", "po.1",
+			"Parkinglot", "default", "ParkingSpace", "702"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "po.2", "Linkedid", "po.1"),
+	)
+	if len(changes) != 2 {
+		t.Fatalf("expected unparked, hungup; got %+v", changes)
+	}
+	if changes[0].State != correlator.StateUnparked || changes[0].UnparkReason != correlator.UnparkGaveUp {
+		t.Errorf("expected unparked because the caller gave up, got %+v", changes[0])
+	}
+	if changes[1].State != correlator.StateHungUp {
+		t.Errorf("expected hungup, got %s", changes[1].State)
+	}
+}
+
+func TestParkedCallTimeOut(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "pt.1", "pt.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := processEvents(c,
+		parkedCall("pt.1", "pt.1", "1986", "Martin", "703"),
+		ami.NewEvent("Event", "ParkedCallTimeOut", "ParkeeUniqueid", "pt.1", "ParkeeLinkedid", "pt.1",
+			"Parkinglot", "default", "ParkingSpace", "703"),
+	)
+	if len(changes) != 2 || changes[1].State != correlator.StateUnparked || changes[1].UnparkReason != correlator.UnparkTimeout {
+		t.Errorf("expected parked, unparked by timeout; got %+v", changes)
+	}
+}
+
+// ringingForPickup starts a call from 1986 to 21 that rings, and a call
+// from 22 dialing the pickup code.
+func ringingForPickup(c *correlator.Correlator, linkedID, calleeUID, pickerUID string) {
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "CallerIDName", "Martin",
+			"Exten", "21", "Uniqueid", linkedID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "DialBegin", "Uniqueid", linkedID, "Linkedid", linkedID,
+			"DestChannel", "PJSIP/21-00000001", "DestUniqueid", calleeUID,
+			"DestCallerIDNum", "21", "DestCallerIDName", "Kitchen"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Ringing", "Channel", "PJSIP/21-00000001",
+			"Uniqueid", calleeUID, "Linkedid", linkedID),
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "22", "CallerIDName", "Office",
+			"Exten", "*8", "Uniqueid", pickerUID, "Linkedid", pickerUID),
+	)
+}
+
+func pickupEvent(linkedID, calleeUID, pickerUID string) ami.Event {
+	return ami.NewEvent("Event", "Pickup", "Channel", "PJSIP/22-00000002",
+		"CallerIDNum", "22", "CallerIDName", "Office", "Uniqueid", pickerUID, "Linkedid", pickerUID,
+		"TargetChannel", "PJSIP/21-00000001", "TargetCallerIDNum", "21", "TargetCallerIDName", "Kitchen",
+		"TargetUniqueid", calleeUID, "TargetLinkedid", linkedID)
+}
+
+func assertPickedUpBy22(t *testing.T, change correlator.CallStateChange) {
+	t.Helper()
+	if change.PickedUpBy == nil || change.PickedUpBy.Extension != "22" {
+		t.Errorf("%s: expected picked_up_by=22, got %+v", change.State, change.PickedUpBy)
+	}
+	if change.AnsweredBy == nil || change.AnsweredBy.Extension != "22" {
+		t.Errorf("%s: expected answered_by=22, got %+v", change.State, change.AnsweredBy)
+	}
+	if change.To.Extension != "22" || change.To.Name != "Office" {
+		t.Errorf("%s: expected to=22 Office, got %+v", change.State, change.To)
+	}
+	if len(change.MissedBy) != 1 || change.MissedBy[0].Extension != "21" {
+		t.Errorf("%s: expected missed_by=[21], got %+v", change.State, change.MissedBy)
+	}
+}
+
+func TestPickupBeforeAnswer(t *testing.T) {
+	c := correlator.New()
+	ringingForPickup(c, "pu.1", "pu.2", "pu.3")
+
+	changes := processEvents(c,
+		// The pickup answers the picker's channel first
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/22-00000002",
+			"Uniqueid", "pu.3", "Linkedid", "pu.3"),
+		pickupEvent("pu.1", "pu.2", "pu.3"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "pu.2", "Linkedid", "pu.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "pu.3", "Linkedid", "pu.3"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "pu.1", "Linkedid", "pu.1"),
+	)
+
+	if len(changes) != 4 {
+		t.Fatalf("expected the pickup call's answered and hungup, then answered, hungup; got %d: %+v", len(changes), changes)
+	}
+	if changes[1].CallID != "pu.3" || changes[1].Cause != "picked_up" {
+		t.Errorf("expected the pickup call to end with cause picked_up, got %+v", changes[1])
+	}
+	if changes[2].State != correlator.StateAnswered || changes[2].CallID != "pu.1" {
+		t.Fatalf("expected pu.1 answered, got %+v", changes[2])
+	}
+	assertPickedUpBy22(t, changes[2])
+	if changes[3].State != correlator.StateHungUp || changes[3].CallID != "pu.1" {
+		t.Fatalf("expected pu.1 hungup, got %+v", changes[3])
+	}
+	assertPickedUpBy22(t, changes[3])
+}
+
+func TestPickupMasqueradeBeforePickupEvent(t *testing.T) {
+	c := correlator.New()
+	ringingForPickup(c, "pm.1", "pm.2", "pm.3")
+
+	// The ringing channel answers having taken the picker's name and
+	// caller ID, before Asterisk reports the pickup itself
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/22-00000002",
+			"CallerIDNum", "22", "CallerIDName", "Office", "Uniqueid", "pm.2", "Linkedid", "pm.1"),
+		pickupEvent("pm.1", "pm.2", "pm.3"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "pm.1", "Linkedid", "pm.1"),
+	)
+
+	if len(changes) != 2 {
+		t.Fatalf("expected answered, hungup; got %d: %+v", len(changes), changes)
+	}
+	assertPickedUpBy22(t, changes[0])
+	assertPickedUpBy22(t, changes[1])
+	if c.ActiveCalls() != 0 {
+		t.Errorf("expected the pickup call to be merged, got %d active calls", c.ActiveCalls())
+	}
+}
+
+func TestAnswerWithoutPickupHasNoPickedUpBy(t *testing.T) {
+	c := correlator.New()
+	ringingForPickup(c, "np.1", "np.2", "np.3")
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "np.2", "Linkedid", "np.1"),
+	)
+	if len(changes) != 1 || changes[0].PickedUpBy != nil || changes[0].AnsweredBy.Extension != "21" {
+		t.Errorf("expected a plain answer by 21, got %+v", changes)
+	}
+}
+
+// --- Caller ID updates ---
+
+func TestCallerNameResolvedAfterRinging(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	ringingForPickup(c, "id.1", "id.2", "id.3")
+
+	changes := processEvents(c,
+		// A CID lookup names the caller while the phone rings
+		ami.NewEvent("Event", "NewCallerid", "CallerIDNum", "1986", "CallerIDName", "Martin Sweeney",
+			"Uniqueid", "id.1", "Linkedid", "id.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "id.2", "Linkedid", "id.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "id.1", "Linkedid", "id.1"),
+	)
+
+	if len(changes) != 3 {
+		t.Fatalf("expected updated, answered, hungup; got %d: %+v", len(changes), changes)
+	}
+	if changes[0].State != correlator.StateUpdated || changes[0].CallID != "id.1" {
+		t.Fatalf("expected updated for id.1, got %+v", changes[0])
+	}
+	for _, change := range changes {
+		assertFrom(t, change, "Martin Sweeney", "1986")
+	}
+}
+
+func TestIdentityUpdatesDisabledByDefault(t *testing.T) {
+	c := correlator.New()
+	ringingForPickup(c, "iu.1", "iu.2", "iu.3")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "NewCallerid", "CallerIDNum", "1986", "CallerIDName", "Martin Sweeney",
+			"Uniqueid", "iu.1", "Linkedid", "iu.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "iu.2", "Linkedid", "iu.1"),
+	)
+
+	if len(changes) != 1 || changes[0].State != correlator.StateAnswered {
+		t.Fatalf("expected only answered without WithIdentityUpdates, got %+v", changes)
+	}
+	assertFrom(t, changes[0], "Martin Sweeney", "1986")
+}
+
+func TestUnchangedCallerIDIsNotReported(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	ringingForPickup(c, "uc.1", "uc.2", "uc.3")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "NewCallerid", "CallerIDNum", "1986", "CallerIDName", "Martin",
+			"Uniqueid", "uc.1", "Linkedid", "uc.1"),
+	)
+	if len(changes) != 0 {
+		t.Errorf("expected no change for the same caller ID, got %+v", changes)
+	}
+}
+
+func TestCallerIDUpdateBeforeRingingIsNotReported(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	changes := processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "01234567890", "CallerIDName", "",
+			"Exten", "21", "Uniqueid", "br.1", "Linkedid", "br.1"),
+		ami.NewEvent("Event", "NewCallerid", "CallerIDNum", "01234567890", "CallerIDName", "Acme Ltd",
+			"Uniqueid", "br.1", "Linkedid", "br.1"),
+	)
+	if len(changes) != 0 {
+		t.Errorf("expected no updated before the call is reported, got %+v", changes)
+	}
+}
+
+func TestDestinationCallerIDUpdate(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	ringingForPickup(c, "dc.1", "dc.2", "dc.3")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "NewCallerid", "CallerIDNum", "21", "CallerIDName", "Kitchen Phone",
+			"Uniqueid", "dc.2", "Linkedid", "dc.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "dc.2", "Linkedid", "dc.1"),
+	)
+
+	if len(changes) != 2 || changes[0].State != correlator.StateUpdated {
+		t.Fatalf("expected updated, answered; got %+v", changes)
+	}
+	if changes[1].To.Name != "Kitchen Phone" {
+		t.Errorf("expected to name Kitchen Phone, got %+v", changes[1].To)
+	}
+	if changes[1].AnsweredBy == nil || changes[1].AnsweredBy.Name != "Kitchen Phone" {
+		t.Errorf("expected answered_by name Kitchen Phone, got %+v", changes[1].AnsweredBy)
+	}
+}
+
+func TestConnectedLineAfterAnswer(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	answeredCall(c, "cl.1", "cl.2", "1986", "Martin", "901234567890", "")
+
+	changes := processEvents(c,
+		// The far end of a trunk call identifies itself once connected
+		ami.NewEvent("Event", "NewConnectedLine", "ConnectedLineNum", "901234567890",
+			"ConnectedLineName", "Acme Ltd", "Uniqueid", "cl.1", "Linkedid", "cl.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "cl.1", "Linkedid", "cl.1"),
+	)
+
+	if len(changes) != 2 || changes[0].State != correlator.StateUpdated {
+		t.Fatalf("expected updated, hungup; got %+v", changes)
+	}
+	for _, change := range changes {
+		if change.To.Extension != "901234567890" || change.To.Name != "Acme Ltd" {
+			t.Errorf("%s: expected to=901234567890 Acme Ltd, got %+v", change.State, change.To)
+		}
+	}
+}
+
+func TestConnectedLineWhileDialingIsIgnored(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	ringingForPickup(c, "cd.1", "cd.2", "cd.3")
+
+	// FreePBX decorates the connected line with presence while dialing
+	changes := processEvents(c,
+		ami.NewEvent("Event", "NewConnectedLine", "ConnectedLineNum", "21",
+			"ConnectedLineName", "Kitchen (Available)", "Uniqueid", "cd.1", "Linkedid", "cd.1"),
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Channel", "PJSIP/21-00000001",
+			"CallerIDNum", "21", "Uniqueid", "cd.2", "Linkedid", "cd.1"),
+	)
+
+	if len(changes) != 1 || changes[0].State != correlator.StateAnswered {
+		t.Fatalf("expected only answered, got %+v", changes)
+	}
+	if changes[0].To.Name != "Kitchen" {
+		t.Errorf("expected to name Kitchen, got %+v", changes[0].To)
+	}
+}
+
+func TestCallerIDUpdateAfterBlindTransfer(t *testing.T) {
+	c := correlator.NewWithOptions(correlator.WithIdentityUpdates(true))
+	answeredCall(c, "ct.1", "ct.2", "1986", "Martin", "21", "Kitchen")
+
+	changes := processEvents(c,
+		ami.NewEvent("Event", "BlindTransfer", "Result", "Success",
+			"TransfererCallerIDNum", "21", "TransfererCallerIDName", "Kitchen",
+			"TransfererUniqueid", "ct.2", "TransfererLinkedid", "ct.1",
+			"TransfereeCallerIDNum", "1986", "TransfereeCallerIDName", "Martin",
+			"TransfereeUniqueid", "ct.1", "TransfereeLinkedid", "ct.1",
+			"Extension", "22"),
+		ami.NewEvent("Event", "NewConnectedLine", "ConnectedLineNum", "22",
+			"ConnectedLineName", "Office", "Uniqueid", "ct.1", "Linkedid", "ct.1"),
+		ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ct.1", "Linkedid", "ct.1"),
+	)
+
+	if len(changes) != 3 || changes[1].State != correlator.StateUpdated {
+		t.Fatalf("expected transferred, updated, hungup; got %+v", changes)
+	}
+	if hungup := changes[2]; hungup.To.Extension != "22" || hungup.To.Name != "Office" {
+		t.Errorf("expected hungup to=22 Office, got %+v", hungup.To)
+	}
+}
+
+// --- Active calls ---
+
+func TestCallsFollowReportedState(t *testing.T) {
+	c := correlator.New()
+	processEvents(c,
+		ami.NewEvent("Event", "Newchannel", "CallerIDNum", "1986", "CallerIDName", "Martin",
+			"Exten", "21", "Uniqueid", "ac.1", "Linkedid", "ac.1"),
+	)
+	if calls := c.Calls(); len(calls) != 0 {
+		t.Fatalf("expected no calls before ringing, got %+v", calls)
+	}
+
+	ringAt := time.Unix(1770888509, 0)
+	holdAt := time.Unix(1770888549, 0)
+	processEvents(c,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Ringing",
+			"Uniqueid", "ac.2", "Linkedid", "ac.1", "Timestamp", "1770888509.000000"),
+	)
+	calls := c.Calls()
+	if len(calls) != 1 || calls[0].CallID != "ac.1" || calls[0].State != correlator.StateRinging || !calls[0].Since.Equal(ringAt) {
+		t.Fatalf("expected ac.1 ringing since %v, got %+v", ringAt, calls)
+	}
+	if calls[0].From.Extension != "1986" || calls[0].To.Extension != "21" {
+		t.Errorf("expected 1986 → 21, got %+v → %+v", calls[0].From, calls[0].To)
+	}
+
+	processEvents(c,
+		ami.NewEvent("Event", "Newstate", "ChannelStateDesc", "Up", "Uniqueid", "ac.2", "Linkedid", "ac.1"),
+		ami.NewEvent("Event", "Hold", "Uniqueid", "ac.2", "Linkedid", "ac.1",
+			"Timestamp", "1770888549.000000"),
+	)
+	if calls := c.Calls(); len(calls) != 1 || calls[0].State != correlator.StateHeld || !calls[0].Since.Equal(holdAt) {
+		t.Fatalf("expected ac.1 held since %v, got %+v", holdAt, calls)
+	}
+
+	processEvents(c, ami.NewEvent("Event", "Unhold", "Uniqueid", "ac.2", "Linkedid", "ac.1"))
+	if calls := c.Calls(); len(calls) != 1 || calls[0].State != correlator.StateAnswered {
+		t.Fatalf("expected ac.1 answered after resuming, got %+v", calls)
+	}
+
+	processEvents(c, ami.NewEvent("Event", "Hangup", "Cause", "16", "Uniqueid", "ac.1", "Linkedid", "ac.1"))
+	if calls := c.Calls(); len(calls) != 0 {
+		t.Errorf("expected no calls after hangup, got %+v", calls)
+	}
+}
+
+func TestCallsIncludeResyncedCalls(t *testing.T) {
+	c := correlator.New()
+	c.Resync([]ami.Event{
+		coreShowChannel("rs.1", "rs.1", "1986", "Martin", "Up", "00:00:40",
+			"Exten", "s", "ConnectedLineNum", "21", "ConnectedLineName", "Kitchen"),
+		coreShowChannel("rs.1", "rs.2", "21", "Kitchen", "Up", "00:00:30"),
+	})
+
+	calls := c.Calls()
+	if len(calls) != 1 || calls[0].State != correlator.StateAnswered || calls[0].To.Name != "Kitchen" {
+		t.Errorf("expected rs.1 answered to Kitchen, got %+v", calls)
+	}
+}
+
+func TestCallsAfterParkTimeout(t *testing.T) {
+	c := correlator.New()
+	answeredCall(c, "pk.1", "pk.2", "1986", "Martin", "21", "Kitchen")
+
+	processEvents(c, parkedCall("pk.1", "pk.1", "1986", "Martin", "701"))
+	if calls := c.Calls(); len(calls) != 1 || calls[0].State != correlator.StateParked {
+		t.Fatalf("expected pk.1 parked, got %+v", calls)
+	}
+
+	processEvents(c, ami.NewEvent("Event", "ParkedCallTimeOut", "ParkeeUniqueid", "pk.1", "ParkeeLinkedid", "pk.1",
+		"Parkinglot", "default", "ParkingSpace", "701"))
+	if calls := c.Calls(); len(calls) != 1 || calls[0].State != correlator.StateRinging {
+		t.Errorf("expected pk.1 ringing the parker back, got %+v", calls)
+	}
+}
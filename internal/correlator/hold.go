@@ -0,0 +1,67 @@
+package correlator
+
+import (
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// handleHold runs when a party puts an answered call on hold, reported as
+// Hold from the phone that pressed hold. MusicOnHoldStart is not used: the
+// channel hearing the music may equally be waiting in a queue or parked.
+func (c *Correlator) handleHold(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil || !cs.answered || cs.held {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	cs.held = true
+	cs.holdStart = now
+	cs.holdCount++
+
+	return []CallStateChange{{
+		State:     StateHeld,
+		CallID:    linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		HoldCount: cs.holdCount,
+		Timestamp: now,
+	}}
+}
+
+// handleUnhold runs when a held call is taken off hold.
+func (c *Correlator) handleUnhold(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil || !cs.held {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	held := cs.endHold(now)
+
+	return []CallStateChange{{
+		State:        StateResumed,
+		CallID:       linkedID,
+		From:         cs.from,
+		To:           cs.to,
+		HoldDuration: held.Seconds(),
+		HoldCount:    cs.holdCount,
+		Timestamp:    now,
+	}}
+}
+
+// endHold takes the call off hold, adding the hold to its running total,
+// and returns how long it lasted.
+func (cs *callState) endHold(now time.Time) time.Duration {
+	if !cs.held {
+		return 0
+	}
+	held := now.Sub(cs.holdStart)
+	if held < 0 {
+		held = 0
+	}
+	cs.held = false
+	cs.holdTotal += held
+	return held
+}
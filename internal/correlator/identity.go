@@ -0,0 +1,116 @@
+package correlator
+
+import "github.com/sweeney/asterisk-mqtt/internal/ami"
+
+// WithIdentityUpdates makes the correlator emit a StateUpdated change when
+// the caller ID of either party changes after the call has been reported,
+// e.g. when a CID lookup names the caller or the far end of a trunk call
+// identifies itself. Answered and hungup always carry the latest identities.
+func WithIdentityUpdates(enabled bool) Option {
+	return func(corr *Correlator) { corr.identityUpdates = enabled }
+}
+
+// handleNewCallerid applies a change to a channel's own caller ID: the
+// caller's channel names the caller, a destination's channel names that
+// destination.
+func (c *Correlator) handleNewCallerid(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+	ep := endpointWithPrefix(evt, "")
+
+	uniqueID := evt.Get("Uniqueid")
+	if uniqueID == cs.fromChannel {
+		return c.updateIdentity(cs, evt, func() { cs.from = mergeIdentity(cs.from, ep) })
+	}
+	d := cs.dest(uniqueID)
+	if d == nil {
+		return nil
+	}
+	return c.updateIdentity(cs, evt, func() {
+		if cs.to.Extension == d.endpoint.Extension {
+			cs.to = mergeIdentity(cs.to, ep)
+		}
+		d.endpoint = mergeIdentity(d.endpoint, ep)
+	})
+}
+
+// handleNewConnectedLine applies who the caller's channel says it is
+// connected to. While the call is being dialed that tracks dialing
+// progress, and FreePBX decorates it with presence ("Kitchen (Available)"),
+// so it is only trusted once the call has been answered. A connected line
+// naming the destination that answered only refreshes that destination.
+func (c *Correlator) handleNewConnectedLine(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil || !cs.answered || evt.Get("Uniqueid") != cs.fromChannel {
+		return nil
+	}
+	ep := Endpoint{
+		Extension: evt.GetKnown("ConnectedLineNum"),
+		Name:      evt.GetKnown("ConnectedLineName"),
+	}
+	if ep.Extension == "" {
+		return nil
+	}
+
+	return c.updateIdentity(cs, evt, func() {
+		if d := cs.answeredBy; d != nil && d.endpoint.Extension == ep.Extension && cs.to.Extension != ep.Extension {
+			d.endpoint = mergeIdentity(d.endpoint, ep)
+			return
+		}
+		if ep.Extension != cs.to.Extension {
+			cs.to = ep
+			cs.toNameGuess = false
+			return
+		}
+		cs.to = mergeIdentity(cs.to, ep)
+	})
+}
+
+// updateIdentity applies fn and, if identity updates are enabled and the
+// call has been reported, returns a StateUpdated change when the parties'
+// identities changed.
+func (c *Correlator) updateIdentity(cs *callState, evt ami.Event, fn func()) []CallStateChange {
+	from, to := cs.from, cs.to
+	var answeredBy Endpoint
+	if ep := cs.answeredByEndpoint(); ep != nil {
+		answeredBy = *ep
+	}
+
+	fn()
+
+	changed := cs.from != from || cs.to != to
+	if ep := cs.answeredByEndpoint(); ep != nil && *ep != answeredBy {
+		changed = true
+	}
+	if !changed || !c.identityUpdates || !(cs.rung || cs.answered) {
+		return nil
+	}
+	return []CallStateChange{{
+		State:      StateUpdated,
+		CallID:     cs.linkedID,
+		From:       cs.from,
+		To:         cs.to,
+		AnsweredBy: cs.answeredByEndpoint(),
+		Timestamp:  c.eventTime(evt),
+	}}
+}
+
+// mergeIdentity applies a caller ID update. An update without a number
+// keeps the old one; one for a different number replaces the name too.
+func mergeIdentity(old, update Endpoint) Endpoint {
+	if update.Extension == "" {
+		if update.Name != "" {
+			old.Name = update.Name
+		}
+		return old
+	}
+	if update.Extension != old.Extension {
+		return update
+	}
+	if update.Name != "" {
+		old.Name = update.Name
+	}
+	return old
+}
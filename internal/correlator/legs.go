@@ -0,0 +1,76 @@
+package correlator
+
+import "github.com/sweeney/asterisk-mqtt/internal/ami"
+
+// LegState is the progress of one dialed destination of a call, such as
+// a single phone in a hunt group.
+type LegState string
+
+const (
+	LegDialing           LegState = "dialing"
+	LegRinging           LegState = "ringing"
+	LegAnswered          LegState = "answered"
+	LegAnsweredElsewhere LegState = "answered_elsewhere"
+	LegNoAnswer          LegState = "noanswer"
+	LegBusy              LegState = "busy"
+	LegCancelled         LegState = "cancelled"
+	LegUnavailable       LegState = "unavailable"
+	LegCongestion        LegState = "congestion"
+	LegFailed            LegState = "failed"
+)
+
+// Leg describes a dialed destination in a StateLeg change.
+type Leg struct {
+	ID       string   `json:"id"` // the destination channel's Uniqueid
+	Endpoint Endpoint `json:"endpoint"`
+	State    LegState `json:"state"`
+}
+
+// WithLegEvents makes the correlator emit a StateLeg change each time a
+// dialed destination progresses, in addition to the call-level changes.
+func WithLegEvents(enabled bool) Option {
+	return func(corr *Correlator) { corr.legEvents = enabled }
+}
+
+// dialEndLegState maps a DialEnd DialStatus to the leg's final state.
+func dialEndLegState(cs *callState, d *dialDest, status string) LegState {
+	switch status {
+	case "ANSWER":
+		return LegAnswered
+	case "CANCEL":
+		if cs.answeredBy != nil && cs.answeredBy != d {
+			return LegAnsweredElsewhere
+		}
+		return LegCancelled
+	case "NOANSWER":
+		return LegNoAnswer
+	case "BUSY":
+		return LegBusy
+	case "CHANUNAVAIL":
+		return LegUnavailable
+	case "CONGESTION":
+		return LegCongestion
+	default:
+		return LegFailed
+	}
+}
+
+// setLegState moves a dialed destination to state, returning the leg
+// change to report if leg events are enabled and the state is new.
+func (c *Correlator) setLegState(cs *callState, d *dialDest, state LegState, evt ami.Event) []CallStateChange {
+	if d.state == state {
+		return nil
+	}
+	d.state = state
+	if !c.legEvents {
+		return nil
+	}
+	return []CallStateChange{{
+		State:     StateLeg,
+		CallID:    cs.linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		Leg:       &Leg{ID: d.uniqueID, Endpoint: d.endpoint, State: state},
+		Timestamp: c.eventTime(evt),
+	}}
+}
@@ -0,0 +1,79 @@
+package correlator
+
+// Outcome is the normalized result of a call, reported when it hangs up.
+type Outcome string
+
+const (
+	OutcomeAnswered    Outcome = "answered"
+	OutcomeVoicemail   Outcome = "voicemail"
+	OutcomeAbandoned   Outcome = "abandoned"
+	OutcomeLeftQueue   Outcome = "left_queue"
+	OutcomeNoAnswer    Outcome = "no_answer"
+	OutcomeBusy        Outcome = "busy"
+	OutcomeCancelled   Outcome = "cancelled"
+	OutcomeUnavailable Outcome = "unavailable"
+	OutcomeCongestion  Outcome = "congestion"
+	OutcomeFailed      Outcome = "failed"
+)
+
+// legOutcomes ranks how an unanswered destination ended, most telling
+// first: if any phone rang out, the caller experienced no answer even if
+// other hunt group members were busy or offline.
+var legOutcomes = []struct {
+	leg     LegState
+	outcome Outcome
+}{
+	{LegNoAnswer, OutcomeNoAnswer},
+	{LegBusy, OutcomeBusy},
+	{LegCongestion, OutcomeCongestion},
+	{LegUnavailable, OutcomeUnavailable},
+}
+
+// causeOutcomes covers calls that ended without a DialEnd we could use,
+// e.g. calls to a trunk or calls rejected before any destination was dialed.
+var causeOutcomes = map[int]Outcome{
+	1:  OutcomeUnavailable, // unallocated number
+	3:  OutcomeUnavailable, // no route to destination
+	17: OutcomeBusy,
+	18: OutcomeNoAnswer,
+	19: OutcomeNoAnswer,
+	20: OutcomeUnavailable, // subscriber absent
+	27: OutcomeUnavailable, // destination out of order
+	34: OutcomeCongestion,
+	38: OutcomeCongestion, // network out of order
+	42: OutcomeCongestion, // switching equipment congestion
+}
+
+// outcome derives the call's normalized outcome from whether it was
+// answered, the DialEnd statuses of its destinations and, failing those,
+// the hangup cause.
+func (cs *callState) outcome(causeCode int) Outcome {
+	if cs.voicemail {
+		return OutcomeVoicemail
+	}
+	// A dialplan that answered the caller before queueing the call, and
+	// said so, makes an abandoned call look answered.
+	if cs.abandoned {
+		return OutcomeAbandoned
+	}
+	if cs.answered {
+		return OutcomeAnswered
+	}
+	if cs.leftQueue {
+		return OutcomeLeftQueue
+	}
+	if cs.cancelled {
+		return OutcomeCancelled
+	}
+	for _, lo := range legOutcomes {
+		for _, d := range cs.dests {
+			if d.state == lo.leg {
+				return lo.outcome
+			}
+		}
+	}
+	if o, ok := causeOutcomes[causeCode]; ok {
+		return o
+	}
+	return OutcomeFailed
+}
@@ -0,0 +1,92 @@
+package correlator
+
+import "github.com/sweeney/asterisk-mqtt/internal/ami"
+
+// Unpark reasons reported with StateUnparked.
+const (
+	UnparkRetrieved = "retrieved" // someone picked the call up from its slot
+	UnparkTimeout   = "timeout"   // nobody did in time; Asterisk rings the parker back
+	UnparkGaveUp    = "gave_up"   // the parked party hung up
+)
+
+// handleParkedCall runs when a party parks the call. The party who parked
+// it usually hangs up straight after, so from now on the call ends with
+// its last remaining channel, as a transferred call does.
+func (c *Correlator) handleParkedCall(evt ami.Event) []CallStateChange {
+	cs := c.transferCall(evt.Get("ParkeeLinkedid"))
+	if cs == nil {
+		return nil
+	}
+
+	cs.parked = true
+	cs.addChannel(evt.Get("ParkeeUniqueid"))
+
+	return []CallStateChange{{
+		State:       StateParked,
+		CallID:      cs.linkedID,
+		From:        cs.from,
+		To:          cs.to,
+		ParkingLot:  evt.Get("Parkinglot"),
+		ParkingSlot: evt.Get("ParkingSpace"),
+		Timestamp:   c.eventTime(evt),
+	}}
+}
+
+// handleUnParkedCall runs when a party retrieves the call from its slot.
+// The retriever dialed the parking slot as a call of their own; that call
+// is merged into the parked one, which carries on between the parked party
+// and the retriever, like the consultation call of an attended transfer.
+func (c *Correlator) handleUnParkedCall(evt ami.Event) []CallStateChange {
+	cs := c.transferCall(evt.Get("ParkeeLinkedid"))
+	if cs == nil {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	by := endpointWithPrefix(evt, "Retriever")
+	cs.from = endpointWithPrefix(evt, "Parkee")
+	cs.fromChannel = evt.Get("ParkeeUniqueid")
+	cs.to = by
+	cs.addChannel(evt.Get("ParkeeUniqueid"))
+	cs.addChannel(evt.Get("RetrieverUniqueid"))
+
+	changes := []CallStateChange{c.unparkChange(cs, evt, UnparkRetrieved)}
+	changes[0].RetrievedBy = &by
+
+	retriever := c.transferCall(evt.Get("RetrieverLinkedid"))
+	if retriever != nil && retriever != cs {
+		for uid := range retriever.channels {
+			cs.addChannel(uid)
+		}
+		changes = append(changes, c.expireChange(retriever, now, "unparked"))
+		c.remove(retriever.linkedID)
+	}
+	if id := evt.Get("RetrieverLinkedid"); id != "" && id != cs.linkedID && c.calls[id] == nil {
+		c.aliases[id] = cs.linkedID
+	}
+
+	return changes
+}
+
+// handleParkedCallEnd runs when the call leaves its slot without being
+// retrieved: it timed out, or the parked party hung up.
+func (c *Correlator) handleParkedCallEnd(evt ami.Event, reason string) []CallStateChange {
+	cs := c.transferCall(evt.Get("ParkeeLinkedid"))
+	if cs == nil {
+		return nil
+	}
+	return []CallStateChange{c.unparkChange(cs, evt, reason)}
+}
+
+func (c *Correlator) unparkChange(cs *callState, evt ami.Event, reason string) CallStateChange {
+	return CallStateChange{
+		State:        StateUnparked,
+		CallID:       cs.linkedID,
+		From:         cs.from,
+		To:           cs.to,
+		ParkingLot:   evt.Get("Parkinglot"),
+		ParkingSlot:  evt.Get("ParkingSpace"),
+		UnparkReason: reason,
+		Timestamp:    c.eventTime(evt),
+	}
+}
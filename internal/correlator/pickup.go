@@ -0,0 +1,83 @@
+package correlator
+
+import (
+	"strings"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// handlePickup runs when a phone picks up a call ringing elsewhere, e.g.
+// with *8 or a directed pickup code. The picker dialed the pickup code as
+// a call of their own; that call is merged into the picked-up one, which
+// carries on between the caller and the picker.
+func (c *Correlator) handlePickup(evt ami.Event) []CallStateChange {
+	cs := c.transferCall(evt.Get("TargetLinkedid"))
+	if cs == nil {
+		return nil
+	}
+
+	picker := endpointWithPrefix(evt, "")
+	pickerCall := c.transferCall(evt.Get("Linkedid"))
+	if picker.Extension == "" && pickerCall != nil {
+		picker = pickerCall.from
+	}
+	cs.setPickedUp(picker)
+	cs.addChannel(evt.Get("Uniqueid"))
+
+	var changes []CallStateChange
+	if pickerCall != nil && pickerCall != cs {
+		for uid := range pickerCall.channels {
+			cs.addChannel(uid)
+		}
+		// The pickup answers the picker's channel, so its call may
+		// already have been reported.
+		if pickerCall.pendingAnswer != nil {
+			changes = append(changes, *pickerCall.pendingAnswer)
+		}
+		if pickerCall.rung || pickerCall.answered {
+			changes = append(changes, c.expireChange(pickerCall, c.eventTime(evt), "picked_up"))
+		}
+		c.remove(pickerCall.linkedID)
+	}
+	if id := evt.Get("Linkedid"); id != "" && id != cs.linkedID && c.calls[id] == nil {
+		c.aliases[id] = cs.linkedID
+	}
+	return changes
+}
+
+// setPickedUp records who picked the call up; from now on the call is to
+// them rather than to the phone that was ringing.
+func (cs *callState) setPickedUp(picker Endpoint) {
+	if picker.Extension == "" {
+		return
+	}
+	cs.pickedUpBy = &picker
+	cs.to = picker
+	cs.toNameGuess = false
+}
+
+func (cs *callState) pickedUpByEndpoint() *Endpoint {
+	if cs.pickedUpBy == nil {
+		return nil
+	}
+	ep := *cs.pickedUpBy
+	return &ep
+}
+
+// pickedUp reports whether a destination's channel answered as another
+// phone. Asterisk implements call pickup by masquerading the picker's
+// channel into the ringing one, which then takes the picker's channel
+// name and caller ID; this often happens before the Pickup event. The
+// masquerade is only seen here, in the answer: the Rename event that
+// Asterisk 11 and earlier send for it is not handled.
+func pickedUp(d *dialDest, evt ami.Event) (Endpoint, bool) {
+	name := evt.Get("Channel")
+	if d.channel == "" || name == "" || name == d.channel || strings.HasPrefix(name, "Local/") {
+		return Endpoint{}, false
+	}
+	picker := Endpoint{
+		Extension: evt.GetKnown("CallerIDNum"),
+		Name:      evt.GetKnown("CallerIDName"),
+	}
+	return picker, picker.Extension != ""
+}
@@ -0,0 +1,159 @@
+package correlator
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// handleQueueCallerJoin runs when the call enters an app_queue queue.
+func (c *Correlator) handleQueueCallerJoin(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	cs.queue = evt.Get("Queue")
+	cs.queueJoin = now
+	cs.queued = true
+	// The dialplan answered the caller for the queue's music on hold; the
+	// call is answered when an agent connects.
+	cs.dropPendingAnswer()
+
+	return []CallStateChange{{
+		State:         StateQueued,
+		CallID:        linkedID,
+		From:          cs.from,
+		To:            cs.to,
+		Queue:         cs.queue,
+		QueuePosition: evt.GetInt("Position"),
+		Timestamp:     now,
+	}}
+}
+
+// handleQueueCallerAbandon runs when the caller hangs up while waiting
+// in a queue.
+func (c *Correlator) handleQueueCallerAbandon(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	cs.queueWait = c.queueWait(cs, evt, now)
+	cs.queued = false
+	cs.abandoned = true
+
+	return []CallStateChange{{
+		State:         StateAbandoned,
+		CallID:        linkedID,
+		From:          cs.from,
+		To:            cs.to,
+		Queue:         evt.Get("Queue"),
+		QueuePosition: evt.GetInt("Position"),
+		QueueWait:     cs.queueWait.Seconds(),
+		Timestamp:     now,
+	}}
+}
+
+// handleQueueCallerLeave runs when the call leaves the queue, which it
+// also does when an agent answers. Without an agent the caller timed out,
+// or the queue emptied, and the dialplan carries on with the call.
+func (c *Correlator) handleQueueCallerLeave(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil || !cs.queued {
+		return nil
+	}
+	cs.queued = false
+	cs.leftQueue = true
+	return nil
+}
+
+// handleAgentConnect runs when a queue member answers the call, which
+// answers it. The agent's channel is described by the Dest-prefixed
+// fields.
+func (c *Correlator) handleAgentConnect(evt ami.Event, linkedID string) []CallStateChange {
+	cs := c.calls[linkedID]
+	if cs == nil {
+		return nil
+	}
+
+	now := c.eventTime(evt)
+	cs.queued = false
+	cs.queueWait = c.queueWait(cs, evt, now)
+	d := cs.dest(evt.Get("DestUniqueid"))
+	if d != nil {
+		cs.answeredBy = d
+	}
+
+	var changes []CallStateChange
+	if !cs.answered {
+		changes = append(changes, cs.answer(now, evt.Get("DestUniqueid"), d))
+	}
+
+	agent := endpointWithPrefix(evt, "Dest")
+	if agent.Name == "" {
+		agent.Name = evt.Get("MemberName")
+	}
+
+	return append(changes, CallStateChange{
+		State:     StateAgentConnected,
+		CallID:    linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		Queue:     evt.Get("Queue"),
+		QueueWait: cs.queueWait.Seconds(),
+		Agent:     &agent,
+		Timestamp: now,
+	})
+}
+
+// queueWait is how long the caller waited in the queue: Asterisk's own
+// HoldTime when present, otherwise the time since QueueCallerJoin.
+func (c *Correlator) queueWait(cs *callState, evt ami.Event, now time.Time) time.Duration {
+	if evt.Get("HoldTime") != "" {
+		return time.Duration(evt.GetInt("HoldTime")) * time.Second
+	}
+	if cs.queueJoin.IsZero() {
+		return 0
+	}
+	return now.Sub(cs.queueJoin)
+}
+
+// releaseAnswer publishes an answer the dialplan made before anything
+// showed what the call was for, unless evt still leaves it on its way to a
+// queue or voicemail. The queue answers the caller to play music on hold,
+// and that answer is dropped when the call joins the queue, as it is when
+// VoiceMail starts; any other dialplan application, such as an IVR's
+// Playback, or dialing a phone or hanging up, shows the answer was real.
+func (cs *callState) releaseAnswer(evt ami.Event) []CallStateChange {
+	if cs.pendingAnswer == nil {
+		return nil
+	}
+	switch evt.Type() {
+	case "Newexten":
+		app := evt.Get("Application")
+		if strings.EqualFold(app, "Queue") || strings.EqualFold(app, "VoiceMail") {
+			return nil
+		}
+	case "VarSet", "Newstate", "QueueCallerJoin", "MusicOnHoldStart", "MusicOnHoldStop":
+		return nil
+	}
+	change := *cs.pendingAnswer
+	cs.pendingAnswer = nil
+	return []CallStateChange{change}
+}
+
+// dropPendingAnswer forgets an answer releaseAnswer is holding back, as the
+// call never was answered.
+func (cs *callState) dropPendingAnswer() {
+	if cs.pendingAnswer == nil {
+		return
+	}
+	cs.pendingAnswer = nil
+	cs.answered = false
+	cs.answerTime = time.Time{}
+	cs.answerChannel = ""
+}
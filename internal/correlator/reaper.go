@@ -0,0 +1,64 @@
+package correlator
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithMaxRinging sets how long a call may go unanswered before Reap
+// expires it. Zero disables the limit.
+func WithMaxRinging(d time.Duration) Option {
+	return func(corr *Correlator) { corr.maxRinging = d }
+}
+
+// WithMaxAnswered sets how long an answered call, or one in voicemail or
+// waiting in a queue, may last before Reap expires it. Zero disables the
+// limit.
+func WithMaxAnswered(d time.Duration) Option {
+	return func(corr *Correlator) { corr.maxAnswered = d }
+}
+
+// Reap expires calls that have outlived the configured limits, which
+// normally means their final Hangup event was lost. Each expired call is
+// reported as hung up with cause "expired". Call it periodically.
+func (c *Correlator) Reap() []CallStateChange {
+	now := c.now()
+
+	var changes []CallStateChange
+	for _, id := range c.sortedCallIDs() {
+		cs := c.calls[id]
+
+		var reason string
+		switch {
+		case cs.answered || cs.voicemail || cs.queued:
+			// A caller leaving a message, or holding for an agent, is no
+			// more stuck than one talking
+			since := cs.answerTime
+			switch {
+			case cs.voicemail:
+				since = cs.ringTime
+			case cs.queued:
+				since = cs.queueJoin
+			}
+			if c.maxAnswered > 0 && now.Sub(since) > c.maxAnswered {
+				reason = fmt.Sprintf("answered for longer than %s", c.maxAnswered)
+			}
+		default:
+			since := cs.ringTime
+			if since.IsZero() {
+				since = cs.createdAt
+			}
+			if c.maxRinging > 0 && now.Sub(since) > c.maxRinging {
+				reason = fmt.Sprintf("unanswered for longer than %s", c.maxRinging)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		changes = append(changes, c.expireChange(cs, now, "expired"))
+		c.decide(id, DecisionExpire, reason)
+		c.remove(id)
+	}
+	return changes
+}
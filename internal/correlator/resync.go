@@ -0,0 +1,240 @@
+package correlator
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Resync reconciles tracked calls against a CoreShowChannels snapshot taken
+// after (re)connecting to AMI. Calls that are no longer present are expired
+// and reported as hung up with cause "lost", calls that appeared while we
+// were not listening are rebuilt from their channels, and known calls that
+// progressed during the gap are reconciled. Every call's fate is reported
+// through the decision hook.
+func (c *Correlator) Resync(channels []ami.Event) []CallStateChange {
+	now := c.now()
+
+	groups := map[string][]ami.Event{}
+	var order []string
+	for _, ch := range channels {
+		linkedID := c.resolve(ch.Get("Linkedid"))
+		if linkedID == "" {
+			continue
+		}
+		if _, seen := groups[linkedID]; !seen {
+			order = append(order, linkedID)
+		}
+		groups[linkedID] = append(groups[linkedID], ch)
+	}
+
+	var changes []CallStateChange
+
+	for _, linkedID := range c.sortedCallIDs() {
+		if _, live := groups[linkedID]; live {
+			continue
+		}
+		changes = append(changes, c.expireChange(c.calls[linkedID], now, "lost"))
+		c.decide(linkedID, DecisionExpire, "not in channel list")
+		c.remove(linkedID)
+	}
+
+	for _, linkedID := range order {
+		snap := snapshotCall(linkedID, groups[linkedID], now)
+
+		cs, known := c.calls[linkedID]
+		if !known {
+			c.calls[linkedID] = snap
+			switch {
+			case snap.voicemail:
+				changes = append(changes, voicemailChange(snap, now))
+			case snap.queued:
+				changes = append(changes, queuedChange(snap, now))
+			case snap.answered:
+				changes = append(changes, answeredChange(snap, now))
+			case snap.rung:
+				changes = append(changes, ringingChange(snap, now))
+			}
+			c.decide(linkedID, DecisionReconcile, "started while disconnected")
+			continue
+		}
+
+		cs.stale = false
+		switch {
+		case snap.voicemail && !cs.voicemail && cs.answeredBy == nil:
+			cs.voicemail = true
+			cs.mailbox = snap.mailbox
+			changes = append(changes, voicemailChange(cs, now))
+			c.decide(linkedID, DecisionReconcile, "went to voicemail while disconnected")
+		case snap.queued && !cs.queued && !cs.answered && !cs.voicemail:
+			cs.queued = true
+			cs.queue = snap.queue
+			cs.queueJoin = snap.queueJoin
+			changes = append(changes, queuedChange(cs, now))
+			c.decide(linkedID, DecisionReconcile, "joined a queue while disconnected")
+		case snap.answered && !cs.answered && !cs.voicemail:
+			if !cs.rung {
+				cs.rung = true
+				cs.ringTime = snap.ringTime
+			}
+			cs.answered = true
+			cs.answerTime = snap.answerTime
+			changes = append(changes, answeredChange(cs, now))
+			c.decide(linkedID, DecisionReconcile, "answered while disconnected")
+		case snap.rung && !cs.rung:
+			cs.rung = true
+			cs.ringTime = snap.ringTime
+			changes = append(changes, ringingChange(cs, now))
+			c.decide(linkedID, DecisionReconcile, "started ringing while disconnected")
+		default:
+			c.decide(linkedID, DecisionKeep, "still in channel list")
+		}
+	}
+
+	return c.record(changes)
+}
+
+func ringingChange(cs *callState, now time.Time) CallStateChange {
+	return CallStateChange{
+		State:     StateRinging,
+		CallID:    cs.linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		Timestamp: now,
+	}
+}
+
+func voicemailChange(cs *callState, now time.Time) CallStateChange {
+	return CallStateChange{
+		State:     StateVoicemail,
+		CallID:    cs.linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		Mailbox:   cs.mailbox,
+		MissedBy:  cs.missedBy(),
+		Timestamp: now,
+	}
+}
+
+// queuedChange reports a call found waiting in a queue. Its position is
+// not in the channel list.
+func queuedChange(cs *callState, now time.Time) CallStateChange {
+	return CallStateChange{
+		State:     StateQueued,
+		CallID:    cs.linkedID,
+		From:      cs.from,
+		To:        cs.to,
+		Queue:     cs.queue,
+		Timestamp: now,
+	}
+}
+
+func answeredChange(cs *callState, now time.Time) CallStateChange {
+	ringDur := 0.0
+	if !cs.ringTime.IsZero() && cs.answerTime.After(cs.ringTime) {
+		ringDur = cs.answerTime.Sub(cs.ringTime).Seconds()
+	}
+	return CallStateChange{
+		State:        StateAnswered,
+		CallID:       cs.linkedID,
+		From:         cs.from,
+		To:           cs.to,
+		RingDuration: ringDur,
+		Timestamp:    now,
+	}
+}
+
+// snapshotCall rebuilds a callState from the CoreShowChannel entries that
+// share a Linkedid. Times are estimated from each channel's Duration.
+func snapshotCall(linkedID string, channels []ami.Event, now time.Time) *callState {
+	cs := &callState{linkedID: linkedID, channels: map[string]bool{}}
+
+	origin := channels[0]
+	for _, ch := range channels {
+		if ch.Get("Uniqueid") == linkedID {
+			origin = ch
+			break
+		}
+	}
+	cs.from = Endpoint{
+		Extension: origin.Get("CallerIDNum"),
+		Name:      origin.Get("CallerIDName"),
+	}
+	cs.fromChannel = origin.Get("Uniqueid")
+	cs.to = Endpoint{Extension: origin.Get("Exten")}
+	if num := origin.GetKnown("ConnectedLineNum"); num != "" {
+		cs.to = Endpoint{
+			Extension: num,
+			Name:      origin.GetKnown("ConnectedLineName"),
+		}
+	}
+
+	var oldest, newestUp time.Duration
+	newestUp = -1
+	agentUp := false // a channel other than the caller's in Queue is up
+	for _, ch := range channels {
+		cs.addChannel(ch.Get("Uniqueid"))
+		age := parseChannelDuration(ch.Get("Duration"))
+		if age > oldest {
+			oldest = age
+		}
+		if strings.EqualFold(ch.Get("Application"), "VoiceMail") {
+			cs.voicemail = true
+			cs.mailbox = voicemailMailbox(ch.Get("ApplicationData"))
+		}
+		inQueue := strings.EqualFold(ch.Get("Application"), "Queue")
+		if inQueue {
+			cs.queue, _, _ = strings.Cut(ch.Get("ApplicationData"), ",")
+		}
+		switch ch.Get("ChannelStateDesc") {
+		case "Ringing":
+			cs.rung = true
+		case "Up":
+			cs.rung = true
+			cs.answered = true
+			agentUp = agentUp || !inQueue
+			// The most recently created Up channel is the closest
+			// approximation we have to the moment of answer.
+			if newestUp < 0 || age < newestUp {
+				newestUp = age
+			}
+		}
+	}
+
+	cs.createdAt = now.Add(-oldest)
+	cs.ringTime = cs.createdAt
+	if cs.voicemail {
+		// The only channel up is the one voicemail answered.
+		cs.answered = false
+	}
+	if cs.queue != "" && !agentUp {
+		// The queue answered the caller for music on hold; no agent has
+		// connected yet.
+		cs.queued = true
+		cs.queueJoin = cs.createdAt
+		cs.answered = false
+	}
+	if cs.answered {
+		cs.answerTime = now.Add(-newestUp)
+	}
+	return cs
+}
+
+// parseChannelDuration parses CoreShowChannel's "HH:MM:SS" Duration field.
+func parseChannelDuration(s string) time.Duration {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0
+		}
+		total += time.Duration(n) * unit
+	}
+	return total
+}
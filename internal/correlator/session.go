@@ -0,0 +1,156 @@
+package correlator
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// DecisionAction is what the correlator did with a tracked call at an AMI
+// session boundary.
+type DecisionAction string
+
+const (
+	// DecisionKeep means the call is still live and nothing changed.
+	DecisionKeep DecisionAction = "keep"
+	// DecisionReconcile means the call's state was rebuilt or advanced
+	// from what Asterisk reported after reconnecting.
+	DecisionReconcile DecisionAction = "reconcile"
+	// DecisionExpire means the call was dropped and reported as hung up.
+	DecisionExpire DecisionAction = "expire"
+)
+
+// Decision records the fate of one call at a session boundary.
+type Decision struct {
+	CallID string
+	Action DecisionAction
+	Reason string
+}
+
+// WithDecisionHook registers a function called for every Decision the
+// correlator makes, e.g. to log it.
+func WithDecisionHook(fn func(Decision)) Option {
+	return func(corr *Correlator) { corr.onDecision = fn }
+}
+
+func (c *Correlator) decide(callID string, action DecisionAction, reason string) {
+	if c.onDecision != nil {
+		c.onDecision(Decision{CallID: callID, Action: action, Reason: reason})
+	}
+}
+
+// SessionEnded tells the correlator that the AMI connection has been lost.
+// Tracked calls are kept but marked stale until the next session confirms
+// them, via Resync or a FullyBooted event.
+func (c *Correlator) SessionEnded() {
+	c.sessionEndedAt = c.now()
+	for _, cs := range c.calls {
+		cs.stale = true
+	}
+}
+
+// confirm clears the stale mark on a call once the new session shows
+// activity for it.
+func (c *Correlator) confirm(cs *callState) {
+	if cs.stale {
+		cs.stale = false
+		c.decide(cs.linkedID, DecisionKeep, "activity after reconnect")
+	}
+}
+
+// handleFullyBooted runs when Asterisk reports it is fully booted, which it
+// does on every new AMI login. If Asterisk's uptime shows it restarted since
+// our last session, every stale call is gone.
+func (c *Correlator) handleFullyBooted(evt ami.Event) []CallStateChange {
+	if c.sessionEndedAt.IsZero() || evt.Get("Uptime") == "" {
+		return nil
+	}
+	now := c.eventTime(evt)
+	startedAt := now.Add(-time.Duration(evt.GetInt("Uptime")) * time.Second)
+
+	if !startedAt.After(c.sessionEndedAt) {
+		for _, id := range c.sortedCallIDs() {
+			if cs := c.calls[id]; cs.stale {
+				cs.stale = false
+				c.decide(id, DecisionKeep, "asterisk did not restart")
+			}
+		}
+		return nil
+	}
+
+	var changes []CallStateChange
+	for _, id := range c.sortedCallIDs() {
+		cs := c.calls[id]
+		if !cs.stale {
+			continue
+		}
+		changes = append(changes, c.expireChange(cs, now, "asterisk_restarted"))
+		c.decide(id, DecisionExpire, "asterisk restarted")
+		c.remove(id)
+	}
+	return changes
+}
+
+// handleShutdown runs when Asterisk announces it is shutting down, which
+// ends every call it is carrying.
+func (c *Correlator) handleShutdown(evt ami.Event) []CallStateChange {
+	reason := "asterisk shutting down"
+	if evt.Get("Restart") == "True" {
+		reason = "asterisk restarting"
+	}
+
+	now := c.eventTime(evt)
+	var changes []CallStateChange
+	for _, id := range c.sortedCallIDs() {
+		changes = append(changes, c.expireChange(c.calls[id], now, "asterisk_shutdown"))
+		c.decide(id, DecisionExpire, reason)
+		c.remove(id)
+	}
+	return changes
+}
+
+// expireChange builds the synthetic hangup for a call the correlator is
+// dropping without having seen its Hangup event. cause is one of
+// syntheticCauses.
+func (c *Correlator) expireChange(cs *callState, now time.Time, cause string) CallStateChange {
+	info := syntheticCauses[cause]
+	cs.endHold(now)
+	talkDur := 0.0
+	if cs.answered && !cs.answerTime.IsZero() {
+		talkDur = now.Sub(cs.answerTime).Seconds()
+	}
+	totalDur := 0.0
+	if !cs.ringTime.IsZero() {
+		totalDur = now.Sub(cs.ringTime).Seconds()
+	}
+	return CallStateChange{
+		State:            StateHungUp,
+		CallID:           cs.linkedID,
+		From:             cs.from,
+		To:               cs.to,
+		Mailbox:          cs.mailbox,
+		Queue:            cs.queue,
+		QueueWait:        cs.queueWait.Seconds(),
+		Outcome:          cs.outcome(0),
+		Cause:            info.Name,
+		CauseDescription: c.describe(info, false),
+		CauseCategory:    info.Category,
+		TalkDuration:     talkDur,
+		TotalDuration:    totalDur,
+		HoldDuration:     cs.holdTotal.Seconds(),
+		HoldCount:        cs.holdCount,
+		Timestamp:        now,
+	}
+}
+
+// sortedCallIDs returns the tracked call IDs in a stable order so that
+// bulk operations emit changes deterministically.
+func (c *Correlator) sortedCallIDs() []string {
+	ids := make([]string, 0, len(c.calls))
+	for id := range c.calls {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,67 @@
+package correlator
+
+import "time"
+
+// ActiveCall is a call in progress as it was last reported.
+type ActiveCall struct {
+	CallID string
+	From   Endpoint
+	To     Endpoint
+	State  CallState // ringing, answered, voicemail, held, parked or queued
+	Since  time.Time // when the call entered State
+}
+
+// Calls returns the calls in progress that have been reported, i.e. have
+// at least started ringing, ordered by call ID.
+func (c *Correlator) Calls() []ActiveCall {
+	var calls []ActiveCall
+	for _, id := range c.sortedCallIDs() {
+		cs := c.calls[id]
+		if cs.state == "" {
+			continue
+		}
+		calls = append(calls, ActiveCall{
+			CallID: cs.linkedID,
+			From:   cs.from,
+			To:     cs.to,
+			State:  cs.state,
+			Since:  cs.since,
+		})
+	}
+	return calls
+}
+
+// record notes the state each change leaves its call in, for Calls.
+func (c *Correlator) record(changes []CallStateChange) []CallStateChange {
+	for _, change := range changes {
+		cs := c.calls[change.CallID]
+		if cs == nil {
+			continue
+		}
+		if state := resultingState(change); state != "" && state != cs.state {
+			cs.state = state
+			cs.since = change.Timestamp
+		}
+	}
+	return changes
+}
+
+// resultingState maps a change to the state the call is in afterwards, or
+// "" if the change leaves it as it was.
+func resultingState(change CallStateChange) CallState {
+	switch change.State {
+	case StateRinging, StateAnswered, StateVoicemail, StateHeld, StateParked, StateQueued:
+		return change.State
+	case StateResumed, StateAgentConnected:
+		return StateAnswered
+	case StateUnparked:
+		switch change.UnparkReason {
+		case UnparkRetrieved:
+			return StateAnswered
+		case UnparkTimeout:
+			// Asterisk rings the party who parked the call
+			return StateRinging
+		}
+	}
+	return ""
+}
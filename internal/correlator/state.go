@@ -9,8 +9,51 @@ const (
 	StateRinging  CallState = "ringing"
 	StateAnswered CallState = "answered"
 	StateHungUp   CallState = "hungup"
+
+	StateTransferred CallState = "transferred"
+
+	StateHeld    CallState = "held"
+	StateResumed CallState = "resumed"
+
+	// Queue states; see CallStateChange.Queue.
+	StateQueued         CallState = "queued"
+	StateAbandoned      CallState = "abandoned"
+	StateAgentConnected CallState = "agent_connected"
+
+	// StateParked and StateUnparked bracket the time the call waits in a
+	// parking slot; see CallStateChange.ParkingLot.
+	StateParked   CallState = "parked"
+	StateUnparked CallState = "unparked"
+
+	// StateUpdated reports a change to either party's caller ID once the
+	// call has been reported; see WithIdentityUpdates.
+	StateUpdated CallState = "updated"
+
+	// StateVoicemail replaces StateAnswered when an unanswered call is
+	// picked up by voicemail.
+	StateVoicemail CallState = "voicemail"
+
+	// StateLeg reports progress of one dialed destination; see Leg.
+	StateLeg CallState = "leg"
 )
 
+// states lists every CallState the correlator reports.
+var states = []CallState{
+	StateRinging, StateAnswered, StateHungUp, StateTransferred, StateHeld,
+	StateResumed, StateQueued, StateAbandoned, StateAgentConnected,
+	StateParked, StateUnparked, StateUpdated, StateVoicemail, StateLeg,
+}
+
+// IsState reports whether name is a CallState the correlator reports.
+func IsState(name string) bool {
+	for _, s := range states {
+		if string(s) == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Endpoint represents an internal extension.
 type Endpoint struct {
 	Extension string `json:"extension"`
@@ -28,26 +71,51 @@ type CallStateChange struct {
 	// Ringing -> Answered
 	RingDuration float64 `json:"ring_duration_seconds,omitempty"`
 
-	// HungUp fields
-	Cause            string  `json:"cause,omitempty"`
-	CauseDescription string  `json:"cause_description,omitempty"`
-	CauseCode        int     `json:"cause_code,omitempty"`
-	TalkDuration     float64 `json:"talk_duration_seconds,omitempty"`
-	TotalDuration    float64 `json:"total_duration_seconds,omitempty"`
-}
+	// Answered and HungUp: which dialed destination picked up, and which
+	// rang without answering (e.g. other hunt group members)
+	AnsweredBy *Endpoint  `json:"answered_by,omitempty"`
+	MissedBy   []Endpoint `json:"missed_by,omitempty"`
+
+	// Answered and HungUp: who answered by call pickup from another phone;
+	// they are then also AnsweredBy and To
+	PickedUpBy *Endpoint `json:"picked_up_by,omitempty"`
+
+	// Queued, Abandoned, AgentConnected and HungUp: the app_queue queue
+	// the call went through, the caller's place in it and how long they
+	// waited; AgentConnected also names the queue member who took the call
+	Queue         string    `json:"queue,omitempty"`
+	QueuePosition int       `json:"queue_position,omitempty"`
+	QueueWait     float64   `json:"queue_wait_seconds,omitempty"`
+	Agent         *Endpoint `json:"agent,omitempty"`
+
+	// Parked and Unparked: where the call was parked; Unparked also says
+	// why it left the slot (see UnparkRetrieved) and who retrieved it
+	ParkingLot   string    `json:"parking_lot,omitempty"`
+	ParkingSlot  string    `json:"parking_slot,omitempty"`
+	UnparkReason string    `json:"unpark_reason,omitempty"`
+	RetrievedBy  *Endpoint `json:"retrieved_by,omitempty"`
 
-// HangupCause maps Asterisk hangup cause codes to names and descriptions.
-var HangupCause = map[int]struct {
-	Name        string
-	Description string
-}{
-	0:   {"unknown", "Unknown or no cause provided"},
-	16:  {"normal_clearing", "The call was hung up normally by one of the parties"},
-	17:  {"user_busy", "The destination was busy"},
-	18:  {"no_answer", "The destination did not answer"},
-	19:  {"no_answer", "The destination did not answer within the timeout"},
-	21:  {"call_rejected", "The call was rejected by the destination"},
-	31:  {"normal_unspecified", "Normal call clearing, unspecified cause"},
-	34:  {"congestion", "All circuits are busy or no circuit is available"},
-	127: {"interworking", "An interworking error occurred"},
+	// Voicemail and HungUp: the mailbox that took the call
+	Mailbox string `json:"mailbox,omitempty"`
+
+	// Held, Resumed and HungUp: how many times the call was put on hold,
+	// and for how long — this hold when resumed, all holds when hung up
+	HoldDuration float64 `json:"hold_duration_seconds,omitempty"`
+	HoldCount    int     `json:"hold_count,omitempty"`
+
+	// Leg fields, only set on StateLeg changes
+	Leg *Leg `json:"leg,omitempty"`
+
+	// Transferred fields
+	TransferType  string   `json:"transfer_type,omitempty"` // "blind" or "attended"
+	TransferredBy Endpoint `json:"transferred_by,omitempty"`
+
+	// HungUp fields
+	Outcome          Outcome       `json:"outcome,omitempty"`
+	Cause            string        `json:"cause,omitempty"`
+	CauseDescription string        `json:"cause_description,omitempty"`
+	CauseCategory    CauseCategory `json:"cause_category,omitempty"`
+	CauseCode        int           `json:"cause_code,omitempty"`
+	TalkDuration     float64       `json:"talk_duration_seconds,omitempty"`
+	TotalDuration    float64       `json:"total_duration_seconds,omitempty"`
 }
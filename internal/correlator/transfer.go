@@ -0,0 +1,108 @@
+package correlator
+
+import "github.com/sweeney/asterisk-mqtt/internal/ami"
+
+// handleBlindTransfer runs when a party redirects the call to another
+// extension without consulting it first. The transferee stays on the
+// same Linkedid, so the call keeps its identity; from now on it is between
+// the transferee and the new destination.
+func (c *Correlator) handleBlindTransfer(evt ami.Event) []CallStateChange {
+	if evt.Get("Result") != "Success" {
+		return nil
+	}
+
+	cs := c.transferCall(evt.Get("TransfereeLinkedid"), evt.Get("TransfererLinkedid"))
+	if cs == nil {
+		return nil
+	}
+
+	by := endpointWithPrefix(evt, "Transferer")
+	cs.from = endpointWithPrefix(evt, "Transferee")
+	cs.fromChannel = evt.Get("TransfereeUniqueid")
+	cs.to = Endpoint{Extension: evt.Get("Extension")}
+	cs.transferred = true
+	cs.addChannel(evt.Get("TransfereeUniqueid"))
+	delete(cs.channels, evt.Get("TransfererUniqueid"))
+
+	return []CallStateChange{c.transferChange(cs, evt, "blind", by)}
+}
+
+// handleAttendedTransfer runs when a party who has consulted a second
+// party joins the original caller to them. The consultation call is merged
+// into the original call: its Linkedid becomes an alias, it is reported as
+// hung up with cause "transferred", and the original call carries on
+// between the transferee and the transfer target.
+func (c *Correlator) handleAttendedTransfer(evt ami.Event) []CallStateChange {
+	if evt.Get("Result") != "Success" {
+		return nil
+	}
+
+	cs := c.transferCall(evt.Get("TransfereeLinkedid"), evt.Get("OrigTransfererLinkedid"))
+	if cs == nil {
+		return nil
+	}
+
+	by := endpointWithPrefix(evt, "OrigTransferer")
+	cs.from = endpointWithPrefix(evt, "Transferee")
+	cs.fromChannel = evt.Get("TransfereeUniqueid")
+	cs.to = endpointWithPrefix(evt, "TransferTarget")
+	cs.transferred = true
+
+	changes := []CallStateChange{c.transferChange(cs, evt, "attended", by)}
+
+	consult := c.transferCall(evt.Get("TransferTargetLinkedid"), evt.Get("SecondTransfererLinkedid"))
+	if consult != nil && consult != cs {
+		for uid := range consult.channels {
+			cs.addChannel(uid)
+		}
+		changes = append(changes, c.expireChange(consult, c.eventTime(evt), "transferred"))
+		c.remove(consult.linkedID)
+	}
+
+	// Events for the target's leg keep arriving under the consultation
+	// call's Linkedid; route them to this call from now on.
+	for _, id := range []string{evt.Get("TransferTargetLinkedid"), evt.Get("SecondTransfererLinkedid")} {
+		if id != "" && id != cs.linkedID && c.calls[id] == nil {
+			c.aliases[id] = cs.linkedID
+		}
+	}
+
+	cs.addChannel(evt.Get("TransfereeUniqueid"))
+	cs.addChannel(evt.Get("TransferTargetUniqueid"))
+	delete(cs.channels, evt.Get("OrigTransfererUniqueid"))
+	delete(cs.channels, evt.Get("SecondTransfererUniqueid"))
+
+	return changes
+}
+
+// transferCall finds the tracked call for the first of the given
+// Linkedids that is known.
+func (c *Correlator) transferCall(linkedIDs ...string) *callState {
+	for _, id := range linkedIDs {
+		if cs := c.calls[c.resolve(id)]; cs != nil {
+			return cs
+		}
+	}
+	return nil
+}
+
+func (c *Correlator) transferChange(cs *callState, evt ami.Event, kind string, by Endpoint) CallStateChange {
+	return CallStateChange{
+		State:         StateTransferred,
+		CallID:        cs.linkedID,
+		From:          cs.from,
+		To:            cs.to,
+		TransferType:  kind,
+		TransferredBy: by,
+		Timestamp:     c.eventTime(evt),
+	}
+}
+
+// endpointWithPrefix reads the caller ID of one party in a transfer event,
+// e.g. TransfereeCallerIDNum / TransfereeCallerIDName for prefix "Transferee".
+func endpointWithPrefix(evt ami.Event, prefix string) Endpoint {
+	return Endpoint{
+		Extension: evt.GetKnown(prefix + "CallerIDNum"),
+		Name:      evt.GetKnown(prefix + "CallerIDName"),
+	}
+}
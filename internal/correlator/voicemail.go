@@ -0,0 +1,45 @@
+package correlator
+
+import (
+	"strings"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// handleDialplanApp watches the dialplan applications a call runs, to
+// spot it falling through to voicemail. Newexten carries the application
+// for each dialplan step; VarSet does too when Asterisk is configured to
+// include it.
+func (c *Correlator) handleDialplanApp(evt ami.Event, linkedID string) []CallStateChange {
+	if !strings.EqualFold(evt.Get("Application"), "VoiceMail") {
+		return nil
+	}
+	cs := c.calls[linkedID]
+	if cs == nil || cs.voicemail {
+		return nil
+	}
+	// A call someone answered and then sent to voicemail was answered. If
+	// only the channel now running VoiceMail was answered, the dialplan
+	// did that itself, e.g. to play an announcement first.
+	if cs.answeredBy != nil || (cs.answered && cs.answerChannel != evt.Get("Uniqueid")) {
+		return nil
+	}
+	// An answer made just to start voicemail isn't reported at all
+	cs.dropPendingAnswer()
+
+	now := c.eventTime(evt)
+	cs.voicemail = true
+	cs.mailbox = voicemailMailbox(evt.Get("AppData"))
+	if cs.ringTime.IsZero() {
+		cs.ringTime = now
+	}
+
+	return []CallStateChange{voicemailChange(cs, now)}
+}
+
+// voicemailMailbox extracts the mailbox from VoiceMail's arguments, e.g.
+// "21@default" from "21@default,u". Several mailboxes are joined with "&".
+func voicemailMailbox(appData string) string {
+	mailbox, _, _ := strings.Cut(appData, ",")
+	return strings.TrimSpace(mailbox)
+}
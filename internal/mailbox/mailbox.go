@@ -0,0 +1,114 @@
+// Package mailbox tracks voicemail message-waiting state per mailbox from
+// AMI events and action responses.
+package mailbox
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Status is the message count of one mailbox.
+type Status struct {
+	Mailbox   string // e.g. "21@default"
+	New       int
+	Old       int
+	Timestamp time.Time
+}
+
+// Waiting reports whether the mailbox has unheard messages.
+func (s Status) Waiting() bool {
+	return s.New > 0
+}
+
+// Tracker keeps the last known Status of every mailbox and reports only
+// the ones that change.
+type Tracker struct {
+	mailboxes map[string]Status
+	clock     func() time.Time
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		mailboxes: make(map[string]Status),
+		clock:     time.Now,
+	}
+}
+
+// Process ingests an AMI event and returns the mailbox status it changed,
+// if any. Only MessageWaiting events are of interest.
+func (t *Tracker) Process(evt ami.Event) []Status {
+	if evt.Type() != "MessageWaiting" {
+		return nil
+	}
+	mailbox := evt.Get("Mailbox")
+	if mailbox == "" {
+		return nil
+	}
+
+	s := Status{Mailbox: mailbox, New: evt.GetInt("New"), Old: evt.GetInt("Old")}
+	if evt.Get("New") == "" && waiting(evt.Get("Waiting")) {
+		// Older Asterisk versions only say whether messages are waiting.
+		s.New = max(t.mailboxes[mailbox].New, 1)
+		s.Old = t.mailboxes[mailbox].Old
+	}
+	return t.update(s, evt.Timestamp())
+}
+
+// Count ingests the response to a MailboxCount action.
+func (t *Tracker) Count(resp ami.Response) []Status {
+	mailbox := resp.Get("Mailbox")
+	if mailbox == "" {
+		return nil
+	}
+	return t.update(Status{
+		Mailbox: mailbox,
+		New:     resp.GetInt("NewMessages"),
+		Old:     resp.GetInt("OldMessages"),
+	}, time.Time{})
+}
+
+// Mailboxes lists the mailboxes in a VoicemailUsersList response, as
+// "mailbox@context", in a stable order.
+func Mailboxes(resp ami.Response) []string {
+	var mailboxes []string
+	for _, entry := range resp.Events {
+		if entry.Type() != "VoicemailUserEntry" || entry.Get("VoiceMailbox") == "" {
+			continue
+		}
+		mailbox := entry.Get("VoiceMailbox")
+		if ctx := entry.Get("VMContext"); ctx != "" {
+			mailbox += "@" + ctx
+		}
+		mailboxes = append(mailboxes, mailbox)
+	}
+	sort.Strings(mailboxes)
+	return mailboxes
+}
+
+// update records s, returning it if the counts differ from what was known.
+func (t *Tracker) update(s Status, at time.Time) []Status {
+	if at.IsZero() {
+		at = t.clock()
+	}
+	s.Timestamp = at
+
+	if prev, ok := t.mailboxes[s.Mailbox]; ok && prev.New == s.New && prev.Old == s.Old {
+		return nil
+	}
+	t.mailboxes[s.Mailbox] = s
+	return []Status{s}
+}
+
+// waiting parses MessageWaiting's Waiting header, which is "1"/"0" on
+// current Asterisk and "yes"/"no" on older versions.
+func waiting(v string) bool {
+	switch strings.ToLower(v) {
+	case "1", "yes", "true":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package mailbox_test
+
+import (
+	"testing"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/mailbox"
+)
+
+func messageWaiting(kvs ...string) ami.Event {
+	return ami.NewEvent(append([]string{"Event", "MessageWaiting"}, kvs...)...)
+}
+
+func TestMessageWaitingCounts(t *testing.T) {
+	tr := mailbox.NewTracker()
+
+	got := tr.Process(messageWaiting("Mailbox", "21@default", "Waiting", "1", "New", "2", "Old", "5",
+		"Timestamp", "1770888509.500000"))
+	if len(got) != 1 {
+		t.Fatalf("expected 1 status, got %d", len(got))
+	}
+	s := got[0]
+	if s.Mailbox != "21@default" || s.New != 2 || s.Old != 5 || !s.Waiting() {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if s.Timestamp.Unix() != 1770888509 {
+		t.Errorf("expected event timestamp, got %v", s.Timestamp)
+	}
+
+	// Listened to both new messages
+	got = tr.Process(messageWaiting("Mailbox", "21@default", "Waiting", "0", "New", "0", "Old", "7"))
+	if len(got) != 1 || got[0].New != 0 || got[0].Old != 7 || got[0].Waiting() {
+		t.Errorf("unexpected status after listening %+v", got)
+	}
+}
+
+func TestMessageWaitingUnchangedIsSuppressed(t *testing.T) {
+	tr := mailbox.NewTracker()
+	tr.Process(messageWaiting("Mailbox", "21@default", "Waiting", "1", "New", "1", "Old", "0"))
+
+	if got := tr.Process(messageWaiting("Mailbox", "21@default", "Waiting", "1", "New", "1", "Old", "0")); len(got) != 0 {
+		t.Errorf("expected no change, got %+v", got)
+	}
+}
+
+func TestMessageWaitingWithoutCounts(t *testing.T) {
+	tr := mailbox.NewTracker()
+
+	got := tr.Process(messageWaiting("Mailbox", "22@default", "Waiting", "yes"))
+	if len(got) != 1 || got[0].New != 1 || !got[0].Waiting() {
+		t.Errorf("expected waiting with at least 1 new message, got %+v", got)
+	}
+	got = tr.Process(messageWaiting("Mailbox", "22@default", "Waiting", "no"))
+	if len(got) != 1 || got[0].Waiting() {
+		t.Errorf("expected no messages waiting, got %+v", got)
+	}
+}
+
+func TestProcessIgnoresOtherEvents(t *testing.T) {
+	tr := mailbox.NewTracker()
+	if got := tr.Process(ami.NewEvent("Event", "Newchannel", "Mailbox", "21@default")); len(got) != 0 {
+		t.Errorf("expected nothing, got %+v", got)
+	}
+	if got := tr.Process(messageWaiting("Waiting", "1")); len(got) != 0 {
+		t.Errorf("expected nothing without a mailbox, got %+v", got)
+	}
+}
+
+func TestCountFromMailboxCountResponse(t *testing.T) {
+	tr := mailbox.NewTracker()
+	resp := ami.Response{Event: ami.NewEvent("Response", "Success", "Message", "Mailbox Message Count",
+		"Mailbox", "21@default", "UrgMessages", "0", "NewMessages", "3", "OldMessages", "1")}
+
+	got := tr.Count(resp)
+	if len(got) != 1 || got[0].New != 3 || got[0].Old != 1 {
+		t.Fatalf("unexpected status %+v", got)
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Error("expected a timestamp")
+	}
+
+	// A MessageWaiting with the same counts is not a change
+	if got := tr.Process(messageWaiting("Mailbox", "21@default", "Waiting", "1", "New", "3", "Old", "1")); len(got) != 0 {
+		t.Errorf("expected no change, got %+v", got)
+	}
+}
+
+func TestMailboxesFromUsersList(t *testing.T) {
+	resp := ami.Response{Events: []ami.Event{
+		ami.NewEvent("Event", "VoicemailUserEntry", "VMContext", "default", "VoiceMailbox", "21", "Fullname", "Kitchen"),
+		ami.NewEvent("Event", "VoicemailUserEntry", "VMContext", "default", "VoiceMailbox", "1986", "Fullname", "Martin"),
+		ami.NewEvent("Event", "VoicemailUserEntry", "VMContext", "default", "VoiceMailbox", ""),
+	}}
+
+	got := mailbox.Mailboxes(resp)
+	if len(got) != 2 || got[0] != "1986@default" || got[1] != "21@default" {
+		t.Errorf("expected [1986@default 21@default], got %v", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Package parking tracks which calls are parked in each parking lot from
+// AMI events and action responses.
+package parking
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Call is a call waiting in a parking slot.
+type Call struct {
+	Slot      string // parking space, e.g. "701"
+	CallID    string // Linkedid of the parked call
+	Extension string // the parked party
+	Name      string
+	ParkedAt  time.Time
+	Timeout   time.Duration // how long the call may stay parked, 0 if unknown
+}
+
+// Lot is the contents of one parking lot.
+type Lot struct {
+	Name      string
+	Calls     []Call // in slot order
+	Timestamp time.Time
+}
+
+// Tracker keeps the contents of every parking lot and reports the lots
+// that change.
+type Tracker struct {
+	lots  map[string]map[string]Call // lot -> slot -> call
+	clock func() time.Time
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		lots:  make(map[string]map[string]Call),
+		clock: time.Now,
+	}
+}
+
+// Process ingests an AMI event and returns the lot it changed, if any.
+// ParkedCall is both the unsolicited event and the list event of the
+// ParkedCalls action; Parkinglot is the list event of ParkingLots.
+func (t *Tracker) Process(evt ami.Event) []Lot {
+	now := evt.Timestamp()
+	if now.IsZero() {
+		now = t.clock()
+	}
+
+	switch evt.Type() {
+	case "Parkinglot":
+		name := evt.Get("Name")
+		if name == "" || t.lots[name] != nil {
+			return nil
+		}
+		t.lot(name)
+		return t.report(name, now)
+
+	case "ParkedCall":
+		name, slot := evt.Get("Parkinglot"), evt.Get("ParkingSpace")
+		if name == "" || slot == "" {
+			return nil
+		}
+		// ParkingDuration is how long the call has already been parked,
+		// which matters when seeding from ParkedCalls.
+		parked := now.Add(-time.Duration(evt.GetInt("ParkingDuration")) * time.Second)
+		call := Call{
+			Slot:      slot,
+			CallID:    evt.Get("ParkeeLinkedid"),
+			Extension: evt.GetKnown("ParkeeCallerIDNum"),
+			Name:      evt.GetKnown("ParkeeCallerIDName"),
+			ParkedAt:  parked,
+			Timeout:   time.Duration(evt.GetInt("ParkingTimeout")) * time.Second,
+		}
+		if prev, ok := t.lot(name)[slot]; ok && prev.CallID == call.CallID {
+			return nil
+		}
+		t.lots[name][slot] = call
+		return t.report(name, now)
+
+	case "UnParkedCall", "ParkedCallTimeOut", "ParkedCallGiveUp":
+		name, slot := evt.Get("Parkinglot"), evt.Get("ParkingSpace")
+		if _, ok := t.lots[name][slot]; !ok {
+			return nil
+		}
+		delete(t.lots[name], slot)
+		return t.report(name, now)
+	}
+	return nil
+}
+
+// Seed replaces what the tracker knows with the responses of ParkingLots
+// and ParkedCalls, returning every lot, including lots that emptied while
+// the tracker wasn't watching.
+func (t *Tracker) Seed(resps ...ami.Response) []Lot {
+	prev := t.lots
+	t.lots = make(map[string]map[string]Call)
+	for name := range prev {
+		t.lot(name)
+	}
+	for _, resp := range resps {
+		for _, evt := range resp.Events {
+			t.Process(evt)
+		}
+	}
+
+	names := make([]string, 0, len(t.lots))
+	for name := range t.lots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := t.clock()
+	var lots []Lot
+	for _, name := range names {
+		lots = append(lots, t.report(name, now)...)
+	}
+	return lots
+}
+
+func (t *Tracker) lot(name string) map[string]Call {
+	slots := t.lots[name]
+	if slots == nil {
+		slots = make(map[string]Call)
+		t.lots[name] = slots
+	}
+	return slots
+}
+
+// report returns the lot's calls in slot order.
+func (t *Tracker) report(name string, now time.Time) []Lot {
+	lot := Lot{Name: name, Calls: []Call{}, Timestamp: now}
+	for _, call := range t.lots[name] {
+		lot.Calls = append(lot.Calls, call)
+	}
+	sort.Slice(lot.Calls, func(i, j int) bool {
+		a, b := lot.Calls[i].Slot, lot.Calls[j].Slot
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return []Lot{lot}
+}
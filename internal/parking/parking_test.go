@@ -0,0 +1,96 @@
+package parking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/parking"
+)
+
+func parked(slot, linkedID, ext string, kvs ...string) ami.Event {
+	return ami.NewEvent(append([]string{"Event", "ParkedCall", "Parkinglot", "default", "ParkingSpace", slot,
+		"ParkeeLinkedid", linkedID, "ParkeeCallerIDNum", ext, "ParkeeCallerIDName", "<unknown>",
+		"ParkingTimeout", "45"}, kvs...)...)
+}
+
+func TestParkAndRetrieve(t *testing.T) {
+	tr := parking.NewTracker()
+
+	got := tr.Process(parked("702", "p.2", "21", "Timestamp", "1770888500.000000"))
+	if len(got) != 1 || got[0].Name != "default" || len(got[0].Calls) != 1 {
+		t.Fatalf("expected 1 parked call, got %+v", got)
+	}
+	call := got[0].Calls[0]
+	if call.Slot != "702" || call.CallID != "p.2" || call.Extension != "21" || call.Name != "" {
+		t.Errorf("unexpected call %+v", call)
+	}
+	if call.Timeout != 45*time.Second || call.ParkedAt.Unix() != 1770888500 {
+		t.Errorf("unexpected timeout or parked time %+v", call)
+	}
+
+	got = tr.Process(parked("701", "p.1", "1986"))
+	if len(got) != 1 || len(got[0].Calls) != 2 || got[0].Calls[0].Slot != "701" {
+		t.Errorf("expected 2 calls in slot order, got %+v", got)
+	}
+
+	got = tr.Process(ami.NewEvent("Event", "UnParkedCall", "Parkinglot", "default", "ParkingSpace", "701"))
+	if len(got) != 1 || len(got[0].Calls) != 1 || got[0].Calls[0].Slot != "702" {
+		t.Errorf("expected only 702 left, got %+v", got)
+	}
+
+	got = tr.Process(ami.NewEvent("Event", "ParkedCallTimeOut", "Parkinglot", "default", "ParkingSpace", "702"))
+	if len(got) != 1 || len(got[0].Calls) != 0 {
+		t.Errorf("expected an empty lot, got %+v", got)
+	}
+
+	if got := tr.Process(ami.NewEvent("Event", "ParkedCallGiveUp", "Parkinglot", "default", "ParkingSpace", "702")); len(got) != 0 {
+		t.Errorf("expected nothing for an empty slot, got %+v", got)
+	}
+}
+
+func TestSlotOrderIsNumeric(t *testing.T) {
+	tr := parking.NewTracker()
+	tr.Process(parked("1000", "p.2", "22"))
+	got := tr.Process(parked("999", "p.1", "21"))
+	if got[0].Calls[0].Slot != "999" {
+		t.Errorf("expected 999 before 1000, got %+v", got[0].Calls)
+	}
+}
+
+func TestProcessIgnoresOtherEvents(t *testing.T) {
+	tr := parking.NewTracker()
+	if got := tr.Process(ami.NewEvent("Event", "Newchannel", "Parkinglot", "default")); len(got) != 0 {
+		t.Errorf("expected nothing, got %+v", got)
+	}
+	if got := tr.Process(ami.NewEvent("Event", "ParkedCall", "Parkinglot", "default")); len(got) != 0 {
+		t.Errorf("expected nothing without a slot, got %+v", got)
+	}
+}
+
+func TestSeedFromParkingLists(t *testing.T) {
+	tr := parking.NewTracker()
+	tr.Process(ami.NewEvent("Event", "ParkedCall", "Parkinglot", "sales", "ParkingSpace", "801", "ParkeeLinkedid", "old"))
+
+	lots := ami.Response{Events: []ami.Event{
+		ami.NewEvent("Event", "Parkinglot", "Name", "default", "StartSpace", "701", "StopSpace", "720"),
+		ami.NewEvent("Event", "ParkinglotsComplete", "EventList", "Complete"),
+	}}
+	calls := ami.Response{Events: []ami.Event{
+		parked("701", "p.1", "1986", "ParkingDuration", "30"),
+		ami.NewEvent("Event", "ParkedCallsComplete", "EventList", "Complete"),
+	}}
+	got := tr.Seed(lots, calls)
+	if len(got) != 2 {
+		t.Fatalf("expected default and sales, got %+v", got)
+	}
+	if got[0].Name != "default" || len(got[0].Calls) != 1 {
+		t.Errorf("expected 1 call in default, got %+v", got[0])
+	}
+	if got[1].Name != "sales" || len(got[1].Calls) != 0 {
+		t.Errorf("expected sales to have emptied, got %+v", got[1])
+	}
+	if wait := got[0].Timestamp.Sub(got[0].Calls[0].ParkedAt); wait < 30*time.Second {
+		t.Errorf("expected the call to have been parked for 30s, got %v", wait)
+	}
+}
@@ -0,0 +1,291 @@
+// Package presence tracks whether each extension's phone is registered
+// and whether it is idle, ringing or in use, from AMI device state events.
+package presence
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Status is what an extension's phone is doing.
+type Status string
+
+const (
+	StatusIdle        Status = "idle"
+	StatusInUse       Status = "in_use"
+	StatusBusy        Status = "busy"
+	StatusRinging     Status = "ringing"
+	StatusOnHold      Status = "on_hold"
+	StatusUnavailable Status = "unavailable"
+	StatusUnknown     Status = "unknown"
+)
+
+// State is the presence of one extension.
+type State struct {
+	Extension  string
+	Status     Status
+	Registered bool
+	DND        bool
+	Timestamp  time.Time
+}
+
+// Tracker keeps the last known State of every extension and reports only
+// the ones that change.
+type Tracker struct {
+	extensions map[string]State
+	clock      func() time.Time
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		extensions: make(map[string]State),
+		clock:      time.Now,
+	}
+}
+
+// Process ingests an AMI event and returns the extension states it
+// changed. Besides the unsolicited DeviceStateChange, ExtensionStatus,
+// PeerStatus and ContactStatus events, it accepts the list events of
+// ExtensionStateList and PJSIPShowEndpoints, so a tracker can be seeded
+// by feeding it their responses.
+func (t *Tracker) Process(evt ami.Event) []State {
+	switch evt.Type() {
+	case "ExtensionStatus":
+		return t.handleExtensionStatus(evt)
+	case "DeviceStateChange":
+		return t.handleDeviceStateChange(evt)
+	case "PeerStatus":
+		return t.handlePeerStatus(evt)
+	case "ContactStatus":
+		return t.handleContactStatus(evt)
+	case "EndpointList":
+		return t.handleEndpointList(evt)
+	}
+	return nil
+}
+
+// Seed ingests the events of an ExtensionStateList or PJSIPShowEndpoints
+// response.
+func (t *Tracker) Seed(resp ami.Response) []State {
+	var states []State
+	for _, evt := range resp.Events {
+		states = append(states, t.Process(evt)...)
+	}
+	return states
+}
+
+// handleExtensionStatus applies a dialplan hint's combined state. Hints
+// that only watch custom device states, such as FreePBX's DND feature
+// codes, aren't phones and are skipped.
+func (t *Tracker) handleExtensionStatus(evt ami.Event) []State {
+	ext := evt.Get("Exten")
+	if ext == "" || !hintHasPhone(evt.Get("Hint")) {
+		return nil
+	}
+	return t.update(ext, evt, func(s *State) {
+		s.setStatus(extensionStatus(evt.Get("StatusText"), evt.Get("Status")))
+	})
+}
+
+// handleDeviceStateChange applies the state of a single device, e.g.
+// PJSIP/21. FreePBX signals do-not-disturb through a custom device,
+// Custom:DND21, that is busy while DND is on.
+func (t *Tracker) handleDeviceStateChange(evt ami.Event) []State {
+	device := evt.Get("Device")
+	state := evt.Get("State")
+
+	if ext, ok := strings.CutPrefix(device, "Custom:DND"); ok && ext != "" {
+		return t.update(ext, evt, func(s *State) {
+			s.DND = state != "NOT_INUSE" && state != "UNKNOWN" && state != "INVALID"
+		})
+	}
+
+	ext := deviceExtension(device)
+	if ext == "" {
+		return nil
+	}
+	return t.update(ext, evt, func(s *State) {
+		s.setStatus(deviceStatus(state))
+	})
+}
+
+func (t *Tracker) handlePeerStatus(evt ami.Event) []State {
+	ext := deviceExtension(evt.Get("Peer"))
+	if ext == "" {
+		return nil
+	}
+	var registered bool
+	switch evt.Get("PeerStatus") {
+	case "Registered", "Reachable", "Lagged":
+		registered = true
+	case "Unregistered", "Unreachable", "Rejected":
+		registered = false
+	default:
+		return nil
+	}
+	return t.update(ext, evt, func(s *State) { s.Registered = registered })
+}
+
+func (t *Tracker) handleContactStatus(evt ami.Event) []State {
+	ext := evt.Get("EndpointName")
+	if ext == "" {
+		ext = evt.Get("AOR")
+	}
+	if ext == "" {
+		return nil
+	}
+	var registered bool
+	switch evt.Get("ContactStatus") {
+	case "Created", "Reachable", "Updated", "NonQualified":
+		registered = true
+	case "Removed", "Unreachable":
+		registered = false
+	default:
+		return nil
+	}
+	return t.update(ext, evt, func(s *State) { s.Registered = registered })
+}
+
+// handleEndpointList applies one endpoint from PJSIPShowEndpoints. An
+// endpoint is registered if it has any contacts.
+func (t *Tracker) handleEndpointList(evt ami.Event) []State {
+	ext := evt.Get("ObjectName")
+	if ext == "" {
+		return nil
+	}
+	return t.update(ext, evt, func(s *State) {
+		s.Registered = strings.Trim(evt.Get("Contacts"), ", ") != ""
+		s.Status = endpointStatus(evt.Get("DeviceState"))
+	})
+}
+
+// update applies fn to the extension's state, returning the new state if
+// anything changed. Extensions seen for the first time are always reported.
+func (t *Tracker) update(ext string, evt ami.Event, fn func(*State)) []State {
+	prev, known := t.extensions[ext]
+	s := prev
+	if !known {
+		s = State{Extension: ext, Status: StatusUnknown}
+	}
+	fn(&s)
+	if known && s.Status == prev.Status && s.Registered == prev.Registered && s.DND == prev.DND {
+		return nil
+	}
+
+	s.Timestamp = evt.Timestamp()
+	if s.Timestamp.IsZero() {
+		s.Timestamp = t.clock()
+	}
+	t.extensions[ext] = s
+	return []State{s}
+}
+
+// setStatus records a device status, which also says whether the phone
+// is registered: only an unregistered phone is unavailable.
+func (s *State) setStatus(status Status) {
+	s.Status = status
+	switch status {
+	case StatusUnavailable:
+		s.Registered = false
+	case StatusUnknown:
+	default:
+		s.Registered = true
+	}
+}
+
+// hintHasPhone reports whether a hint such as "PJSIP/21&Custom:DND21"
+// watches at least one device that isn't a custom state.
+func hintHasPhone(hint string) bool {
+	for _, dev := range strings.Split(hint, "&") {
+		if dev != "" && !strings.HasPrefix(dev, "Custom:") {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceExtension returns the extension of a phone device such as
+// "PJSIP/21", or "" for other kinds of device.
+func deviceExtension(device string) string {
+	for _, tech := range []string{"PJSIP/", "SIP/", "IAX2/"} {
+		if ext, ok := strings.CutPrefix(device, tech); ok {
+			return ext
+		}
+	}
+	return ""
+}
+
+// extensionStatus maps ExtensionStatus's StatusText, falling back to its
+// numeric Status for versions without the text.
+func extensionStatus(text, code string) Status {
+	switch text {
+	case "Idle":
+		return StatusIdle
+	case "InUse":
+		return StatusInUse
+	case "Busy":
+		return StatusBusy
+	case "Ringing", "InUse&Ringing":
+		return StatusRinging
+	case "Hold", "InUse&Hold":
+		return StatusOnHold
+	case "Unavailable":
+		return StatusUnavailable
+	}
+	switch code {
+	case "0":
+		return StatusIdle
+	case "1":
+		return StatusInUse
+	case "2":
+		return StatusBusy
+	case "4":
+		return StatusUnavailable
+	case "8", "9":
+		return StatusRinging
+	case "16", "17":
+		return StatusOnHold
+	}
+	return StatusUnknown
+}
+
+// deviceStatus maps a DeviceStateChange State.
+func deviceStatus(state string) Status {
+	switch state {
+	case "NOT_INUSE":
+		return StatusIdle
+	case "INUSE":
+		return StatusInUse
+	case "BUSY":
+		return StatusBusy
+	case "RINGING", "RINGINUSE":
+		return StatusRinging
+	case "ONHOLD":
+		return StatusOnHold
+	case "UNAVAILABLE", "INVALID":
+		return StatusUnavailable
+	}
+	return StatusUnknown
+}
+
+// endpointStatus maps PJSIPShowEndpoints' DeviceState text.
+func endpointStatus(state string) Status {
+	switch state {
+	case "Not in use":
+		return StatusIdle
+	case "In use":
+		return StatusInUse
+	case "Busy":
+		return StatusBusy
+	case "Ringing", "Ring+Inuse":
+		return StatusRinging
+	case "On Hold":
+		return StatusOnHold
+	case "Unavailable", "Invalid":
+		return StatusUnavailable
+	}
+	return StatusUnknown
+}
@@ -0,0 +1,133 @@
+package presence_test
+
+import (
+	"testing"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/presence"
+)
+
+func process(tr *presence.Tracker, kvs ...string) []presence.State {
+	return tr.Process(ami.NewEvent(kvs...))
+}
+
+func TestExtensionStatus(t *testing.T) {
+	tr := presence.NewTracker()
+
+	got := process(tr, "Event", "ExtensionStatus", "Exten", "21", "Context", "ext-local",
+		"Hint", "PJSIP/21&Custom:DND21", "Status", "0", "StatusText", "Idle", "Timestamp", "1770888509.000000")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 state, got %d", len(got))
+	}
+	s := got[0]
+	if s.Extension != "21" || s.Status != presence.StatusIdle || !s.Registered || s.DND {
+		t.Errorf("unexpected state %+v", s)
+	}
+	if s.Timestamp.Unix() != 1770888509 {
+		t.Errorf("expected event timestamp, got %v", s.Timestamp)
+	}
+
+	got = process(tr, "Event", "ExtensionStatus", "Exten", "21", "Hint", "PJSIP/21&Custom:DND21",
+		"Status", "8", "StatusText", "Ringing")
+	if len(got) != 1 || got[0].Status != presence.StatusRinging {
+		t.Errorf("expected ringing, got %+v", got)
+	}
+
+	got = process(tr, "Event", "ExtensionStatus", "Exten", "21", "Hint", "PJSIP/21&Custom:DND21",
+		"Status", "4", "StatusText", "Unavailable")
+	if len(got) != 1 || got[0].Status != presence.StatusUnavailable || got[0].Registered {
+		t.Errorf("expected unavailable and unregistered, got %+v", got)
+	}
+}
+
+func TestExtensionStatusNumericFallback(t *testing.T) {
+	tr := presence.NewTracker()
+	got := process(tr, "Event", "ExtensionStatus", "Exten", "22", "Hint", "SIP/22", "Status", "1")
+	if len(got) != 1 || got[0].Status != presence.StatusInUse {
+		t.Errorf("expected in_use from numeric status, got %+v", got)
+	}
+}
+
+func TestExtensionStatusSkipsFeatureCodeHints(t *testing.T) {
+	tr := presence.NewTracker()
+	got := process(tr, "Event", "ExtensionStatus", "Exten", "*7621", "Context", "ext-dnd-hints",
+		"Hint", "Custom:DND21", "Status", "2", "StatusText", "Busy")
+	if len(got) != 0 {
+		t.Errorf("expected feature code hint to be skipped, got %+v", got)
+	}
+}
+
+func TestDeviceStateChange(t *testing.T) {
+	tr := presence.NewTracker()
+
+	got := process(tr, "Event", "DeviceStateChange", "Device", "PJSIP/1986", "State", "INUSE")
+	if len(got) != 1 || got[0].Extension != "1986" || got[0].Status != presence.StatusInUse || !got[0].Registered {
+		t.Errorf("unexpected state %+v", got)
+	}
+
+	if got := process(tr, "Event", "DeviceStateChange", "Device", "Local/21@from-queue", "State", "INUSE"); len(got) != 0 {
+		t.Errorf("expected non-phone devices to be ignored, got %+v", got)
+	}
+}
+
+func TestDoNotDisturb(t *testing.T) {
+	tr := presence.NewTracker()
+	process(tr, "Event", "DeviceStateChange", "Device", "PJSIP/21", "State", "NOT_INUSE")
+
+	got := process(tr, "Event", "DeviceStateChange", "Device", "Custom:DND21", "State", "BUSY")
+	if len(got) != 1 || !got[0].DND || got[0].Status != presence.StatusIdle {
+		t.Errorf("expected idle with DND on, got %+v", got)
+	}
+	got = process(tr, "Event", "DeviceStateChange", "Device", "Custom:DND21", "State", "NOT_INUSE")
+	if len(got) != 1 || got[0].DND {
+		t.Errorf("expected DND off, got %+v", got)
+	}
+}
+
+func TestRegistrationEvents(t *testing.T) {
+	tr := presence.NewTracker()
+
+	got := process(tr, "Event", "ContactStatus", "URI", "sip:21@10.0.0.21:5060", "ContactStatus", "Created",
+		"AOR", "21", "EndpointName", "21")
+	if len(got) != 1 || !got[0].Registered || got[0].Status != presence.StatusUnknown {
+		t.Errorf("expected registered with unknown status, got %+v", got)
+	}
+	got = process(tr, "Event", "ContactStatus", "ContactStatus", "Removed", "AOR", "21", "EndpointName", "21")
+	if len(got) != 1 || got[0].Registered {
+		t.Errorf("expected unregistered, got %+v", got)
+	}
+
+	got = process(tr, "Event", "PeerStatus", "ChannelType", "SIP", "Peer", "SIP/22", "PeerStatus", "Registered")
+	if len(got) != 1 || got[0].Extension != "22" || !got[0].Registered {
+		t.Errorf("expected SIP/22 registered, got %+v", got)
+	}
+	if got := process(tr, "Event", "PeerStatus", "Peer", "SIP/22", "PeerStatus", "Registered"); len(got) != 0 {
+		t.Errorf("expected unchanged registration to be suppressed, got %+v", got)
+	}
+}
+
+func TestSeedFromLists(t *testing.T) {
+	tr := presence.NewTracker()
+
+	got := tr.Seed(ami.Response{Events: []ami.Event{
+		ami.NewEvent("Event", "ExtensionStatus", "Exten", "21", "Hint", "PJSIP/21&Custom:DND21", "Status", "0", "StatusText", "Idle"),
+		ami.NewEvent("Event", "ExtensionStatus", "Exten", "*7621", "Hint", "Custom:DND21", "Status", "0", "StatusText", "Idle"),
+		ami.NewEvent("Event", "ExtensionStatus", "Exten", "22", "Hint", "PJSIP/22", "Status", "4", "StatusText", "Unavailable"),
+	}})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 extensions, got %+v", got)
+	}
+
+	got = tr.Seed(ami.Response{Events: []ami.Event{
+		ami.NewEvent("Event", "EndpointList", "ObjectType", "endpoint", "ObjectName", "21",
+			"DeviceState", "Not in use", "Contacts", "21/sip:21@10.0.0.21:5060,"),
+		ami.NewEvent("Event", "EndpointList", "ObjectType", "endpoint", "ObjectName", "22",
+			"DeviceState", "Unavailable", "Contacts", ""),
+		ami.NewEvent("Event", "EndpointList", "ObjectType", "endpoint", "ObjectName", "1986",
+			"DeviceState", "In use", "Contacts", "1986/sip:1986@10.0.0.86:5060,"),
+	}})
+	// 21 and 22 are unchanged; 1986 is new
+	if len(got) != 1 || got[0].Extension != "1986" || got[0].Status != presence.StatusInUse || !got[0].Registered {
+		t.Errorf("expected only 1986 to be reported, got %+v", got)
+	}
+}
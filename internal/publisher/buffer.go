@@ -0,0 +1,366 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BufferOptions configures a Buffer.
+type BufferOptions struct {
+	// Size is how many messages are held in memory while the broker is
+	// unreachable. Beyond that they are written to SpoolDir or, without
+	// one, the oldest are dropped.
+	Size int
+
+	// SpoolDir, if set, holds up to Size more messages that don't fit in
+	// memory, beyond which the oldest spooled are dropped, and those
+	// still queued on Close, so that they survive a restart.
+	SpoolDir string
+
+	// SkipReplayed, if set, reports whether a message spooled by a
+	// previous run is no longer worth publishing, e.g. because it
+	// describes state that has since moved on. Such messages are dropped
+	// unsent.
+	SkipReplayed func(Message) bool
+
+	// Timeout bounds each attempt to publish a message, within any
+	// deadline of the caller's context. Defaults to 5s.
+	Timeout time.Duration
+
+	// RetryInterval is how often the queue is retried while the broker
+	// is unreachable. Defaults to 5s.
+	RetryInterval time.Duration
+}
+
+// Buffer is a Publisher that queues messages while the next Publisher
+// fails, and replays them in order once it recovers. Publish only fails
+// if a message could be neither sent nor queued.
+//
+// Buffer is safe for concurrent use, but messages published concurrently
+// have no defined order.
+type Buffer struct {
+	next Publisher
+	opts BufferOptions
+
+	mu      sync.Mutex
+	memory  []queued // oldest first; all older than spooled
+	spooled []uint64 // sequence numbers of spool files, oldest first
+	seq     uint64   // last sequence number used
+	loaded  uint64   // last sequence number spooled by a previous run
+	dropped int
+
+	kick   chan struct{}
+	ctx    context.Context // cancelled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type queued struct {
+	seq uint64
+	msg Message
+}
+
+// spoolRecord is the on-disk form of a spooled message. It is kept apart
+// from Message so that the spool format doesn't change with it.
+type spoolRecord struct {
+	Topic    string `json:"topic"`
+	Payload  []byte `json:"payload"`
+	Retained bool   `json:"retained,omitempty"`
+}
+
+// NewBuffer wraps next, picking up any messages left in the spool by a
+// previous run.
+func NewBuffer(next Publisher, opts BufferOptions) (*Buffer, error) {
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 5 * time.Second
+	}
+
+	b := &Buffer{
+		next: next,
+		opts: opts,
+		kick: make(chan struct{}, 1),
+	}
+	if opts.SpoolDir != "" {
+		if err := b.loadSpool(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.wg.Add(1)
+	go b.run()
+	if len(b.spooled) > 0 {
+		b.wake()
+	}
+	return b, nil
+}
+
+func (b *Buffer) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.publish(ctx, Message{Topic: topic, Payload: payload})
+}
+
+func (b *Buffer) PublishRetained(ctx context.Context, topic string, payload []byte) error {
+	return b.publish(ctx, Message{Topic: topic, Payload: payload, Retained: true})
+}
+
+// Depth returns the number of messages waiting to be published, in memory
+// and in the spool.
+func (b *Buffer) Depth() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.memory) + len(b.spooled)
+}
+
+// Dropped returns the number of messages discarded because memory was
+// full and there was no spool.
+func (b *Buffer) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Close makes a last attempt to publish the queue, spools what remains if
+// it can, and closes the next Publisher.
+func (b *Buffer) Close() error {
+	b.cancel()
+	b.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	b.flush(ctx)
+	cancel()
+
+	var err error
+	if b.opts.SpoolDir != "" {
+		err = b.persist()
+	}
+	return errors.Join(err, b.next.Close())
+}
+
+// publish sends msg straight away unless older messages are still queued,
+// in which case, or if sending fails, it joins the queue.
+func (b *Buffer) publish(ctx context.Context, msg Message) error {
+	msg.Payload = append([]byte(nil), msg.Payload...)
+	if b.Depth() == 0 {
+		if err := b.send(ctx, msg); err == nil {
+			return nil
+		}
+	}
+	if err := b.enqueue(msg); err != nil {
+		return err
+	}
+	b.wake()
+	return nil
+}
+
+func (b *Buffer) send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+	if msg.Retained {
+		return b.next.PublishRetained(ctx, msg.Topic, msg.Payload)
+	}
+	return b.next.Publish(ctx, msg.Topic, msg.Payload)
+}
+
+func (b *Buffer) enqueue(msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	switch {
+	case len(b.spooled) == 0 && len(b.memory) < b.opts.Size:
+		b.memory = append(b.memory, queued{seq: b.seq, msg: msg})
+	case b.opts.SpoolDir != "":
+		if err := b.writeSpool(b.seq, msg); err != nil {
+			return err
+		}
+		b.spooled = append(b.spooled, b.seq)
+		if len(b.spooled) > b.opts.Size {
+			b.removeSpool(b.spooled[0])
+			b.spooled = b.spooled[1:]
+			b.dropped++
+		}
+	default:
+		b.memory = append(b.memory[1:], queued{seq: b.seq, msg: msg})
+		b.dropped++
+	}
+	return nil
+}
+
+func (b *Buffer) wake() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// run replays the queue whenever a message joins it, and periodically
+// while it is not empty, until Close.
+func (b *Buffer) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-b.kick:
+		case <-ticker.C:
+		}
+		b.flush(b.ctx)
+	}
+}
+
+// flush publishes queued messages in order until one fails. A message
+// leaves the queue only once published, so that new messages queue up
+// behind it rather than overtake it.
+func (b *Buffer) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		item, ok := b.head()
+		if !ok {
+			return
+		}
+		if err := b.send(ctx, item.msg); err != nil {
+			return
+		}
+		b.pop(item.seq)
+	}
+}
+
+func (b *Buffer) head() (queued, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if len(b.memory) > 0 {
+			return b.memory[0], true
+		}
+		if len(b.spooled) == 0 {
+			return queued{}, false
+		}
+		seq := b.spooled[0]
+		msg, err := b.readSpool(seq)
+		skip := err == nil && seq <= b.loaded && b.opts.SkipReplayed != nil && b.opts.SkipReplayed(msg)
+		if err == nil && !skip {
+			return queued{seq: seq, msg: msg}, true
+		}
+		// An unreadable spool file can never be sent; skip it, and any
+		// message from a previous run that is no longer wanted.
+		b.removeSpool(seq)
+		b.spooled = b.spooled[1:]
+	}
+}
+
+// pop removes the message with sequence number seq if it is still at the
+// head of the queue; it may have been dropped while it was being sent.
+func (b *Buffer) pop(seq uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case len(b.memory) > 0:
+		if b.memory[0].seq == seq {
+			b.memory = b.memory[1:]
+		}
+	case len(b.spooled) > 0 && b.spooled[0] == seq:
+		b.removeSpool(seq)
+		b.spooled = b.spooled[1:]
+	}
+}
+
+// persist moves the messages still in memory to the spool. They are older
+// than any already spooled, and their sequence numbers sort accordingly.
+func (b *Buffer) persist() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, item := range b.memory {
+		if err := b.writeSpool(item.seq, item.msg); err != nil {
+			b.memory = b.memory[i:]
+			return err
+		}
+	}
+	b.memory = nil
+	return nil
+}
+
+// loadSpool picks up the spool files left by a previous run, removing
+// any temporary file a crash left half-written.
+func (b *Buffer) loadSpool() error {
+	if err := os.MkdirAll(b.opts.SpoolDir, 0o750); err != nil {
+		return fmt.Errorf("creating spool directory: %w", err)
+	}
+	entries, err := os.ReadDir(b.opts.SpoolDir)
+	if err != nil {
+		return fmt.Errorf("reading spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json.tmp") {
+			os.Remove(filepath.Join(b.opts.SpoolDir, entry.Name()))
+			continue
+		}
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		b.spooled = append(b.spooled, seq)
+	}
+	sort.Slice(b.spooled, func(i, j int) bool { return b.spooled[i] < b.spooled[j] })
+	if n := len(b.spooled); n > 0 {
+		b.seq = b.spooled[n-1]
+		b.loaded = b.seq
+	}
+	return nil
+}
+
+func (b *Buffer) spoolPath(seq uint64) string {
+	return filepath.Join(b.opts.SpoolDir, fmt.Sprintf("%020d.json", seq))
+}
+
+// writeSpool writes msg to its own spool file, via a temporary file so
+// that a crash never leaves a partial message behind.
+func (b *Buffer) writeSpool(seq uint64, msg Message) error {
+	data, err := json.Marshal(spoolRecord{Topic: msg.Topic, Payload: msg.Payload, Retained: msg.Retained})
+	if err != nil {
+		return fmt.Errorf("spooling message: %w", err)
+	}
+	path := b.spoolPath(seq)
+	if err := os.WriteFile(path+".tmp", data, 0o640); err != nil {
+		return fmt.Errorf("spooling message: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("spooling message: %w", err)
+	}
+	return nil
+}
+
+func (b *Buffer) readSpool(seq uint64) (Message, error) {
+	data, err := os.ReadFile(b.spoolPath(seq))
+	if err != nil {
+		return Message{}, err
+	}
+	var rec spoolRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Message{}, err
+	}
+	return Message{Topic: rec.Topic, Payload: rec.Payload, Retained: rec.Retained}, nil
+}
+
+func (b *Buffer) removeSpool(seq uint64) {
+	os.Remove(b.spoolPath(seq))
+}
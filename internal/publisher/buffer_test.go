@@ -0,0 +1,306 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBrokerDown = errors.New("broker down")
+
+func newTestBuffer(t *testing.T, next Publisher, opts BufferOptions) *Buffer {
+	t.Helper()
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = 10 * time.Millisecond
+	}
+	b, err := NewBuffer(next, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return b
+}
+
+// waitForDepth waits for the buffer to reach depth, failing the test if it
+// doesn't within a second.
+func waitForDepth(t *testing.T, b *Buffer, depth int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.Depth() != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected depth %d, still %d", depth, b.Depth())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func assertTopics(t *testing.T, msgs []Message, topics ...string) {
+	t.Helper()
+	if len(msgs) != len(topics) {
+		t.Fatalf("expected %d messages, got %d: %+v", len(topics), len(msgs), msgs)
+	}
+	for i, topic := range topics {
+		if msgs[i].Topic != topic {
+			t.Errorf("message %d: expected topic %s, got %s", i, topic, msgs[i].Topic)
+		}
+	}
+}
+
+func TestBufferPassesThrough(t *testing.T) {
+	mock := NewMockPublisher()
+	b := newTestBuffer(t, mock, BufferOptions{Size: 10})
+	defer b.Close()
+
+	b.Publish(context.Background(), "a", []byte("1"))
+	b.PublishRetained(context.Background(), "b", []byte("2"))
+
+	msgs := mock.Messages()
+	assertTopics(t, msgs, "a", "b")
+	if msgs[0].Retained || !msgs[1].Retained {
+		t.Errorf("unexpected retained flags: %v, %v", msgs[0].Retained, msgs[1].Retained)
+	}
+	if b.Depth() != 0 {
+		t.Errorf("expected empty queue, got %d", b.Depth())
+	}
+}
+
+func TestBufferReplaysInOrder(t *testing.T) {
+	mock := NewMockPublisher()
+	mock.SetError(errBrokerDown)
+	b := newTestBuffer(t, mock, BufferOptions{Size: 10})
+	defer b.Close()
+
+	for _, topic := range []string{"a", "b", "c"} {
+		if err := b.Publish(context.Background(), topic, []byte(topic)); err != nil {
+			t.Fatalf("expected the message to be queued, got %v", err)
+		}
+	}
+	if b.Depth() != 3 {
+		t.Fatalf("expected 3 queued, got %d", b.Depth())
+	}
+
+	mock.SetError(nil)
+	waitForDepth(t, b, 0)
+	assertTopics(t, mock.Messages(), "a", "b", "c")
+}
+
+func TestBufferQueuesBehindBacklog(t *testing.T) {
+	mock := NewMockPublisher()
+	mock.SetError(errBrokerDown)
+	b := newTestBuffer(t, mock, BufferOptions{Size: 10, RetryInterval: time.Hour})
+	defer b.Close()
+
+	b.Publish(context.Background(), "a", nil)
+	mock.SetError(nil)
+	// The broker is back, but "a" hasn't been replayed yet: "b" must wait.
+	b.Publish(context.Background(), "b", nil)
+
+	waitForDepth(t, b, 0)
+	assertTopics(t, mock.Messages(), "a", "b")
+}
+
+func TestBufferDropsOldestWithoutSpool(t *testing.T) {
+	mock := NewMockPublisher()
+	mock.SetError(errBrokerDown)
+	b := newTestBuffer(t, mock, BufferOptions{Size: 2})
+	defer b.Close()
+
+	for _, topic := range []string{"a", "b", "c"} {
+		b.Publish(context.Background(), topic, nil)
+	}
+	if b.Depth() != 2 || b.Dropped() != 1 {
+		t.Fatalf("expected 2 queued and 1 dropped, got %d and %d", b.Depth(), b.Dropped())
+	}
+
+	mock.SetError(nil)
+	waitForDepth(t, b, 0)
+	assertTopics(t, mock.Messages(), "b", "c")
+}
+
+func TestBufferSpillsToSpool(t *testing.T) {
+	dir := t.TempDir()
+	mock := NewMockPublisher()
+	mock.SetError(errBrokerDown)
+	b := newTestBuffer(t, mock, BufferOptions{Size: 2, SpoolDir: dir})
+	defer b.Close()
+
+	for _, topic := range []string{"a", "b", "c", "d"} {
+		b.Publish(context.Background(), topic, []byte(topic))
+	}
+	if b.Depth() != 4 || b.Dropped() != 0 {
+		t.Fatalf("expected 4 queued and none dropped, got %d and %d", b.Depth(), b.Dropped())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected 2 spool files, got %d", len(entries))
+	}
+
+	mock.SetError(nil)
+	waitForDepth(t, b, 0)
+	assertTopics(t, mock.Messages(), "a", "b", "c", "d")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the spool to be emptied, got %d files", len(entries))
+	}
+}
+
+func TestBufferDropsOldestFromFullSpool(t *testing.T) {
+	dir := t.TempDir()
+	mock := NewMockPublisher()
+	mock.SetError(errBrokerDown)
+	b := newTestBuffer(t, mock, BufferOptions{Size: 1, SpoolDir: dir, RetryInterval: time.Hour})
+	defer b.Close()
+
+	for _, topic := range []string{"a", "b", "c", "d"} {
+		b.Publish(context.Background(), topic, nil)
+	}
+	if b.Depth() != 2 || b.Dropped() != 2 {
+		t.Fatalf("expected 2 queued and 2 dropped, got %d and %d", b.Depth(), b.Dropped())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected 1 spool file, got %d", len(entries))
+	}
+
+	mock.SetError(nil)
+	b.wake()
+	waitForDepth(t, b, 0)
+	assertTopics(t, mock.Messages(), "a", "d")
+}
+
+func TestBufferSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	down := NewMockPublisher()
+	down.SetError(errBrokerDown)
+	b := newTestBuffer(t, down, BufferOptions{Size: 2, SpoolDir: dir})
+	for i := range 4 {
+		b.PublishRetained(context.Background(), fmt.Sprintf("t/%d", i), []byte{byte(i)})
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	up := NewMockPublisher()
+	b = newTestBuffer(t, up, BufferOptions{Size: 2, SpoolDir: dir})
+	defer b.Close()
+	waitForDepth(t, b, 0)
+
+	// A new message after the replay goes straight through
+	b.Publish(context.Background(), "t/4", nil)
+
+	msgs := up.Messages()
+	assertTopics(t, msgs, "t/0", "t/1", "t/2", "t/3", "t/4")
+	if !msgs[2].Retained || msgs[2].Payload[0] != 2 {
+		t.Errorf("expected the spooled message intact, got %+v", msgs[2])
+	}
+}
+
+func TestBufferSkipsUnwantedReplay(t *testing.T) {
+	dir := t.TempDir()
+	down := NewMockPublisher()
+	down.SetError(errBrokerDown)
+	b := newTestBuffer(t, down, BufferOptions{Size: 10, SpoolDir: dir})
+	b.PublishRetained(context.Background(), "stale/1", []byte("x"))
+	b.Publish(context.Background(), "event/1", nil)
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	up := NewMockPublisher()
+	up.SetError(errBrokerDown)
+	skip := func(msg Message) bool { return msg.Retained && strings.HasPrefix(msg.Topic, "stale/") }
+	b = newTestBuffer(t, up, BufferOptions{Size: 10, SpoolDir: dir, SkipReplayed: skip})
+	defer b.Close()
+
+	// Only messages from the previous run are skipped
+	b.PublishRetained(context.Background(), "stale/2", []byte("y"))
+	up.SetError(nil)
+	waitForDepth(t, b, 0)
+	assertTopics(t, up.Messages(), "event/1", "stale/2")
+}
+
+func TestBufferSkipsCorruptSpoolFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/00000000000000000001.json", []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mock := NewMockPublisher()
+	b := newTestBuffer(t, mock, BufferOptions{SpoolDir: dir})
+	defer b.Close()
+
+	waitForDepth(t, b, 0)
+	b.Publish(context.Background(), "a", nil)
+	assertTopics(t, mock.Messages(), "a")
+}
+
+func TestBufferSpoolFormat(t *testing.T) {
+	dir := t.TempDir()
+	down := NewMockPublisher()
+	down.SetError(errBrokerDown)
+	b := newTestBuffer(t, down, BufferOptions{SpoolDir: dir, RetryInterval: time.Hour})
+	b.PublishRetained(context.Background(), "t/0", []byte("on"))
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(dir + "/00000000000000000001.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"topic":"t/0","payload":"b24=","retained":true}`; string(data) != want {
+		t.Errorf("expected spool file %s, got %s", want, data)
+	}
+}
+
+func TestBufferRemovesLeftoverTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	tmp := dir + "/00000000000000000001.json.tmp"
+	if err := os.WriteFile(tmp, []byte(`{"topic":"t/0"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b := newTestBuffer(t, NewMockPublisher(), BufferOptions{SpoolDir: dir})
+	defer b.Close()
+
+	if b.Depth() != 0 {
+		t.Errorf("expected an empty queue, got depth %d", b.Depth())
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", tmp, err)
+	}
+}
+
+// blockingPublisher never completes a publish, like a broker that has
+// stopped acknowledging.
+type blockingPublisher struct{ MockPublisher }
+
+func (p *blockingPublisher) Publish(ctx context.Context, _ string, _ []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBufferHonoursTimeout(t *testing.T) {
+	b := newTestBuffer(t, &blockingPublisher{}, BufferOptions{Size: 10, Timeout: 20 * time.Millisecond, RetryInterval: time.Hour})
+	defer b.Close()
+
+	start := time.Now()
+	if err := b.Publish(context.Background(), "a", nil); err != nil {
+		t.Fatalf("expected the message to be queued, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publish took %s despite a 20ms timeout", elapsed)
+	}
+	if b.Depth() != 1 {
+		t.Errorf("expected 1 queued, got %d", b.Depth())
+	}
+}
+
+func TestBufferCloseClosesNext(t *testing.T) {
+	mock := NewMockPublisher()
+	b := newTestBuffer(t, mock, BufferOptions{})
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mock.Closed() {
+		t.Error("expected the wrapped publisher to be closed")
+	}
+}
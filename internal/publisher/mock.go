@@ -2,13 +2,16 @@ package publisher
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Message records a single published message.
 type Message struct {
-	Topic   string
-	Payload []byte
+	Topic    string
+	Payload  []byte
+	Retained bool
 }
 
 // MockPublisher records all publishes for test assertions.
@@ -25,6 +28,14 @@ func NewMockPublisher() *MockPublisher {
 }
 
 func (m *MockPublisher) Publish(_ context.Context, topic string, payload []byte) error {
+	return m.record(topic, payload, false)
+}
+
+func (m *MockPublisher) PublishRetained(_ context.Context, topic string, payload []byte) error {
+	return m.record(topic, payload, true)
+}
+
+func (m *MockPublisher) record(topic string, payload []byte, retained bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.err != nil {
@@ -32,10 +43,41 @@ func (m *MockPublisher) Publish(_ context.Context, topic string, payload []byte)
 	}
 	p := make([]byte, len(payload))
 	copy(p, payload)
-	m.messages = append(m.messages, Message{Topic: topic, Payload: p})
+	m.messages = append(m.messages, Message{Topic: topic, Payload: p, Retained: retained})
 	return nil
 }
 
+// Retained returns the current retained payload for each topic, as a
+// broker would hold it. Topics cleared with an empty payload are omitted.
+func (m *MockPublisher) Retained() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	retained := map[string][]byte{}
+	for _, msg := range m.messages {
+		if !msg.Retained {
+			continue
+		}
+		if len(msg.Payload) == 0 {
+			delete(retained, msg.Topic)
+			continue
+		}
+		retained[msg.Topic] = msg.Payload
+	}
+	return retained
+}
+
+// RetainedTopics returns the topics matching filter in Retained, sorted.
+func (m *MockPublisher) RetainedTopics(_ context.Context, filter string, _ time.Duration) ([]string, error) {
+	var topics []string
+	for topic := range m.Retained() {
+		if matchTopic(filter, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
 func (m *MockPublisher) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
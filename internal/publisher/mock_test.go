@@ -93,3 +93,48 @@ func TestMockSetError(t *testing.T) {
 		t.Errorf("expected 1 message after clearing error, got %d", len(m.Messages()))
 	}
 }
+
+func TestMockPublishRetained(t *testing.T) {
+	m := NewMockPublisher()
+	m.Publish(context.Background(), "events", []byte("a"))
+	m.PublishRetained(context.Background(), "state/1", []byte("old"))
+	m.PublishRetained(context.Background(), "state/1", []byte("new"))
+	m.PublishRetained(context.Background(), "state/2", []byte("x"))
+	m.PublishRetained(context.Background(), "state/2", nil)
+
+	msgs := m.Messages()
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(msgs))
+	}
+	if msgs[0].Retained || !msgs[1].Retained {
+		t.Errorf("unexpected retained flags: %v, %v", msgs[0].Retained, msgs[1].Retained)
+	}
+
+	retained := m.Retained()
+	if len(retained) != 1 || string(retained["state/1"]) != "new" {
+		t.Errorf("expected only state/1=new retained, got %v", retained)
+	}
+}
+
+func TestMockRetainedTopics(t *testing.T) {
+	m := NewMockPublisher()
+	ctx := context.Background()
+	m.PublishRetained(ctx, "asterisk/call/b.1/state", []byte("x"))
+	m.PublishRetained(ctx, "asterisk/call/a.1/state", []byte("x"))
+	m.PublishRetained(ctx, "asterisk/call/c.1/state", []byte("x"))
+	m.PublishRetained(ctx, "asterisk/call/c.1/state", nil)
+	m.PublishRetained(ctx, "asterisk/call/a.1/leg", []byte("x"))
+	m.Publish(ctx, "asterisk/call/d.1/state", []byte("x"))
+
+	topics, err := m.RetainedTopics(ctx, "asterisk/call/+/state", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 || topics[0] != "asterisk/call/a.1/state" || topics[1] != "asterisk/call/b.1/state" {
+		t.Errorf("expected the retained a.1 and b.1 states, got %v", topics)
+	}
+
+	if topics, _ := m.RetainedTopics(ctx, "asterisk/#", 0); len(topics) != 3 {
+		t.Errorf("expected 3 topics under asterisk/#, got %v", topics)
+	}
+}
@@ -2,7 +2,12 @@ package publisher
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -12,6 +17,12 @@ import (
 type MQTTPublisher struct {
 	client mqtt.Client
 	qos    byte
+
+	statusTopic string
+	offline     []byte
+
+	mu     sync.Mutex
+	status []byte // last payload published to statusTopic
 }
 
 // MQTTOptions configures the MQTT publisher.
@@ -19,38 +30,213 @@ type MQTTOptions struct {
 	Broker   string
 	ClientID string
 	QoS      byte
+
+	Username string
+	Password string
+
+	// TLS is used for ssl://, mqtts:// and wss:// brokers. The zero
+	// value verifies the broker against the system roots.
+	TLS TLSOptions
+
+	// StatusTopic, if set, is a retained topic saying whether the bridge
+	// is up. It is registered as the Last Will with OfflinePayload, which
+	// Close also publishes. The last payload published to it is restored
+	// after a reconnect, since the broker will have published the Will.
+	StatusTopic    string
+	OfflinePayload []byte
+
+	// ConnectTimeout is how long NewMQTTPublisher waits for the first
+	// connection. If the broker is unreachable by then, it carries on
+	// connecting in the background, and publishes fail with
+	// ErrNotConnected until it succeeds. Defaults to 10s.
+	ConnectTimeout time.Duration
 }
 
-// NewMQTTPublisher creates and connects an MQTT publisher.
+// TLSOptions configures how the publisher authenticates the broker and,
+// with a client certificate, itself.
+type TLSOptions struct {
+	CAFile             string // PEM CA bundle; system roots if empty
+	CertFile           string // PEM client certificate
+	KeyFile            string // PEM client key
+	InsecureSkipVerify bool   // accept any broker certificate
+}
+
+// NewMQTTPublisher creates an MQTT publisher and starts connecting it. It
+// only fails on invalid options; see MQTTOptions.ConnectTimeout.
 func NewMQTTPublisher(opts MQTTOptions) (*MQTTPublisher, error) {
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
 	clientOpts := mqtt.NewClientOptions().
 		AddBroker(opts.Broker).
 		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetTLSConfig(tlsConfig).
 		SetAutoReconnect(true).
 		SetConnectRetry(true).
 		SetConnectRetryInterval(5 * time.Second).
 		SetMaxReconnectInterval(60 * time.Second)
 
-	client := mqtt.NewClient(clientOpts)
-	token := client.Connect()
-	token.Wait()
-	if err := token.Error(); err != nil {
-		return nil, fmt.Errorf("connecting to MQTT broker %s: %w", opts.Broker, err)
+	p := &MQTTPublisher{
+		qos:         opts.QoS,
+		statusTopic: opts.StatusTopic,
+		offline:     opts.OfflinePayload,
+	}
+	if p.statusTopic != "" {
+		clientOpts.
+			SetBinaryWill(p.statusTopic, p.offline, opts.QoS, true).
+			SetOnConnectHandler(p.restoreStatus)
 	}
 
-	return &MQTTPublisher{
-		client: client,
-		qos:    opts.QoS,
-	}, nil
+	timeout := opts.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	// With ConnectRetry the token only completes once connected, or on an
+	// error no retry can fix.
+	p.client = mqtt.NewClient(clientOpts)
+	token := p.client.Connect()
+	if token.WaitTimeout(timeout) {
+		if err := token.Error(); err != nil {
+			return nil, fmt.Errorf("connecting to MQTT broker %s: %w", opts.Broker, err)
+		}
+	}
+
+	return p, nil
 }
 
-func (p *MQTTPublisher) Publish(_ context.Context, topic string, payload []byte) error {
-	token := p.client.Publish(topic, p.qos, false, payload)
-	token.Wait()
-	return token.Error()
+// Connected reports whether the connection to the broker is open.
+func (p *MQTTPublisher) Connected() bool {
+	return p.client.IsConnectionOpen()
+}
+
+// restoreStatus republishes the bridge status on reconnect, replacing the
+// Will the broker published when the connection was lost. Paho calls it in
+// its own goroutine, so it does not wait for the publish to complete.
+func (p *MQTTPublisher) restoreStatus(client mqtt.Client) {
+	p.mu.Lock()
+	status := p.status
+	p.mu.Unlock()
+	if status != nil {
+		client.Publish(p.statusTopic, p.qos, true, status)
+	}
 }
 
+// config builds the tls.Config for the options, loading the CA bundle and
+// client certificate from disk.
+func (o TLSOptions) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading MQTT CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("reading MQTT CA file %s: no PEM certificates found", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("MQTT client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading MQTT client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ErrNotConnected is returned when publishing while the connection to the
+// broker is down.
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+func (p *MQTTPublisher) Publish(ctx context.Context, topic string, payload []byte) error {
+	return p.publish(ctx, topic, payload, false)
+}
+
+func (p *MQTTPublisher) PublishRetained(ctx context.Context, topic string, payload []byte) error {
+	if p.statusTopic != "" && topic == p.statusTopic {
+		p.mu.Lock()
+		p.status = append([]byte(nil), payload...)
+		p.mu.Unlock()
+	}
+	return p.publish(ctx, topic, payload, true)
+}
+
+// publish waits for the broker to acknowledge the message, or for ctx to
+// be done. While reconnecting, Paho would hold the message until the
+// connection is back; it is refused instead, leaving buffering to Buffer.
+func (p *MQTTPublisher) publish(ctx context.Context, topic string, payload []byte, retained bool) error {
+	if !p.client.IsConnectionOpen() {
+		return fmt.Errorf("publishing to %s: %w", topic, ErrNotConnected)
+	}
+	token := p.client.Publish(topic, p.qos, retained, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return fmt.Errorf("publishing to %s: %w", topic, ctx.Err())
+	}
+}
+
+// RetainedTopics subscribes to filter for settle, collecting the topics of
+// the retained messages the broker sends, then unsubscribes.
+func (p *MQTTPublisher) RetainedTopics(ctx context.Context, filter string, settle time.Duration) ([]string, error) {
+	if !p.client.IsConnectionOpen() {
+		return nil, fmt.Errorf("subscribing to %s: %w", filter, ErrNotConnected)
+	}
+
+	var mu sync.Mutex
+	var topics []string
+	token := p.client.Subscribe(filter, p.qos, func(_ mqtt.Client, msg mqtt.Message) {
+		if msg.Retained() && len(msg.Payload()) > 0 {
+			mu.Lock()
+			topics = append(topics, msg.Topic())
+			mu.Unlock()
+		}
+	})
+	defer p.client.Unsubscribe(filter)
+
+	select {
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return nil, fmt.Errorf("subscribing to %s: %w", filter, err)
+		}
+	case <-ctx.Done():
+		return nil, fmt.Errorf("subscribing to %s: %w", filter, ctx.Err())
+	}
+	select {
+	case <-time.After(settle):
+	case <-ctx.Done():
+		return nil, fmt.Errorf("subscribing to %s: %w", filter, ctx.Err())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return topics, nil
+}
+
+// Close publishes the offline status, if configured, and disconnects.
+// Disconnecting cleanly means the broker will not publish the Will.
 func (p *MQTTPublisher) Close() error {
+	if p.statusTopic != "" && p.client.IsConnected() {
+		token := p.client.Publish(p.statusTopic, p.qos, true, p.offline)
+		token.WaitTimeout(2 * time.Second)
+	}
 	p.client.Disconnect(1000)
 	return nil
 }
@@ -0,0 +1,176 @@
+package publisher
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "asterisk-mqtt"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfigDefaults(t *testing.T) {
+	cfg, err := TLSOptions{}.config()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RootCAs != nil || len(cfg.Certificates) != 0 || cfg.InsecureSkipVerify {
+		t.Errorf("expected system roots and no client certificate, got %+v", cfg)
+	}
+}
+
+func TestTLSConfigLoadsFiles(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+
+	cfg, err := TLSOptions{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}.config()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RootCAs == nil {
+		t.Error("expected the CA bundle to replace the system roots")
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("expected 1 client certificate, got %d", len(cfg.Certificates))
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]TLSOptions{
+		"missing CA file":  {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA file not PEM":  {CAFile: notPEM},
+		"cert without key": {CertFile: certFile},
+		"key without cert": {KeyFile: keyFile},
+		"mismatched pair":  {CertFile: keyFile, KeyFile: certFile},
+	}
+	for name, opts := range tests {
+		if _, err := opts.config(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// unreachableBroker returns the address of a port nothing listens on.
+func unreachableBroker(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "tcp://" + addr
+}
+
+func TestMQTTPublisherStartsWithBrokerDown(t *testing.T) {
+	start := time.Now()
+	p, err := NewMQTTPublisher(MQTTOptions{
+		Broker:         unreachableBroker(t),
+		ClientID:       "test",
+		QoS:            1,
+		ConnectTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected the publisher despite the broker being down, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected NewMQTTPublisher to give up waiting, took %v", elapsed)
+	}
+	if p.Connected() {
+		t.Error("expected not connected")
+	}
+
+	err = p.Publish(context.Background(), "asterisk/test", []byte("x"))
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+
+	// The buffer queues until the broker is back
+	b, err := NewBuffer(p, BufferOptions{Size: 10, SpoolDir: t.TempDir(), RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(context.Background(), "asterisk/test", []byte("x")); err != nil {
+		t.Errorf("expected the message to be queued, got %v", err)
+	}
+	if b.Depth() != 1 {
+		t.Errorf("expected 1 queued message, got %d", b.Depth())
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected close error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked while connecting")
+	}
+}
+
+func TestRetainedTopicsWithBrokerDown(t *testing.T) {
+	p, err := NewMQTTPublisher(MQTTOptions{
+		Broker:         unreachableBroker(t),
+		ClientID:       "test",
+		ConnectTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	_, err = p.RetainedTopics(context.Background(), "asterisk/call/+/state", time.Second)
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
@@ -1,9 +1,41 @@
 package publisher
 
-import "context"
+import (
+	"context"
+	"strings"
+	"time"
+)
 
 // Publisher defines the interface for publishing messages.
 type Publisher interface {
 	Publish(ctx context.Context, topic string, payload []byte) error
+	// PublishRetained publishes a message the broker keeps as the topic's
+	// current value for future subscribers. An empty payload clears it.
+	PublishRetained(ctx context.Context, topic string, payload []byte) error
 	Close() error
 }
+
+// RetainedLister is implemented by publishers that can list the retained
+// messages the broker holds, e.g. to clear those left by a previous run.
+type RetainedLister interface {
+	// RetainedTopics returns the topics matching filter, which may
+	// contain + and # wildcards, that hold a retained message. The broker
+	// sends them straight after subscribing; RetainedTopics waits settle
+	// for them to arrive.
+	RetainedTopics(ctx context.Context, filter string, settle time.Duration) ([]string, error)
+}
+
+// matchTopic reports whether topic matches the subscription filter.
+func matchTopic(filter, topic string) bool {
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, level := range fl {
+		if level == "#" {
+			return true
+		}
+		if i >= len(tl) || (level != "+" && level != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
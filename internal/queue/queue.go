@@ -0,0 +1,159 @@
+// Package queue tracks the callers waiting in, and the members logged in
+// to, each app_queue queue from AMI events and action responses.
+package queue
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+)
+
+// Summary is the state of one queue.
+type Summary struct {
+	Queue       string
+	Waiting     int           // callers waiting to be answered
+	LongestWait time.Duration // how long the longest-waiting caller has waited
+	Members     int           // members logged in
+	Available   int           // members logged in, not paused and not on a call
+	Timestamp   time.Time
+}
+
+// queueState is what the tracker knows about one queue.
+type queueState struct {
+	callers map[string]time.Time // caller Uniqueid -> when they joined
+	members map[string]member    // member Interface -> state
+	last    Summary              // last summary reported
+}
+
+type member struct {
+	paused bool
+	status int // AST_DEVICE_* device state
+}
+
+// available reports whether the member could take a call now. Members
+// without a state interface report an unknown (0) device state.
+func (m member) available() bool {
+	return !m.paused && (m.status == 0 || m.status == 1)
+}
+
+// Tracker keeps the state of every queue and reports the summaries that
+// change.
+type Tracker struct {
+	queues map[string]*queueState
+	clock  func() time.Time
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		queues: make(map[string]*queueState),
+		clock:  time.Now,
+	}
+}
+
+// Process ingests an AMI event and returns the queue summary it changed,
+// if any. Besides the caller and member events, it accepts the
+// QueueParams, QueueMember and QueueEntry list events of QueueStatus.
+func (t *Tracker) Process(evt ami.Event) []Summary {
+	name := evt.Get("Queue")
+	if name == "" {
+		return nil
+	}
+	now := evt.Timestamp()
+	if now.IsZero() {
+		now = t.clock()
+	}
+
+	switch evt.Type() {
+	case "QueueParams":
+		t.queue(name)
+	case "QueueCallerJoin":
+		t.queue(name).callers[evt.Get("Uniqueid")] = now
+	case "QueueEntry":
+		// Wait is the seconds the caller has been waiting so far.
+		wait := time.Duration(evt.GetInt("Wait")) * time.Second
+		t.queue(name).callers[evt.Get("Uniqueid")] = now.Add(-wait)
+	case "QueueCallerLeave", "QueueCallerAbandon":
+		delete(t.queue(name).callers, evt.Get("Uniqueid"))
+	case "QueueMemberAdded", "QueueMemberStatus", "QueueMemberPause", "QueueMember":
+		t.queue(name).members[memberInterface(evt)] = member{
+			paused: evt.Get("Paused") == "1",
+			status: evt.GetInt("Status"),
+		}
+	case "QueueMemberRemoved":
+		delete(t.queue(name).members, memberInterface(evt))
+	default:
+		return nil
+	}
+	return t.report(name, now)
+}
+
+// Seed replaces what the tracker knows with the events of a QueueStatus
+// response and returns the summary of every queue in it.
+func (t *Tracker) Seed(resp ami.Response) []Summary {
+	t.queues = make(map[string]*queueState)
+	for _, evt := range resp.Events {
+		t.Process(evt)
+	}
+
+	names := make([]string, 0, len(t.queues))
+	for name := range t.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summaries := make([]Summary, 0, len(names))
+	for _, name := range names {
+		summaries = append(summaries, t.queues[name].last)
+	}
+	return summaries
+}
+
+func (t *Tracker) queue(name string) *queueState {
+	q := t.queues[name]
+	if q == nil {
+		q = &queueState{
+			callers: make(map[string]time.Time),
+			members: make(map[string]member),
+			last:    Summary{Queue: name},
+		}
+		t.queues[name] = q
+	}
+	return q
+}
+
+// report summarizes the queue, returning the summary if it differs from
+// the last one reported. A new longest wait on its own is not a change:
+// it grows every second.
+func (t *Tracker) report(name string, now time.Time) []Summary {
+	q := t.queue(name)
+	s := Summary{Queue: name, Waiting: len(q.callers), Members: len(q.members), Timestamp: now}
+	for _, joined := range q.callers {
+		s.LongestWait = max(s.LongestWait, now.Sub(joined))
+	}
+	for _, m := range q.members {
+		if m.available() {
+			s.Available++
+		}
+	}
+
+	prev := q.last
+	q.last = s
+	if !prev.Timestamp.IsZero() && prev.Waiting == s.Waiting && prev.Members == s.Members && prev.Available == s.Available {
+		return nil
+	}
+	return []Summary{s}
+}
+
+// memberInterface identifies a member across events: QueueStatus calls
+// it Location, the member events Interface.
+func memberInterface(evt ami.Event) string {
+	if iface := evt.Get("Interface"); iface != "" {
+		return iface
+	}
+	if loc := evt.Get("Location"); loc != "" {
+		return loc
+	}
+	return evt.Get("MemberName")
+}
@@ -0,0 +1,115 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sweeney/asterisk-mqtt/internal/ami"
+	"github.com/sweeney/asterisk-mqtt/internal/queue"
+)
+
+func process(tr *queue.Tracker, kvs ...string) []queue.Summary {
+	return tr.Process(ami.NewEvent(kvs...))
+}
+
+func TestCallersWaiting(t *testing.T) {
+	tr := queue.NewTracker()
+
+	got := process(tr, "Event", "QueueCallerJoin", "Queue", "sales", "Uniqueid", "1770888500.1",
+		"Position", "1", "Count", "1", "Timestamp", "1770888500.000000")
+	if len(got) != 1 || got[0].Queue != "sales" || got[0].Waiting != 1 || got[0].LongestWait != 0 {
+		t.Fatalf("expected 1 caller waiting, got %+v", got)
+	}
+	if got[0].Timestamp.Unix() != 1770888500 {
+		t.Errorf("expected event timestamp, got %v", got[0].Timestamp)
+	}
+
+	got = process(tr, "Event", "QueueCallerJoin", "Queue", "sales", "Uniqueid", "1770888510.2",
+		"Position", "2", "Count", "2", "Timestamp", "1770888510.000000")
+	if len(got) != 1 || got[0].Waiting != 2 || got[0].LongestWait != 10*time.Second {
+		t.Errorf("expected 2 callers, longest waiting 10s, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueCallerLeave", "Queue", "sales", "Uniqueid", "1770888500.1",
+		"Timestamp", "1770888530.000000")
+	if len(got) != 1 || got[0].Waiting != 1 || got[0].LongestWait != 20*time.Second {
+		t.Errorf("expected 1 caller, waiting 20s, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueCallerAbandon", "Queue", "sales", "Uniqueid", "1770888510.2",
+		"Timestamp", "1770888540.000000")
+	if len(got) != 1 || got[0].Waiting != 0 || got[0].LongestWait != 0 {
+		t.Errorf("expected empty queue, got %+v", got)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	tr := queue.NewTracker()
+
+	got := process(tr, "Event", "QueueMemberAdded", "Queue", "sales", "MemberName", "Kitchen",
+		"Interface", "PJSIP/21", "Status", "1", "Paused", "0")
+	if len(got) != 1 || got[0].Members != 1 || got[0].Available != 1 {
+		t.Fatalf("expected 1 available member, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueMemberStatus", "Queue", "sales", "Interface", "PJSIP/21", "Status", "2", "Paused", "0")
+	if len(got) != 1 || got[0].Members != 1 || got[0].Available != 0 {
+		t.Errorf("expected member in use, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueMemberStatus", "Queue", "sales", "Interface", "PJSIP/21", "Status", "1", "Paused", "0")
+	if len(got) != 1 || got[0].Available != 1 {
+		t.Errorf("expected member available again, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueMemberPause", "Queue", "sales", "Interface", "PJSIP/21", "Status", "1", "Paused", "1")
+	if len(got) != 1 || got[0].Available != 0 {
+		t.Errorf("expected paused member unavailable, got %+v", got)
+	}
+	if got := process(tr, "Event", "QueueMemberStatus", "Queue", "sales", "Interface", "PJSIP/21", "Status", "2", "Paused", "1"); len(got) != 0 {
+		t.Errorf("expected no change for a paused member going in use, got %+v", got)
+	}
+
+	got = process(tr, "Event", "QueueMemberRemoved", "Queue", "sales", "Interface", "PJSIP/21")
+	if len(got) != 1 || got[0].Members != 0 {
+		t.Errorf("expected no members, got %+v", got)
+	}
+}
+
+func TestProcessIgnoresOtherEvents(t *testing.T) {
+	tr := queue.NewTracker()
+	if got := process(tr, "Event", "Newchannel", "Queue", "sales"); len(got) != 0 {
+		t.Errorf("expected nothing, got %+v", got)
+	}
+	if got := process(tr, "Event", "QueueCallerJoin", "Uniqueid", "1"); len(got) != 0 {
+		t.Errorf("expected nothing without a queue, got %+v", got)
+	}
+}
+
+func TestSeedFromQueueStatus(t *testing.T) {
+	tr := queue.NewTracker()
+	process(tr, "Event", "QueueCallerJoin", "Queue", "stale", "Uniqueid", "1")
+
+	got := tr.Seed(ami.Response{Events: []ami.Event{
+		ami.NewEvent("Event", "QueueParams", "Queue", "support", "Calls", "0"),
+		ami.NewEvent("Event", "QueueParams", "Queue", "sales", "Calls", "1"),
+		ami.NewEvent("Event", "QueueMember", "Queue", "sales", "Name", "Kitchen", "Location", "PJSIP/21",
+			"Status", "1", "Paused", "0"),
+		ami.NewEvent("Event", "QueueMember", "Queue", "sales", "Name", "Martin", "Location", "PJSIP/1986",
+			"Status", "5", "Paused", "0"),
+		ami.NewEvent("Event", "QueueEntry", "Queue", "sales", "Position", "1", "Uniqueid", "1770888500.1",
+			"Wait", "42"),
+		ami.NewEvent("Event", "QueueStatusComplete"),
+	}})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 queues, got %+v", got)
+	}
+	sales, support := got[0], got[1]
+	if sales.Queue != "sales" || sales.Waiting != 1 || sales.LongestWait != 42*time.Second ||
+		sales.Members != 2 || sales.Available != 1 {
+		t.Errorf("unexpected sales summary %+v", sales)
+	}
+	if support.Queue != "support" || support.Waiting != 0 || support.Members != 0 {
+		t.Errorf("unexpected support summary %+v", support)
+	}
+}
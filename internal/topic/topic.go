@@ -0,0 +1,234 @@
+// Package topic renders the MQTT topics call state changes are published
+// to, from templates such as "{prefix}/call/{call_id}/{event}".
+package topic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+)
+
+// Route publishes the changes for Events, or every change if Events is
+// empty, to the topic rendered from Template.
+type Route struct {
+	Template string
+	Events   []string
+}
+
+// DefaultRoutes is the layout used when none is configured: each call on
+// its own topics, with queue events under their queue and leg events
+// under their leg.
+var DefaultRoutes = []Route{
+	{
+		Template: "{prefix}/call/{call_id}/leg/{leg.id}/{leg.state}",
+		Events:   []string{"leg"},
+	},
+	{
+		Template: "{prefix}/queue/{queue}/call/{call_id}/{event}",
+		Events:   []string{"queued", "abandoned", "agent_connected"},
+	},
+	{
+		Template: "{prefix}/call/{call_id}/{event}",
+		Events: []string{"ringing", "answered", "voicemail", "transferred", "held", "resumed",
+			"updated", "parked", "unparked", "hungup"},
+	},
+}
+
+// fields maps each placeholder to the value it takes from a change.
+var fields = map[string]func(c correlator.CallStateChange) string{
+	"event":                 func(c correlator.CallStateChange) string { return string(c.State) },
+	"call_id":               func(c correlator.CallStateChange) string { return c.CallID },
+	"from.extension":        func(c correlator.CallStateChange) string { return c.From.Extension },
+	"from.name":             func(c correlator.CallStateChange) string { return c.From.Name },
+	"to.extension":          func(c correlator.CallStateChange) string { return c.To.Extension },
+	"to.name":               func(c correlator.CallStateChange) string { return c.To.Name },
+	"answered_by.extension": func(c correlator.CallStateChange) string { return endpointField(c.AnsweredBy).Extension },
+	"answered_by.name":      func(c correlator.CallStateChange) string { return endpointField(c.AnsweredBy).Name },
+	"queue":                 func(c correlator.CallStateChange) string { return c.Queue },
+	"mailbox":               func(c correlator.CallStateChange) string { return c.Mailbox },
+	"parking_lot":           func(c correlator.CallStateChange) string { return c.ParkingLot },
+	"parking_slot":          func(c correlator.CallStateChange) string { return c.ParkingSlot },
+	"outcome":               func(c correlator.CallStateChange) string { return string(c.Outcome) },
+	"leg.id":                func(c correlator.CallStateChange) string { return legField(c.Leg).ID },
+	"leg.state":             func(c correlator.CallStateChange) string { return string(legField(c.Leg).State) },
+	"leg.extension":         func(c correlator.CallStateChange) string { return legField(c.Leg).Endpoint.Extension },
+}
+
+func endpointField(ep *correlator.Endpoint) correlator.Endpoint {
+	if ep == nil {
+		return correlator.Endpoint{}
+	}
+	return *ep
+}
+
+func legField(l *correlator.Leg) correlator.Leg {
+	if l == nil {
+		return correlator.Leg{}
+	}
+	return *l
+}
+
+// Template is a parsed topic template: literal text with placeholders in
+// braces, e.g. "{prefix}/extension/{to.extension}/{event}".
+type Template struct {
+	raw   string
+	parts []part
+}
+
+// part is either literal text or, if field is set, a placeholder.
+type part struct {
+	literal string
+	field   string
+}
+
+// Parse parses a topic template, rejecting unknown placeholders and
+// characters that are not allowed in a topic that is published to.
+func Parse(s string) (*Template, error) {
+	if s == "" {
+		return nil, fmt.Errorf("topic template is empty")
+	}
+	t := &Template{raw: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("topic %q: unexpected }", s)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("topic %q: unclosed {", s)
+		}
+		name := rest[open+1 : open+end]
+		if _, ok := fields[name]; !ok && name != "prefix" {
+			return nil, fmt.Errorf("topic %q: unknown placeholder {%s}", s, name)
+		}
+		t.parts = append(t.parts, part{field: name})
+		rest = rest[open+end+1:]
+	}
+	for _, p := range t.parts {
+		if strings.ContainsAny(p.literal, "+#") {
+			return nil, fmt.Errorf("topic %q: wildcards + and # cannot be published to", s)
+		}
+	}
+	return t, nil
+}
+
+// String returns the template as written.
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Render fills in the template for change. It returns false if a
+// placeholder has no value for change, e.g. {queue} for a call that never
+// entered a queue, so the change is not published to this topic. Values
+// are made safe to use as a single topic level.
+func (t *Template) Render(prefix string, change correlator.CallStateChange) (string, bool) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "prefix":
+			b.WriteString(prefix)
+		default:
+			v := fields[p.field](change)
+			if v == "" {
+				return "", false
+			}
+			b.WriteString(levelReplacer.Replace(v))
+		}
+	}
+	return b.String(), true
+}
+
+// Level makes v safe to use as a single topic level, such as an extension
+// or queue name, by replacing the level separator and the wildcard
+// characters with "_".
+func Level(v string) string {
+	return levelReplacer.Replace(v)
+}
+
+var levelReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// Router maps each change to the topics it is published to.
+type Router struct {
+	prefix string
+	routes []route
+}
+
+type route struct {
+	tmpl   *Template
+	events map[correlator.CallState]bool // nil for every event
+}
+
+// NewRouter parses routes, or DefaultRoutes if there are none.
+func NewRouter(prefix string, routes []Route) (*Router, error) {
+	if len(routes) == 0 {
+		routes = DefaultRoutes
+	}
+	r := &Router{prefix: prefix}
+	for _, rt := range routes {
+		parsed, err := parseRoute(rt)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, parsed)
+	}
+	return r, nil
+}
+
+// Validate reports the first problem with a route, as NewRouter would.
+func Validate(rt Route) error {
+	_, err := parseRoute(rt)
+	return err
+}
+
+func parseRoute(rt Route) (route, error) {
+	tmpl, err := Parse(rt.Template)
+	if err != nil {
+		return route{}, err
+	}
+	parsed := route{tmpl: tmpl}
+	for _, name := range rt.Events {
+		if !correlator.IsState(name) {
+			return route{}, fmt.Errorf("topic %q: unknown event %q", rt.Template, name)
+		}
+		if parsed.events == nil {
+			parsed.events = map[correlator.CallState]bool{}
+		}
+		parsed.events[correlator.CallState(name)] = true
+	}
+	return parsed, nil
+}
+
+// Prefix returns the topic prefix the router renders {prefix} as.
+func (r *Router) Prefix() string {
+	return r.prefix
+}
+
+// Topics returns the topics change is published to, in route order and
+// without duplicates.
+func (r *Router) Topics(change correlator.CallStateChange) []string {
+	var topics []string
+	seen := map[string]bool{}
+	for _, rt := range r.routes {
+		if rt.events != nil && !rt.events[change.State] {
+			continue
+		}
+		topic, ok := rt.tmpl.Render(r.prefix, change)
+		if !ok || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+	return topics
+}
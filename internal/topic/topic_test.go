@@ -0,0 +1,146 @@
+package topic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sweeney/asterisk-mqtt/internal/correlator"
+)
+
+var answered = correlator.CallStateChange{
+	State:      correlator.StateAnswered,
+	CallID:     "1770888509.40",
+	From:       correlator.Endpoint{Extension: "1986", Name: "Martin"},
+	To:         correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+	AnsweredBy: &correlator.Endpoint{Extension: "21", Name: "Kitchen"},
+}
+
+func newRouter(t *testing.T, routes ...Route) *Router {
+	t.Helper()
+	r, err := NewRouter("asterisk", routes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r
+}
+
+func TestDefaultRoutes(t *testing.T) {
+	r := newRouter(t)
+
+	tests := []struct {
+		name   string
+		change correlator.CallStateChange
+		want   []string
+	}{
+		{"call event", answered, []string{"asterisk/call/1770888509.40/answered"}},
+		{"queue event", correlator.CallStateChange{State: correlator.StateQueued, CallID: "q.1", Queue: "sales"},
+			[]string{"asterisk/queue/sales/call/q.1/queued"}},
+		{"hungup after a queue", correlator.CallStateChange{State: correlator.StateHungUp, CallID: "q.1", Queue: "sales"},
+			[]string{"asterisk/call/q.1/hungup"}},
+		{"leg event", correlator.CallStateChange{State: correlator.StateLeg, CallID: "l.1",
+			Leg: &correlator.Leg{ID: "l.2", State: correlator.LegRinging}},
+			[]string{"asterisk/call/l.1/leg/l.2/ringing"}},
+	}
+	for _, tt := range tests {
+		if got := r.Topics(tt.change); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDefaultRoutesCoverEveryState(t *testing.T) {
+	r := newRouter(t)
+	for _, s := range []correlator.CallState{
+		correlator.StateRinging, correlator.StateAnswered, correlator.StateHungUp,
+		correlator.StateTransferred, correlator.StateHeld, correlator.StateResumed,
+		correlator.StateQueued, correlator.StateAbandoned, correlator.StateAgentConnected,
+		correlator.StateParked, correlator.StateUnparked, correlator.StateUpdated,
+		correlator.StateVoicemail, correlator.StateLeg,
+	} {
+		change := correlator.CallStateChange{State: s, CallID: "c.1", Queue: "sales",
+			Leg: &correlator.Leg{ID: "c.2", State: correlator.LegDialing}}
+		if topics := r.Topics(change); len(topics) != 1 {
+			t.Errorf("%s: expected exactly one default topic, got %v", s, topics)
+		}
+	}
+}
+
+func TestCustomRoutes(t *testing.T) {
+	r := newRouter(t,
+		Route{Template: "{prefix}/extension/{to.extension}/{event}"},
+		Route{Template: "{prefix}/events"},
+		Route{Template: "{prefix}/events", Events: []string{"answered"}},
+		Route{Template: "{prefix}/queue/{queue}/{event}"},
+	)
+
+	want := []string{"asterisk/extension/21/answered", "asterisk/events"}
+	if got := r.Topics(answered); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRouteEventFilter(t *testing.T) {
+	r := newRouter(t, Route{Template: "{prefix}/missed/{to.extension}", Events: []string{"hungup"}})
+
+	if got := r.Topics(answered); len(got) != 0 {
+		t.Errorf("expected answered to be filtered out, got %v", got)
+	}
+	hungup := answered
+	hungup.State = correlator.StateHungUp
+	if got := r.Topics(hungup); !reflect.DeepEqual(got, []string{"asterisk/missed/21"}) {
+		t.Errorf("expected asterisk/missed/21, got %v", got)
+	}
+}
+
+func TestRenderSanitisesValues(t *testing.T) {
+	tmpl, err := Parse("{prefix}/by-name/{from.name}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	change := answered
+	change.From.Name = "Sales/Support #1+"
+	got, ok := tmpl.Render("home/pbx", change)
+	if !ok || got != "home/pbx/by-name/Sales_Support _1_" {
+		t.Errorf("expected home/pbx/by-name/Sales_Support _1_, got %q", got)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := map[string]string{
+		"21@default":    "21@default",
+		"sales/support": "sales_support",
+		"room+1":        "room_1",
+		"#general":      "_general",
+		"floor/2+#3":    "floor_2__3",
+	}
+	for in, want := range tests {
+		if got := Level(in); got != want {
+			t.Errorf("Level(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                        `topic template is empty`,
+		"{prefix}/call/{id}":      `topic "{prefix}/call/{id}": unknown placeholder {id}`,
+		"{prefix}/call/{call_id":  `topic "{prefix}/call/{call_id": unclosed {`,
+		"{prefix}/call}/x":        `topic "{prefix}/call}/x": unexpected }`,
+		"{prefix}/call/+/{event}": `topic "{prefix}/call/+/{event}": wildcards + and # cannot be published to`,
+		"{prefix}/#":              `topic "{prefix}/#": wildcards + and # cannot be published to`,
+		"{prefix}/{}":             `topic "{prefix}/{}": unknown placeholder {}`,
+	}
+	for tmpl, want := range tests {
+		_, err := Parse(tmpl)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: expected error %q, got %v", tmpl, want, err)
+		}
+	}
+}
+
+func TestValidateUnknownEvent(t *testing.T) {
+	err := Validate(Route{Template: "{prefix}/events", Events: []string{"rining"}})
+	if err == nil || err.Error() != `topic "{prefix}/events": unknown event "rining"` {
+		t.Errorf("expected unknown event error, got %v", err)
+	}
+}